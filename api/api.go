@@ -0,0 +1,400 @@
+// Package api provides HTTP handlers for serving Who's On First records stored in a MySQL database.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-mysql/emitter"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// The default maximum number of results returned by the search and descendants handlers.
+const DEFAULT_LIMIT int = 100
+
+// The maximum value of the ?limit= parameter for the search and descendants handlers.
+const MAX_LIMIT int = 1000
+
+// The format for returning results as a list of standard places results.
+const FORMAT_SPR string = "spr"
+
+// The format for returning results as a GeoJSON FeatureCollection.
+const FORMAT_GEOJSON string = "geojson"
+
+// Database is the interface for reading, and querying, Who's On First records used by the handlers in this package. It
+// is implemented by `spatial.MySQLSpatialDatabase`.
+type Database interface {
+	// Read returns the GeoJSON body for the record (or alternate geometry) matching a relative path.
+	Read(context.Context, string) (io.ReadSeekCloser, error)
+	// PointInPolygon returns the records containing a point.
+	PointInPolygon(context.Context, *orb.Point, ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error)
+	// Search returns (up to a limit of) the records whose names start with a string.
+	Search(context.Context, string, int, ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error)
+	// Descendants returns (up to a limit of) the records that belong to a record.
+	Descendants(context.Context, int64, int, ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error)
+	// Features returns the GeoJSON bodies for a list of records, keyed by ID.
+	Features(context.Context, []int64) (map[int64][]byte, error)
+	// LookupId returns the record with an ID, or an error wrapping `fs.ErrNotExist` if it does not match the filters.
+	LookupId(context.Context, int64, ...*spatial.Filters) (*spatial.StandardPlacesResult, error)
+}
+
+// IdHandler returns an `http.Handler` that serves the GeoJSON body for the record whose ID matches the "{id}" path value.
+// Alternate geometries can be requested with the ?alt= parameter (for example "?alt=quattroshapes"). If the ?date=
+// parameter is present the record, or the alternate geometry requested, is only served if the record existed at that
+// time (see `FiltersFromQuery`).
+func IdHandler(spatial_db Database) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+		if err != nil {
+			http.Error(rsp, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		q := req.URL.Query()
+
+		path, err := emitter.RelPath(id, q.Get("alt"))
+
+		if err != nil {
+			http.Error(rsp, "Invalid alternate geometry", http.StatusBadRequest)
+			return
+		}
+
+		if q.Get("date") != "" {
+
+			r, err := spatial.DateRangeFromEDTF(q.Get("date"))
+
+			if err != nil {
+				http.Error(rsp, "Invalid ?date= parameter", http.StatusBadRequest)
+				return
+			}
+
+			_, err = spatial_db.LookupId(ctx, id, &spatial.Filters{ValidDuring: r})
+
+			if err != nil {
+
+				if errors.Is(err, fs.ErrNotExist) {
+					http.Error(rsp, "Not found", http.StatusNotFound)
+					return
+				}
+
+				slog.Error("Failed to lookup record", "id", id, "error", err)
+				http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		r, err := spatial_db.Read(ctx, path)
+
+		if err != nil {
+
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(rsp, "Not found", http.StatusNotFound)
+				return
+			}
+
+			slog.Error("Failed to read record", "path", path, "error", err)
+			http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		defer r.Close()
+
+		rsp.Header().Set("Content-Type", "application/geo+json")
+
+		_, err = io.Copy(rsp, r)
+
+		if err != nil {
+			slog.Error("Failed to write record", "path", path, "error", err)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// PointInPolygonHandler returns an `http.Handler` that serves the records containing the point defined by the ?lat= and
+// ?lon= parameters. Results may be filtered using the parameters described in the documentation for `FiltersFromQuery`.
+func PointInPolygonHandler(spatial_db Database) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+		q := req.URL.Query()
+
+		lat, err := strconv.ParseFloat(q.Get("lat"), 64)
+
+		if err != nil || lat < -90.0 || lat > 90.0 {
+			http.Error(rsp, "Invalid latitude", http.StatusBadRequest)
+			return
+		}
+
+		lon, err := strconv.ParseFloat(q.Get("lon"), 64)
+
+		if err != nil || lon < -180.0 || lon > 180.0 {
+			http.Error(rsp, "Invalid longitude", http.StatusBadRequest)
+			return
+		}
+
+		f, err := FiltersFromQuery(q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pt := orb.Point{lon, lat}
+
+		results, err := spatial_db.PointInPolygon(ctx, &pt, f)
+
+		if err != nil {
+			slog.Error("Failed to perform point in polygon query", "error", err)
+			http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeResults(rsp, req, spatial_db, results)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// SearchHandler returns an `http.Handler` that serves the records whose names start with the ?q= parameter. Results may
+// be filtered using the parameters described in the documentation for `FiltersFromQuery`.
+func SearchHandler(spatial_db Database) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+		q := req.URL.Query()
+
+		name := q.Get("q")
+
+		if name == "" {
+			http.Error(rsp, "Missing query", http.StatusBadRequest)
+			return
+		}
+
+		limit, err := limitFromQuery(q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f, err := FiltersFromQuery(q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := spatial_db.Search(ctx, name, limit, f)
+
+		if err != nil {
+			slog.Error("Failed to perform search query", "error", err)
+			http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeResults(rsp, req, spatial_db, results)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// DescendantsHandler returns an `http.Handler` that serves the records that belong to the record whose ID matches the
+// "{id}" path value. Results may be filtered using the parameters described in the documentation for `FiltersFromQuery`.
+func DescendantsHandler(spatial_db Database) http.Handler {
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+		q := req.URL.Query()
+
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+		if err != nil {
+			http.Error(rsp, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		limit, err := limitFromQuery(q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f, err := FiltersFromQuery(q)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := spatial_db.Descendants(ctx, id, limit, f)
+
+		if err != nil {
+			slog.Error("Failed to perform descendants query", "id", id, "error", err)
+			http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeResults(rsp, req, spatial_db, results)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// FiltersFromQuery returns a `spatial.Filters` instance derived from 'q'. Valid parameters are:
+// * `?placetype=` Zero or more placetypes to match.
+// * `?is_current=` Zero or more "mz:is_current" values (-1, 0 or 1) to match.
+// * `?is_ceased=` Zero or more "is_ceased" values (0 or 1) to match.
+// * `?is_deprecated=` Zero or more "is_deprecated" values (0 or 1) to match.
+// * `?is_superseded=` Zero or more "is_superseded" values (0 or 1) to match.
+// * `?is_superseding=` Zero or more "is_superseding" values (0 or 1) to match.
+// * `?date=` An EDTF date (for example "1906-04-18" or "1900/1910") during which records must have existed.
+func FiltersFromQuery(q url.Values) (*spatial.Filters, error) {
+
+	f := &spatial.Filters{
+		Placetypes: q["placetype"],
+	}
+
+	existential := map[string]*[]int64{
+		"is_current":     &f.IsCurrent,
+		"is_ceased":      &f.IsCeased,
+		"is_deprecated":  &f.IsDeprecated,
+		"is_superseded":  &f.IsSuperseded,
+		"is_superseding": &f.IsSuperseding,
+	}
+
+	for k, values := range existential {
+
+		for _, str_v := range q[k] {
+
+			v, err := strconv.ParseInt(str_v, 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("Invalid ?%s= parameter", k)
+			}
+
+			*values = append(*values, v)
+		}
+	}
+
+	if q.Get("date") != "" {
+
+		r, err := spatial.DateRangeFromEDTF(q.Get("date"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?date= parameter")
+		}
+
+		f.ValidDuring = r
+	}
+
+	return f, nil
+}
+
+// limitFromQuery returns the value of the ?limit= parameter in 'q' or `DEFAULT_LIMIT` if it is not present.
+func limitFromQuery(q url.Values) (int, error) {
+
+	if q.Get("limit") == "" {
+		return DEFAULT_LIMIT, nil
+	}
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+
+	if err != nil || limit < 1 || limit > MAX_LIMIT {
+		return 0, fmt.Errorf("Invalid ?limit= parameter, must be between 1 and %d", MAX_LIMIT)
+	}
+
+	return limit, nil
+}
+
+// writeResults writes 'results' to 'rsp' as JSON-encoded standard places results or, if the ?format=geojson parameter
+// is present, as a GeoJSON FeatureCollection.
+func writeResults(rsp http.ResponseWriter, req *http.Request, spatial_db Database, results []*spatial.StandardPlacesResult) {
+
+	ctx := req.Context()
+
+	format := req.URL.Query().Get("format")
+
+	switch format {
+	case "", FORMAT_SPR:
+
+		rsp.Header().Set("Content-Type", "application/json")
+
+		body := map[string]interface{}{
+			"places": results,
+		}
+
+		err := json.NewEncoder(rsp).Encode(body)
+
+		if err != nil {
+			slog.Error("Failed to write results", "error", err)
+		}
+
+	case FORMAT_GEOJSON:
+
+		ids := make([]int64, len(results))
+
+		for idx, spr := range results {
+			ids[idx] = spr.WOFId
+		}
+
+		bodies, err := spatial_db.Features(ctx, ids)
+
+		if err != nil {
+			slog.Error("Failed to retrieve records", "error", err)
+			http.Error(rsp, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Preserve the order of 'results', skipping any records which have been removed from the "geojson"
+		// table since the query was performed.
+
+		features := make([]json.RawMessage, 0, len(results))
+
+		for _, id := range ids {
+
+			body, ok := bodies[id]
+
+			if !ok {
+				slog.Warn("Record not found", "id", id)
+				continue
+			}
+
+			features = append(features, json.RawMessage(body))
+		}
+
+		rsp.Header().Set("Content-Type", "application/geo+json")
+
+		fc := map[string]interface{}{
+			"type":     "FeatureCollection",
+			"features": features,
+		}
+
+		err = json.NewEncoder(rsp).Encode(fc)
+
+		if err != nil {
+			slog.Error("Failed to write results", "error", err)
+		}
+
+	default:
+		http.Error(rsp, "Invalid or unsupported format", http.StatusBadRequest)
+	}
+}
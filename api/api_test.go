@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// testDatabase is a `Database` implementation which serves records from a fixed map of bodies, keyed by relative path,
+// and returns a fixed list of results for every query.
+type testDatabase struct {
+	bodies        map[string][]byte
+	results       []*spatial.StandardPlacesResult
+	features      map[int64][]byte
+	features_hits int
+	filters       *spatial.Filters
+	limit         int
+	// ceased maps the IDs of records to the date they ceased to exist
+	ceased map[int64]time.Time
+}
+
+type readSeekCloser struct {
+	*strings.Reader
+}
+
+func (r *readSeekCloser) Close() error {
+	return nil
+}
+
+func (db *testDatabase) Read(ctx context.Context, path string) (io.ReadSeekCloser, error) {
+
+	body, ok := db.bodies[path]
+
+	if !ok {
+		return nil, fmt.Errorf("Failed to read %s, %w", path, fs.ErrNotExist)
+	}
+
+	return &readSeekCloser{strings.NewReader(string(body))}, nil
+}
+
+func (db *testDatabase) PointInPolygon(ctx context.Context, pt *orb.Point, filters ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error) {
+	db.filters = filters[0]
+	return db.results, nil
+}
+
+func (db *testDatabase) Search(ctx context.Context, name string, limit int, filters ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error) {
+	db.filters = filters[0]
+	db.limit = limit
+	return db.results, nil
+}
+
+func (db *testDatabase) Descendants(ctx context.Context, id int64, limit int, filters ...*spatial.Filters) ([]*spatial.StandardPlacesResult, error) {
+	db.filters = filters[0]
+	db.limit = limit
+	return db.results, nil
+}
+
+func (db *testDatabase) Features(ctx context.Context, ids []int64) (map[int64][]byte, error) {
+
+	db.features_hits += 1
+
+	features := make(map[int64][]byte)
+
+	for _, id := range ids {
+
+		body, ok := db.features[id]
+
+		if ok {
+			features[id] = body
+		}
+	}
+
+	return features, nil
+}
+
+func (db *testDatabase) LookupId(ctx context.Context, id int64, filters ...*spatial.Filters) (*spatial.StandardPlacesResult, error) {
+
+	t, ok := db.ceased[id]
+
+	if !ok {
+		return nil, fmt.Errorf("Failed to lookup %d, %w", id, fs.ErrNotExist)
+	}
+
+	for _, f := range filters {
+
+		if f.ValidDuring != nil && f.ValidDuring.Start != nil && f.ValidDuring.Start.After(t) {
+			return nil, fmt.Errorf("Failed to lookup %d, %w", id, fs.ErrNotExist)
+		}
+	}
+
+	return &spatial.StandardPlacesResult{WOFId: id}, nil
+}
+
+func newTestDatabase() *testDatabase {
+
+	return &testDatabase{
+		bodies: map[string][]byte{
+			"101/736/545/101736545.geojson":                   []byte(`{"id":101736545}`),
+			"101/736/545/101736545-alt-quattroshapes.geojson": []byte(`{"id":101736545,"alt":"quattroshapes"}`),
+		},
+		results: []*spatial.StandardPlacesResult{
+			{WOFId: 85922583},
+			{WOFId: 101736545},
+			{WOFId: 1},
+		},
+		features: map[int64][]byte{
+			101736545: []byte(`{"id":101736545}`),
+			85922583:  []byte(`{"id":85922583}`),
+		},
+		ceased: map[int64]time.Time{
+			101736545: time.Date(1990, 12, 31, 0, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func newTestMux(db Database) *http.ServeMux {
+
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /id/{id}", IdHandler(db))
+	mux.Handle("GET /pip", PointInPolygonHandler(db))
+	mux.Handle("GET /search", SearchHandler(db))
+	mux.Handle("GET /descendants/{id}", DescendantsHandler(db))
+
+	return mux
+}
+
+func TestHandlers(t *testing.T) {
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/id/101736545", http.StatusOK, `{"id":101736545}`},
+		{"/id/101736545?alt=quattroshapes", http.StatusOK, `{"id":101736545,"alt":"quattroshapes"}`},
+		{"/id/85922583", http.StatusNotFound, ""},
+		{"/id/abc", http.StatusBadRequest, ""},
+		{"/id/101736545?date=1906-04-18", http.StatusOK, `{"id":101736545}`},
+		{"/id/101736545?date=2019", http.StatusNotFound, ""},
+		{"/id/101736545?date=tomorrow", http.StatusBadRequest, ""},
+		{"/id/101736545?date=1906-04-18&alt=quattroshapes", http.StatusOK, `{"id":101736545,"alt":"quattroshapes"}`},
+		{"/id/101736545?date=2019&alt=quattroshapes", http.StatusNotFound, ""},
+		{"/id/85922583?date=1906", http.StatusNotFound, ""},
+		{"/pip?lat=37.794893&lon=-122.395268&date=tomorrow", http.StatusBadRequest, ""},
+		{"/pip?lat=37.794893&lon=-122.395268", http.StatusOK, ""},
+		{"/pip?lat=91&lon=-122.395268", http.StatusBadRequest, ""},
+		{"/pip?lat=37.794893&lon=abc", http.StatusBadRequest, ""},
+		{"/pip?lat=37.794893&lon=-122.395268&is_current=yes", http.StatusBadRequest, ""},
+		{"/search?q=San", http.StatusOK, ""},
+		{"/search", http.StatusBadRequest, ""},
+		{"/search?q=San&limit=0", http.StatusBadRequest, ""},
+		{"/search?q=San&limit=1001", http.StatusBadRequest, ""},
+		{"/search?q=San&format=csv", http.StatusBadRequest, ""},
+		{"/descendants/85633041", http.StatusOK, ""},
+		{"/descendants/abc", http.StatusBadRequest, ""},
+		{"/descendants/85633041?limit=abc", http.StatusBadRequest, ""},
+	}
+
+	mux := newTestMux(newTestDatabase())
+
+	for _, test := range tests {
+
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		rsp := httptest.NewRecorder()
+
+		mux.ServeHTTP(rsp, req)
+
+		if rsp.Code != test.status {
+			t.Fatalf("Expected status %d for %s, got %d", test.status, test.path, rsp.Code)
+		}
+
+		if test.body != "" && rsp.Body.String() != test.body {
+			t.Fatalf("Unexpected body for %s: %s", test.path, rsp.Body.String())
+		}
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+
+	tests := []struct {
+		path     string
+		key      string
+		expected []int64
+	}{
+		{"/search?q=San", "places", []int64{85922583, 101736545, 1}},
+		{"/search?q=San&format=spr", "places", []int64{85922583, 101736545, 1}},
+		// Records missing from the "geojson" table are skipped and the order of results is preserved
+		{"/search?q=San&format=geojson", "features", []int64{85922583, 101736545}},
+	}
+
+	for _, test := range tests {
+
+		db := newTestDatabase()
+		mux := newTestMux(db)
+
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		rsp := httptest.NewRecorder()
+
+		mux.ServeHTTP(rsp, req)
+
+		if rsp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", test.path, rsp.Code)
+		}
+
+		var body struct {
+			Places []struct {
+				WOFId int64 `json:"wof:id"`
+			} `json:"places"`
+			Features []struct {
+				Id int64 `json:"id"`
+			} `json:"features"`
+		}
+
+		err := json.Unmarshal(rsp.Body.Bytes(), &body)
+
+		if err != nil {
+			t.Fatalf("Failed to decode response for %s, %v", test.path, err)
+		}
+
+		ids := make([]int64, 0)
+
+		for _, r := range body.Places {
+			ids = append(ids, r.WOFId)
+		}
+
+		for _, f := range body.Features {
+			ids = append(ids, f.Id)
+		}
+
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Fatalf("Unexpected results for %s: %v", test.path, ids)
+		}
+
+		if test.key == "features" && db.features_hits != 1 {
+			t.Fatalf("Expected a single call to Features for %s, got %d", test.path, db.features_hits)
+		}
+	}
+}
+
+func TestFiltersFromQuery(t *testing.T) {
+
+	start := time.Date(1906, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(1906, 12, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		query    string
+		expected *spatial.Filters
+		ok       bool
+	}{
+		{"", &spatial.Filters{}, true},
+		{"placetype=locality&placetype=neighbourhood", &spatial.Filters{Placetypes: []string{"locality", "neighbourhood"}}, true},
+		{"is_current=1&is_current=-1&is_deprecated=0", &spatial.Filters{IsCurrent: []int64{1, -1}, IsDeprecated: []int64{0}}, true},
+		{"is_ceased=1&is_superseded=0&is_superseding=1", &spatial.Filters{IsCeased: []int64{1}, IsSuperseded: []int64{0}, IsSuperseding: []int64{1}}, true},
+		{"date=1906", &spatial.Filters{ValidDuring: &spatial.DateRange{Start: &start, End: &end}}, true},
+		{"date=tomorrow", nil, false},
+		{"is_current=yes", nil, false},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", test.query, err)
+		}
+
+		f, err := FiltersFromQuery(q)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.query)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to derive filters from '%s', %v", test.query, err)
+		}
+
+		if !reflect.DeepEqual(f, test.expected) {
+			t.Fatalf("Unexpected filters for '%s': %+v", test.query, f)
+		}
+	}
+}
+
+func TestLimitFromQuery(t *testing.T) {
+
+	tests := []struct {
+		query    string
+		expected int
+		ok       bool
+	}{
+		{"", DEFAULT_LIMIT, true},
+		{"limit=1", 1, true},
+		{"limit=1000", MAX_LIMIT, true},
+		{"limit=0", 0, false},
+		{"limit=1001", 0, false},
+		{"limit=-5", 0, false},
+		{"limit=ten", 0, false},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", test.query, err)
+		}
+
+		limit, err := limitFromQuery(q)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for '%s', %v", test.query, err)
+		}
+
+		if limit != test.expected {
+			t.Fatalf("Expected limit %d for '%s', got %d", test.expected, test.query, limit)
+		}
+	}
+}
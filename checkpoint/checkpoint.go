@@ -0,0 +1,355 @@
+// Package checkpoint provides methods for recording, and resuming from, the progress of an import in a MySQL table.
+//
+// Progress is recorded as a high-water mark for each directory (root) being iterated: the (relative) path of the last
+// record such that it, and every record emitted before it, has been durably indexed. This requires that records are
+// emitted in a deterministic order which is why checkpoints are only supported for the ordered emitters defined in
+// this package.
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+)
+
+// The name of the table used to store checkpoints.
+const CHECKPOINTS_TABLE_NAME string = "checkpoints"
+
+// The maximum length of a checkpoint source, root or path.
+const MAX_LENGTH int = 255
+
+// The default number of completed records after which checkpoints are committed.
+const DEFAULT_BATCH_SIZE int = 500
+
+const checkpoints_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      source VARCHAR(255) NOT NULL,
+      root VARCHAR(255) NOT NULL,
+      path VARCHAR(255) NOT NULL,
+      lastmodified INT NOT NULL,
+      PRIMARY KEY (source, root)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+// Checkpoints records the high-water mark of the records that have been durably indexed, for each root being
+// iterated, for a given iterator source.
+type Checkpoints struct {
+	db     wof_sql.Database
+	source string
+	// The high-water marks committed to the checkpoints table, keyed by root. Marks are read the first time a root is checked.
+	marks map[string]string
+	// The records added, but not yet committed, for each root in the order they were added.
+	pending map[string][]*Pending
+	// The number of records completed since checkpoints were last committed.
+	completed int
+	// Whether checkpoints have stopped advancing because the underlying writer failed to flush.
+	frozen bool
+	mu     *sync.Mutex
+	// The number of completed records after which checkpoints should be committed.
+	BatchSize int
+}
+
+// Pending is a record that has been added to a `Checkpoints` instance but not yet committed.
+type Pending struct {
+	root string
+	path string
+	done bool
+}
+
+// NewCheckpoints returns a new `Checkpoints` instance for 'source' stored in 'db', creating the checkpoints table if necessary.
+func NewCheckpoints(ctx context.Context, db wof_sql.Database, source string) (*Checkpoints, error) {
+
+	if source == "" {
+		return nil, fmt.Errorf("Missing checkpoint source")
+	}
+
+	if len(source) > MAX_LENGTH {
+		return nil, fmt.Errorf("Checkpoint source exceeds maximum length (%d)", MAX_LENGTH)
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := fmt.Sprintf(checkpoints_schema, CHECKPOINTS_TABLE_NAME)
+
+	_, err = conn.ExecContext(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create checkpoints table, %w", err)
+	}
+
+	c := &Checkpoints{
+		db:        db,
+		source:    source,
+		marks:     make(map[string]string),
+		pending:   make(map[string][]*Pending),
+		mu:        new(sync.Mutex),
+		BatchSize: DEFAULT_BATCH_SIZE,
+	}
+
+	return c, nil
+}
+
+// Completed returns a boolean value indicating whether 'path', relative to 'root', is at or below the high-water
+// mark committed for 'root'.
+func (c *Checkpoints) Completed(ctx context.Context, root string, path string) (bool, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mark, ok := c.marks[root]
+
+	if !ok {
+
+		m, err := c.load(ctx, root)
+
+		if err != nil {
+			return false, err
+		}
+
+		c.marks[root] = m
+		mark = m
+	}
+
+	if mark == "" {
+		return false, nil
+	}
+
+	return comparePaths(path, mark) <= 0, nil
+}
+
+// load returns the high-water mark committed for 'root' or an empty string if there is none.
+func (c *Checkpoints) load(ctx context.Context, root string) (string, error) {
+
+	conn, err := c.db.Conn()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := fmt.Sprintf("SELECT path FROM %s WHERE source = ? AND root = ?", CHECKPOINTS_TABLE_NAME)
+
+	rows, err := conn.QueryContext(ctx, q, c.source, root)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to query checkpoint, %w", err)
+	}
+
+	defer rows.Close()
+
+	mark := ""
+
+	for rows.Next() {
+
+		err := rows.Scan(&mark)
+
+		if err != nil {
+			return "", fmt.Errorf("Failed to scan checkpoint, %w", err)
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to iterate checkpoint, %w", err)
+	}
+
+	return mark, nil
+}
+
+// Add records that 'path', relative to 'root', has been emitted. Paths must be added in the order they are emitted
+// and must sort after any path previously added, or committed, for 'root'. The `Complete` method should be invoked
+// with the `Pending` instance returned once the record has been written.
+func (c *Checkpoints) Add(root string, path string) (*Pending, error) {
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing checkpoint path")
+	}
+
+	if len(root) > MAX_LENGTH {
+		return nil, fmt.Errorf("Checkpoint root %s exceeds maximum length (%d)", root, MAX_LENGTH)
+	}
+
+	if len(path) > MAX_LENGTH {
+		return nil, fmt.Errorf("Checkpoint path %s exceeds maximum length (%d)", path, MAX_LENGTH)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last := c.marks[root]
+	pending := c.pending[root]
+
+	if len(pending) > 0 {
+		last = pending[len(pending)-1].path
+	}
+
+	if last != "" && comparePaths(path, last) <= 0 {
+		return nil, fmt.Errorf("Checkpoint path %s was added out of order (after %s)", path, last)
+	}
+
+	p := &Pending{
+		root: root,
+		path: path,
+	}
+
+	c.pending[root] = append(pending, p)
+	return p, nil
+}
+
+// Complete records that 'p' has been written. It returns a boolean value indicating whether the number of records
+// completed since checkpoints were last committed has reached the batch size.
+func (c *Checkpoints) Complete(p *Pending) bool {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p.done = true
+	c.completed += 1
+
+	return c.completed >= c.BatchSize
+}
+
+// take returns the new high-water mark for each root, keyed by root, and removes the records up to and including
+// that mark from the list of pending records. A root's mark only advances over records that have been completed
+// and which were added before any record that has not been completed.
+func (c *Checkpoints) take() map[string]string {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	marks := make(map[string]string)
+
+	c.completed = 0
+
+	if c.frozen {
+		return marks
+	}
+
+	for root, pending := range c.pending {
+
+		i := 0
+
+		for i < len(pending) && pending[i].done {
+			i += 1
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		marks[root] = pending[i-1].path
+		c.pending[root] = pending[i:]
+	}
+
+	return marks
+}
+
+// freeze stops checkpoints from advancing for the remainder of the import. This is used when the underlying writer
+// fails to flush since it is not possible to know which records failed.
+func (c *Checkpoints) freeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frozen = true
+}
+
+// record commits 'marks' to the checkpoints table.
+func (c *Checkpoints) record(ctx context.Context, marks map[string]string) error {
+
+	if len(marks) == 0 {
+		return nil
+	}
+
+	conn, err := c.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	now := time.Now().Unix()
+
+	placeholders := make([]string, 0, len(marks))
+	args := make([]interface{}, 0, len(marks)*4)
+
+	for root, path := range marks {
+		placeholders = append(placeholders, "(?, ?, ?, ?)")
+		args = append(args, c.source, root, path, now)
+	}
+
+	q := fmt.Sprintf("REPLACE INTO %s (source, root, path, lastmodified) VALUES %s", CHECKPOINTS_TABLE_NAME, strings.Join(placeholders, ", "))
+
+	_, err = conn.ExecContext(ctx, q, args...)
+
+	if err != nil {
+		return fmt.Errorf("Failed to record checkpoints, %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for root, path := range marks {
+		c.marks[root] = path
+	}
+
+	return nil
+}
+
+// Reset removes all the checkpoints recorded for the source.
+func (c *Checkpoints) Reset(ctx context.Context) error {
+
+	c.mu.Lock()
+	c.marks = make(map[string]string)
+	c.pending = make(map[string][]*Pending)
+	c.completed = 0
+	c.mu.Unlock()
+
+	conn, err := c.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE source = ?", CHECKPOINTS_TABLE_NAME)
+
+	_, err = conn.ExecContext(ctx, q, c.source)
+
+	if err != nil {
+		return fmt.Errorf("Failed to reset checkpoints, %w", err)
+	}
+
+	return nil
+}
+
+// comparePaths compares 'a' and 'b' one path element at a time which is the order that the ordered emitters
+// defined in this package walk a directory. It returns -1 if 'a' sorts before 'b', 1 if it sorts after and 0
+// if they are the same.
+func comparePaths(a string, b string) int {
+
+	a_parts := strings.Split(filepath.ToSlash(a), "/")
+	b_parts := strings.Split(filepath.ToSlash(b), "/")
+
+	for i := 0; i < len(a_parts) && i < len(b_parts); i++ {
+
+		switch {
+		case a_parts[i] < b_parts[i]:
+			return -1
+		case a_parts[i] > b_parts[i]:
+			return 1
+		}
+	}
+
+	switch {
+	case len(a_parts) < len(b_parts):
+		return -1
+	case len(a_parts) > len(b_parts):
+		return 1
+	default:
+		return 0
+	}
+}
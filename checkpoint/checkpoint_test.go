@@ -0,0 +1,421 @@
+package checkpoint
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+)
+
+// testDriver is a minimal `database/sql/driver.Driver` implementation which records the statements it is asked to
+// execute and answers queries for checkpoints from a fixed map of high-water marks, keyed by root.
+type testDriver struct {
+	mu      sync.Mutex
+	execs   [][]driver.Value
+	queries int
+	marks   map[string]string
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error) {
+	return &testConn{driver: d}, nil
+}
+
+type testConn struct {
+	driver *testDriver
+}
+
+func (c *testConn) Prepare(q string) (driver.Stmt, error) {
+	return &testStmt{driver: c.driver, query: q}, nil
+}
+
+func (c *testConn) Close() error {
+	return nil
+}
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("Transactions are not supported")
+}
+
+type testStmt struct {
+	driver *testDriver
+	query  string
+}
+
+func (s *testStmt) Close() error {
+	return nil
+}
+
+func (s *testStmt) NumInput() int {
+	return strings.Count(s.query, "?")
+}
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+
+	s.driver.mu.Lock()
+	defer s.driver.mu.Unlock()
+
+	s.driver.execs = append(s.driver.execs, args)
+	return driver.RowsAffected(len(args) / 4), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+
+	s.driver.mu.Lock()
+	defer s.driver.mu.Unlock()
+
+	s.driver.queries += 1
+
+	paths := make([]string, 0)
+
+	mark, ok := s.driver.marks[args[1].(string)]
+
+	if ok {
+		paths = append(paths, mark)
+	}
+
+	return &testRows{paths: paths}, nil
+}
+
+type testRows struct {
+	paths []string
+	idx   int
+}
+
+func (r *testRows) Columns() []string {
+	return []string{"path"}
+}
+
+func (r *testRows) Close() error {
+	return nil
+}
+
+func (r *testRows) Next(dest []driver.Value) error {
+
+	if r.idx >= len(r.paths) {
+		return io.EOF
+	}
+
+	dest[0] = r.paths[r.idx]
+	r.idx += 1
+	return nil
+}
+
+// testDatabase implements the `wof_sql.Database` interface for a `testDriver`.
+type testDatabase struct {
+	wof_sql.Database
+	db *sql.DB
+}
+
+func (d *testDatabase) Conn() (*sql.DB, error) {
+	return d.db, nil
+}
+
+var register_once sync.Once
+var test_drivers = make(map[string]*testDriver)
+var test_drivers_mu sync.Mutex
+
+// dispatchDriver routes connections to the `testDriver` registered for each test, by name.
+type dispatchDriver struct{}
+
+func (dispatchDriver) Open(name string) (driver.Conn, error) {
+
+	test_drivers_mu.Lock()
+	d := test_drivers[name]
+	test_drivers_mu.Unlock()
+
+	return d.Open(name)
+}
+
+func newTestCheckpoints(t *testing.T, marks map[string]string) (*Checkpoints, *testDriver) {
+
+	register_once.Do(func() {
+		sql.Register("checkpoint_test", dispatchDriver{})
+	})
+
+	d := &testDriver{
+		execs: make([][]driver.Value, 0),
+		marks: marks,
+	}
+
+	test_drivers_mu.Lock()
+	test_drivers[t.Name()] = d
+	test_drivers_mu.Unlock()
+
+	db, err := sql.Open("checkpoint_test", t.Name())
+
+	if err != nil {
+		t.Fatalf("Failed to open test database, %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	c, err := NewCheckpoints(context.Background(), &testDatabase{db: db}, "test")
+
+	if err != nil {
+		t.Fatalf("Failed to create checkpoints, %v", err)
+	}
+
+	// Ignore the statement creating the checkpoints table
+	d.execs = d.execs[:0]
+
+	return c, d
+}
+
+// flushWriter is a `writer.Writer` implementation whose Flush method invokes a callback.
+type flushWriter struct {
+	flush func() error
+}
+
+func (wr *flushWriter) Write(ctx context.Context, path string, r io.ReadSeeker) (int64, error) {
+	return 0, nil
+}
+
+func (wr *flushWriter) WriterURI(ctx context.Context, uri string) string {
+	return uri
+}
+
+func (wr *flushWriter) Flush(ctx context.Context) error {
+	return wr.flush()
+}
+
+func (wr *flushWriter) Close(ctx context.Context) error {
+	return nil
+}
+
+func (wr *flushWriter) SetLogger(ctx context.Context, logger *log.Logger) error {
+	return nil
+}
+
+// recordedMarks returns the high-water marks recorded by 'd', keyed by root.
+func recordedMarks(d *testDriver) map[string]string {
+
+	marks := make(map[string]string)
+
+	for _, args := range d.execs {
+
+		for i := 0; i+3 < len(args); i += 4 {
+			marks[args[i+1].(string)] = args[i+2].(string)
+		}
+	}
+
+	return marks
+}
+
+func TestComparePaths(t *testing.T) {
+
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"101/736/545/101736545.geojson", "101/736/545/101736545.geojson", 0},
+		{"101/736/545/101736545.geojson", "101/736/546/101736546.geojson", -1},
+		{"1010/1.geojson", "101/2.geojson", 1},
+		// A directory's contents are walked before any sibling whose name sorts after it
+		{"101/1.geojson", "101-alt.geojson", -1},
+		{"101/736/545/101736545.geojson", "101/736/545/101736545-alt-quattroshapes.geojson", 1},
+	}
+
+	for _, test := range tests {
+
+		v := comparePaths(test.a, test.b)
+
+		if v != test.expected {
+			t.Fatalf("Expected comparing %s and %s to return %d, got %d", test.a, test.b, test.expected, v)
+		}
+	}
+}
+
+func TestCheckpointsAdd(t *testing.T) {
+
+	c, _ := newTestCheckpoints(t, nil)
+
+	_, err := c.Add("/data", "101/1.geojson")
+
+	if err != nil {
+		t.Fatalf("Failed to add checkpoint, %v", err)
+	}
+
+	tests := []struct {
+		name string
+		root string
+		path string
+		ok   bool
+	}{
+		{"empty", "/data", "", false},
+		{"path too long", "/data", strings.Repeat("a", MAX_LENGTH+1), false},
+		{"root too long", "/" + strings.Repeat("a", MAX_LENGTH), "101/2.geojson", false},
+		{"out of order", "/data", "100/1.geojson", false},
+		{"duplicate", "/data", "101/1.geojson", false},
+		{"in order", "/data", "101/2.geojson", true},
+		{"other root", "/other", "100/1.geojson", true},
+		{"maximum length", "/data", "102/" + strings.Repeat("a", MAX_LENGTH-4), true},
+	}
+
+	for _, test := range tests {
+
+		_, err := c.Add(test.root, test.path)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result adding %s (%s), %v", test.name, test.path, err)
+		}
+	}
+}
+
+func TestCheckpointWriterCommit(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		flush_err error
+		recorded  map[string]string
+		frozen    bool
+	}{
+		{
+			name:     "flushed",
+			recorded: map[string]string{"/a": "1.geojson", "/b": "1.geojson"},
+		},
+		{
+			name:      "failed",
+			flush_err: fmt.Errorf("Flush failed"),
+			recorded:  map[string]string{},
+			frozen:    true,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			c, d := newTestCheckpoints(t, nil)
+
+			add := func(root string, path string) *Pending {
+
+				p, err := c.Add(root, path)
+
+				if err != nil {
+					t.Fatalf("Failed to add %s, %v", path, err)
+				}
+
+				return p
+			}
+
+			a1 := add("/a", "1.geojson")
+			add("/a", "2.geojson")
+			a3 := add("/a", "3.geojson")
+			b1 := add("/b", "1.geojson")
+			b2 := add("/b", "2.geojson")
+
+			c.Complete(a1)
+			c.Complete(a3)
+			c.Complete(b1)
+
+			// Simulate a record which is completed while the underlying writer is being flushed. It has
+			// not been flushed so it must not be recorded by this commit.
+
+			wr := &flushWriter{
+				flush: func() error {
+					c.Complete(b2)
+					return test.flush_err
+				},
+			}
+
+			cp_wr := &CheckpointWriter{
+				writer:      wr,
+				checkpoints: c,
+			}
+
+			err := cp_wr.Flush(ctx)
+
+			if (err != nil) != (test.flush_err != nil) {
+				t.Fatalf("Unexpected error flushing writer, %v", err)
+			}
+
+			recorded := recordedMarks(d)
+
+			if fmt.Sprintf("%v", recorded) != fmt.Sprintf("%v", test.recorded) {
+				t.Fatalf("Unexpected recorded marks: %v", recorded)
+			}
+
+			if c.frozen != test.frozen {
+				t.Fatalf("Expected frozen to be %t", test.frozen)
+			}
+
+			// The next commit should advance "/b" over the record completed during the previous flush, unless
+			// checkpoints have been frozen.
+
+			wr.flush = func() error {
+				return nil
+			}
+
+			err = cp_wr.Flush(ctx)
+
+			if err != nil {
+				t.Fatalf("Failed to flush writer, %v", err)
+			}
+
+			recorded = recordedMarks(d)
+
+			if !test.frozen && recorded["/b"] != "2.geojson" {
+				t.Fatalf("Expected /b to advance to 2.geojson, got %v", recorded)
+			}
+
+			if test.frozen && len(recorded) != 0 {
+				t.Fatalf("Expected no marks to be recorded once frozen, got %v", recorded)
+			}
+		})
+	}
+}
+
+func TestCheckpointsCompleted(t *testing.T) {
+
+	ctx := context.Background()
+
+	c, d := newTestCheckpoints(t, map[string]string{"/a": "101/736/545/101736545.geojson"})
+
+	tests := []struct {
+		root     string
+		path     string
+		expected bool
+	}{
+		{"/a", "101/736/545/101736545.geojson", true},
+		{"/a", "101/736/545/101736545-alt-quattroshapes.geojson", true},
+		{"/a", "1/1.geojson", true},
+		{"/a", "101/736/546/101736546.geojson", false},
+		{"/a", "1010/1.geojson", false},
+		{"/b", "1/1.geojson", false},
+	}
+
+	for _, test := range tests {
+
+		ok, err := c.Completed(ctx, test.root, test.path)
+
+		if err != nil {
+			t.Fatalf("Failed to determine whether %s has been completed, %v", test.path, err)
+		}
+
+		if ok != test.expected {
+			t.Fatalf("Unexpected result for %s%s: %t", test.root, test.path, ok)
+		}
+	}
+
+	if d.queries != 2 {
+		t.Fatalf("Expected one query per root, got %d queries", d.queries)
+	}
+
+	_, err := c.Add("/a", "1/2.geojson")
+
+	if err == nil {
+		t.Fatalf("Expected adding a path below the high-water mark to fail")
+	}
+}
@@ -0,0 +1,174 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/filters"
+)
+
+// The URI scheme for the ordered equivalent of the `directory://` emitter.
+const DIRECTORY_SCHEME string = "checkpoint-directory"
+
+// The URI scheme for the ordered equivalent of the `repo://` emitter.
+const REPO_SCHEME string = "checkpoint-repo"
+
+func init() {
+	ctx := context.Background()
+	emitter.RegisterEmitter(ctx, DIRECTORY_SCHEME, NewOrderedEmitter)
+	emitter.RegisterEmitter(ctx, REPO_SCHEME, NewOrderedEmitter)
+}
+
+// rootKey is the context key for the root directory being walked by an `OrderedEmitter`.
+type rootKey struct{}
+
+// OrderedEmitter implements the `whosonfirst/go-whosonfirst-iterate/v2/emitter.Emitter` interface for crawling
+// records in a directory one at a time, in lexical order. Unlike the `directory://` and `repo://` emitters, which
+// crawl directories concurrently, this means that everything emitted before a given record is known when that record
+// is emitted which is what allows progress to be recorded as a high-water mark.
+type OrderedEmitter struct {
+	emitter.Emitter
+	filters filters.Filters
+	repo    bool
+}
+
+// NewOrderedEmitter returns a new `OrderedEmitter` instance configured by 'uri' in the form of:
+//
+//	checkpoint-directory://?{PARAMETERS}
+//	checkpoint-repo://?{PARAMETERS}
+//
+// Where {PARAMETERS} are the same as those for the `directory://` and `repo://` emitters. As with the `repo://`
+// emitter, `checkpoint-repo://` walks the "data" directory of each URI.
+func NewOrderedEmitter(ctx context.Context, uri string) (emitter.Emitter, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	f, err := filters.NewQueryFiltersFromURI(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create filters from query, %w", err)
+	}
+
+	e := &OrderedEmitter{
+		filters: f,
+		repo:    u.Scheme == REPO_SCHEME,
+	}
+
+	return e, nil
+}
+
+// WalkURI walks the directory named 'uri', one file at a time in lexical order, and for each file (not excluded by
+// any filters) invokes 'index_cb'. The absolute path of the directory being walked is available to 'index_cb' using
+// the `RootFromContext` method.
+func (e *OrderedEmitter) WalkURI(ctx context.Context, index_cb emitter.EmitterCallbackFunc, uri string) error {
+
+	root, err := filepath.Abs(uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive absolute path for '%s', %w", uri, err)
+	}
+
+	if e.repo {
+		root = filepath.Join(root, "data")
+	}
+
+	ctx = context.WithValue(ctx, rootKey{}, root)
+
+	walk_cb := func(path string, d fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		fh, err := emitter.ReaderWithPath(ctx, path)
+
+		if err != nil {
+			return fmt.Errorf("Failed to create reader for '%s', %w", path, err)
+		}
+
+		defer fh.Close()
+
+		if e.filters != nil {
+
+			ok, err := e.filters.Apply(ctx, fh)
+
+			if err != nil {
+				return fmt.Errorf("Failed to apply filters for '%s', %w", path, err)
+			}
+
+			if !ok {
+				return nil
+			}
+
+			_, err = fh.Seek(0, 0)
+
+			if err != nil {
+				return fmt.Errorf("Failed to seek(0, 0) on reader for '%s', %w", path, err)
+			}
+		}
+
+		err = index_cb(ctx, path, fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to invoke callback for '%s', %w", path, err)
+		}
+
+		return nil
+	}
+
+	err = filepath.WalkDir(root, walk_cb)
+
+	if err != nil {
+		return fmt.Errorf("Failed to walk '%s', %w", root, err)
+	}
+
+	return nil
+}
+
+// RootFromContext returns the absolute path of the directory being walked by an `OrderedEmitter` and a boolean
+// value indicating whether 'ctx' was derived from an `OrderedEmitter`.
+func RootFromContext(ctx context.Context) (string, bool) {
+	root, ok := ctx.Value(rootKey{}).(string)
+	return root, ok
+}
+
+// OrderedIteratorURI returns the ordered equivalent of 'uri', a `whosonfirst/go-whosonfirst-iterate/v2` URI. Only
+// the `directory://` and `repo://` schemes have ordered equivalents.
+func OrderedIteratorURI(uri string) (string, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	var scheme string
+
+	switch u.Scheme {
+	case "directory", DIRECTORY_SCHEME:
+		scheme = DIRECTORY_SCHEME
+	case "repo", REPO_SCHEME:
+		scheme = REPO_SCHEME
+	default:
+		return "", fmt.Errorf("Checkpoints are only supported for directory:// and repo:// iterators, not %s://", u.Scheme)
+	}
+
+	return scheme + strings.TrimPrefix(uri, u.Scheme), nil
+}
@@ -0,0 +1,142 @@
+package checkpoint
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+)
+
+func TestOrderedIteratorURI(t *testing.T) {
+
+	tests := []struct {
+		uri      string
+		expected string
+		ok       bool
+	}{
+		{"directory://", "checkpoint-directory://", true},
+		{"repo://?include=properties.mz:is_current=1", "checkpoint-repo://?include=properties.mz:is_current=1", true},
+		{"checkpoint-repo://", "checkpoint-repo://", true},
+		{"git://", "", false},
+		{"featurecollection://", "", false},
+	}
+
+	for _, test := range tests {
+
+		uri, err := OrderedIteratorURI(test.uri)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.uri)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to derive ordered iterator URI for '%s', %v", test.uri, err)
+		}
+
+		if uri != test.expected {
+			t.Fatalf("Expected '%s' for '%s', got '%s'", test.expected, test.uri, uri)
+		}
+	}
+}
+
+func TestOrderedEmitterWalkURI(t *testing.T) {
+
+	ctx := context.Background()
+
+	repo := t.TempDir()
+
+	paths := []string{
+		"data/1010/1.geojson",
+		"data/101/736/545/101736545.geojson",
+		"data/101/736/545/101736545-alt-quattroshapes.geojson",
+		"data/85/922/583/85922583.geojson",
+		"data/101-alt.geojson",
+	}
+
+	for _, path := range paths {
+
+		abs_path := filepath.Join(repo, path)
+
+		err := os.MkdirAll(filepath.Dir(abs_path), 0755)
+
+		if err != nil {
+			t.Fatalf("Failed to create directory for %s, %v", path, err)
+		}
+
+		err = os.WriteFile(abs_path, []byte(`{"type":"Feature"}`), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+	}
+
+	e, err := emitter.NewEmitter(ctx, "checkpoint-repo://")
+
+	if err != nil {
+		t.Fatalf("Failed to create emitter, %v", err)
+	}
+
+	root := filepath.Join(repo, "data")
+	emitted := make([]string, 0)
+
+	cb := func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+		cb_root, ok := RootFromContext(ctx)
+
+		if !ok || cb_root != root {
+			t.Fatalf("Unexpected root for %s, %s", path, cb_root)
+		}
+
+		rel_path, err := filepath.Rel(root, path)
+
+		if err != nil {
+			t.Fatalf("Failed to derive relative path for %s, %v", path, err)
+		}
+
+		emitted = append(emitted, filepath.ToSlash(rel_path))
+		return nil
+	}
+
+	err = e.WalkURI(ctx, cb, repo)
+
+	if err != nil {
+		t.Fatalf("Failed to walk %s, %v", repo, err)
+	}
+
+	expected := []string{
+		"101/736/545/101736545-alt-quattroshapes.geojson",
+		"101/736/545/101736545.geojson",
+		"101-alt.geojson",
+		"1010/1.geojson",
+		"85/922/583/85922583.geojson",
+	}
+
+	if strings.Join(emitted, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Unexpected order: %v", emitted)
+	}
+
+	for i := 1; i < len(emitted); i++ {
+
+		if comparePaths(emitted[i-1], emitted[i]) >= 0 {
+			t.Fatalf("Expected %s to sort before %s", emitted[i-1], emitted[i])
+		}
+	}
+
+	cancel_ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	err = e.WalkURI(cancel_ctx, cb, repo)
+
+	if err == nil {
+		t.Fatalf("Expected walking with a cancelled context to fail")
+	}
+}
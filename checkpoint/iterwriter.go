@@ -0,0 +1,85 @@
+package checkpoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/sfomuseum/go-timings"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterwriter"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// CheckpointIterwriterCallback returns a `iterwriter.IterwriterCallbackFunc` that records the progress of records
+// emitted by an `OrderedEmitter` in 'c' and passes them to the callback function returned by 'cb_func'. If 'resume'
+// is true records at or below the high-water mark committed for their root are skipped. Once the batch size for 'c'
+// has been reached the writer is flushed which, for a `CheckpointWriter`, commits the checkpoints.
+func CheckpointIterwriterCallback(c *Checkpoints, resume bool, cb_func iterwriter.IterwriterCallbackFunc) iterwriter.IterwriterCallbackFunc {
+
+	fn := func(wr writer.Writer, monitor timings.Monitor) emitter.EmitterCallbackFunc {
+
+		iter_cb := cb_func(wr, monitor)
+
+		checkpoint_cb := func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+			root, ok := RootFromContext(ctx)
+
+			if !ok {
+				return fmt.Errorf("Unable to determine checkpoint root for %s, records must be emitted by a %s:// or %s:// iterator", path, DIRECTORY_SCHEME, REPO_SCHEME)
+			}
+
+			rel_path, err := filepath.Rel(root, path)
+
+			if err != nil {
+				return fmt.Errorf("Unable to derive path for %s relative to %s, %w", path, root, err)
+			}
+
+			rel_path = filepath.ToSlash(rel_path)
+
+			if resume {
+
+				completed, err := c.Completed(ctx, root, rel_path)
+
+				if err != nil {
+					return fmt.Errorf("Failed to determine checkpoint for %s, %w", rel_path, err)
+				}
+
+				if completed {
+					slog.Debug("Skipping record that has already been indexed", "path", path, "rel_path", rel_path)
+					go monitor.Signal(ctx)
+					return nil
+				}
+			}
+
+			p, err := c.Add(root, rel_path)
+
+			if err != nil {
+				return fmt.Errorf("Failed to add checkpoint for %s, %w", path, err)
+			}
+
+			err = iter_cb(ctx, path, r, args...)
+
+			if err != nil {
+				return err
+			}
+
+			if c.Complete(p) {
+
+				err := wr.Flush(ctx)
+
+				if err != nil {
+					slog.Error("Failed to commit checkpoints", "error", err)
+				}
+			}
+
+			return nil
+		}
+
+		return checkpoint_cb
+	}
+
+	return fn
+}
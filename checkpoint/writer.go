@@ -0,0 +1,85 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// CheckpointWriter implements the `whosonfirst/go-writer/v3.Writer` interface committing the checkpoints recorded
+// in a `Checkpoints` instance whenever another writer is flushed or closed. Since writers may defer (for example,
+// using worker goroutines) writing records, checkpoints are only committed after the underlying writer has been
+// flushed successfully. If flushing fails checkpoints stop advancing for the remainder of the import which means
+// that any records after the last committed checkpoint will be written again when an import is resumed.
+type CheckpointWriter struct {
+	writer.Writer
+	writer      writer.Writer
+	checkpoints *Checkpoints
+}
+
+// NewCheckpointWriter returns a new `CheckpointWriter` instance committing the checkpoints in 'c' when 'wr' is flushed.
+func NewCheckpointWriter(ctx context.Context, wr writer.Writer, c *Checkpoints) (writer.Writer, error) {
+
+	cp_wr := &CheckpointWriter{
+		writer:      wr,
+		checkpoints: c,
+	}
+
+	return cp_wr, nil
+}
+
+// Write writes 'r' to 'path' using the underlying writer.
+func (wr *CheckpointWriter) Write(ctx context.Context, path string, r io.ReadSeeker) (int64, error) {
+	return wr.writer.Write(ctx, path, r)
+}
+
+// WriterURI returns the value of the underlying writer's `WriterURI` method.
+func (wr *CheckpointWriter) WriterURI(ctx context.Context, uri string) string {
+	return wr.writer.WriterURI(ctx, uri)
+}
+
+// Flush flushes the underlying writer and commits the checkpoints for the records completed before it was flushed.
+func (wr *CheckpointWriter) Flush(ctx context.Context) error {
+	return wr.commit(ctx)
+}
+
+// Close flushes the underlying writer, commits any checkpoints and then closes the underlying writer.
+func (wr *CheckpointWriter) Close(ctx context.Context) error {
+
+	commit_err := wr.commit(ctx)
+	close_err := wr.writer.Close(ctx)
+
+	return errors.Join(commit_err, close_err)
+}
+
+// SetLogger assigns 'logger' to the underlying writer.
+func (wr *CheckpointWriter) SetLogger(ctx context.Context, logger *log.Logger) error {
+	return wr.writer.SetLogger(ctx, logger)
+}
+
+// commit flushes the underlying writer and then records the high-water marks derived from the records that were
+// completed before it was flushed. Records completed while the writer is being flushed are left for the next commit
+// since they may not have been written yet.
+func (wr *CheckpointWriter) commit(ctx context.Context) error {
+
+	marks := wr.checkpoints.take()
+
+	err := wr.writer.Flush(ctx)
+
+	if err != nil {
+		wr.checkpoints.freeze()
+		return fmt.Errorf("Failed to flush writer, checkpoints will no longer advance, %w", err)
+	}
+
+	err = wr.checkpoints.record(ctx, marks)
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit checkpoints, %w", err)
+	}
+
+	return nil
+}
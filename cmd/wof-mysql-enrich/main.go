@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/paulmach/orb"
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+	"github.com/sfomuseum/runtimevar"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/enrich"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+const FORMAT_CSV string = "csv"
+
+const FORMAT_GEOJSONL string = "geojsonl"
+
+func main() {
+
+	var placetypes multi.MultiString
+
+	fs := flagset.NewFlagSet("enrich")
+
+	database_uri := fs.String("database-uri", "", "A valid mysql://?dsn={DSN} URI, encoded as a gocloud.dev/runtimevar URI.")
+	format := fs.String("format", FORMAT_CSV, "The format of the input data. Valid options are: csv, geojsonl.")
+	input := fs.String("input", "-", "The path to the input data. If \"-\" data is read from STDIN.")
+	output := fs.String("output", "-", "The path to write enriched data to. If \"-\" data is written to STDOUT.")
+	fs.Var(&placetypes, "placetype", "One or more placetypes to resolve for each point. If empty the default placetypes (neighbourhood, locality, region, country) are used.")
+	latitude_column := fs.String("latitude-column", "latitude", "The name of the CSV column containing latitudes.")
+	longitude_column := fs.String("longitude-column", "longitude", "The name of the CSV column containing longitudes.")
+	workers := fs.Int("workers", 0, "The maximum number of points to resolve concurrently. If 0 the number of CPUs is used.")
+	batch_size := fs.Int("batch-size", 1000, "The number of rows to read before resolving their points.")
+	cache_size := fs.Int("cache-size", enrich.DEFAULT_CACHE_SIZE, "The maximum number of grid cells, and of polygons, to cache. If 0 nothing is cached.")
+	cell_size := fs.Float64("cell-size", enrich.DEFAULT_CELL_SIZE, "The width and height, in degrees, of the grid cells used to cache polygons.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Append the IDs and names of the Who's On First records that contain each point in a CSV or GeoJSONL file.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "CSV rows are appended with wof_{PLACETYPE}_id and wof_{PLACETYPE}_name columns. GeoJSONL features are assigned enrich:{PLACETYPE}_id and enrich:{PLACETYPE}_name properties.\n")
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	if *batch_size < 1 {
+		log.Fatalf("Invalid -batch-size flag, must be a positive integer")
+	}
+
+	db_uri, err := runtimevar.StringVar(ctx, *database_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive database URI, %v", err)
+	}
+
+	spatial_db, err := spatial.NewMySQLSpatialDatabase(ctx, strings.TrimSpace(db_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer spatial_db.Disconnect(ctx)
+
+	opts, err := enrich.DefaultEnricherOptions()
+
+	if err != nil {
+		log.Fatalf("Failed to create enricher options, %v", err)
+	}
+
+	if len(placetypes) > 0 {
+		opts.Placetypes = placetypes
+	}
+
+	if *workers > 0 {
+		opts.Workers = *workers
+	}
+
+	opts.CacheSize = *cache_size
+	opts.CellSize = *cell_size
+
+	enricher, err := enrich.NewEnricherWithOptions(ctx, spatial_db, opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create enricher, %v", err)
+	}
+
+	var r io.Reader
+	var wr io.Writer
+
+	switch *input {
+	case "-":
+		r = os.Stdin
+	default:
+
+		fh, err := os.Open(*input)
+
+		if err != nil {
+			log.Fatalf("Failed to open %s, %v", *input, err)
+		}
+
+		defer fh.Close()
+		r = fh
+	}
+
+	switch *output {
+	case "-":
+		wr = os.Stdout
+	default:
+
+		fh, err := os.Create(*output)
+
+		if err != nil {
+			log.Fatalf("Failed to create %s, %v", *output, err)
+		}
+
+		defer fh.Close()
+		wr = fh
+	}
+
+	switch *format {
+	case FORMAT_CSV:
+		err = enrichCSV(ctx, enricher, opts.Placetypes, r, wr, *latitude_column, *longitude_column, *batch_size)
+	case FORMAT_GEOJSONL:
+		err = enrichGeoJSONL(ctx, enricher, opts.Placetypes, r, wr, *batch_size)
+	default:
+		err = fmt.Errorf("Invalid or unsupported format '%s'", *format)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to enrich %s, %v", *input, err)
+	}
+}
+
+// enrichCSV reads CSV rows from 'r', in batches of 'batch_size', and writes each row to 'wr' with the ID and name of the
+// record, for each of 'placetypes', that contains the point defined by its 'lat_col' and 'lon_col' columns.
+func enrichCSV(ctx context.Context, enricher *enrich.Enricher, placetypes []string, r io.Reader, wr io.Writer, lat_col string, lon_col string, batch_size int) error {
+
+	csv_r := csv.NewReader(r)
+	csv_wr := csv.NewWriter(wr)
+
+	header, err := csv_r.Read()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read header, %w", err)
+	}
+
+	lat_idx := slices.Index(header, lat_col)
+	lon_idx := slices.Index(header, lon_col)
+
+	if lat_idx == -1 {
+		return fmt.Errorf("Missing latitude column '%s'", lat_col)
+	}
+
+	if lon_idx == -1 {
+		return fmt.Errorf("Missing longitude column '%s'", lon_col)
+	}
+
+	for _, pt := range placetypes {
+		header = append(header, fmt.Sprintf("wof_%s_id", pt), fmt.Sprintf("wof_%s_name", pt))
+	}
+
+	err = csv_wr.Write(header)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write header, %w", err)
+	}
+
+	row_num := 1
+
+	rows := make([][]string, 0)
+	points := make([]orb.Point, 0)
+
+	flush := func() error {
+
+		results, err := enricher.EnrichBatch(ctx, points)
+
+		if err != nil {
+			return err
+		}
+
+		for idx, row := range rows {
+
+			for _, pt := range placetypes {
+
+				m, ok := results[idx][pt]
+
+				if !ok {
+					row = append(row, "", "")
+					continue
+				}
+
+				row = append(row, strconv.FormatInt(m.Id, 10), m.Name)
+			}
+
+			err := csv_wr.Write(row)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write row, %w", err)
+			}
+		}
+
+		csv_wr.Flush()
+
+		rows = rows[:0]
+		points = points[:0]
+
+		return csv_wr.Error()
+	}
+
+	for {
+
+		row, err := csv_r.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to read row %d, %w", row_num, err)
+		}
+
+		row_num += 1
+
+		lat, err := strconv.ParseFloat(row[lat_idx], 64)
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse latitude for row %d, %w", row_num, err)
+		}
+
+		lon, err := strconv.ParseFloat(row[lon_idx], 64)
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse longitude for row %d, %w", row_num, err)
+		}
+
+		rows = append(rows, row)
+		points = append(points, orb.Point{lon, lat})
+
+		if len(rows) >= batch_size {
+
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
+
+// enrichGeoJSONL reads GeoJSON features, one per line, from 'r', in batches of 'batch_size', and writes each feature to
+// 'wr' with the ID and name of the record, for each of 'placetypes', that contains its point geometry or, if it is not
+// a point, its centroid.
+func enrichGeoJSONL(ctx context.Context, enricher *enrich.Enricher, placetypes []string, r io.Reader, wr io.Writer, batch_size int) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+
+	buf_wr := bufio.NewWriter(wr)
+
+	line_num := 0
+
+	features := make([][]byte, 0)
+	points := make([]orb.Point, 0)
+
+	flush := func() error {
+
+		results, err := enricher.EnrichBatch(ctx, points)
+
+		if err != nil {
+			return err
+		}
+
+		for idx, body := range features {
+
+			for _, pt := range placetypes {
+
+				m, ok := results[idx][pt]
+
+				if !ok {
+					continue
+				}
+
+				to_set := map[string]interface{}{
+					fmt.Sprintf("properties.enrich:%s_id", pt):   m.Id,
+					fmt.Sprintf("properties.enrich:%s_name", pt): m.Name,
+				}
+
+				for path, v := range to_set {
+
+					body, err = sjson.SetBytes(body, path, v)
+
+					if err != nil {
+						return fmt.Errorf("Failed to set %s, %w", path, err)
+					}
+				}
+			}
+
+			_, err := buf_wr.Write(body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write feature, %w", err)
+			}
+
+			_, err = buf_wr.WriteString("\n")
+
+			if err != nil {
+				return fmt.Errorf("Failed to write feature, %w", err)
+			}
+		}
+
+		features = features[:0]
+		points = points[:0]
+
+		return buf_wr.Flush()
+	}
+
+	for scanner.Scan() {
+
+		line_num += 1
+
+		line := scanner.Bytes()
+
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		body := slices.Clone(line)
+
+		pt, err := featurePoint(body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive point for line %d, %w", line_num, err)
+		}
+
+		features = append(features, body)
+		points = append(points, *pt)
+
+		if len(features) >= batch_size {
+
+			err := flush()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := scanner.Err()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read line %d, %w", line_num+1, err)
+	}
+
+	return flush()
+}
+
+// featurePoint returns the coordinates of 'body' if its geometry is a point, or its centroid otherwise.
+func featurePoint(body []byte) (*orb.Point, error) {
+
+	if gjson.GetBytes(body, "geometry.type").String() == "Point" {
+
+		coords := gjson.GetBytes(body, "geometry.coordinates").Array()
+
+		if len(coords) < 2 {
+			return nil, fmt.Errorf("Invalid point coordinates")
+		}
+
+		return &orb.Point{coords[0].Float(), coords[1].Float()}, nil
+	}
+
+	pt, _, err := properties.Centroid(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive centroid, %w", err)
+	}
+
+	return pt, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+	"github.com/sfomuseum/runtimevar"
+	wof_emitter "github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+	"github.com/whosonfirst/go-whosonfirst-mysql/emitter"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// The format for exporting records as individual files in a Who's On First repository layout.
+const FORMAT_REPO string = "repo"
+
+// The format for exporting records as a single GeoJSON FeatureCollection.
+const FORMAT_FEATURECOLLECTION string = "featurecollection"
+
+// The format for exporting records as newline-delimited GeoJSON.
+const FORMAT_GEOJSONL string = "geojsonl"
+
+func main() {
+
+	fs := flagset.NewFlagSet("export")
+
+	database_uri := fs.String("database-uri", "", "A valid mysql://?dsn={DSN} URI, encoded as a gocloud.dev/runtimevar URI.")
+	format := fs.String("format", FORMAT_GEOJSONL, "The format to export records in. Valid options are: repo, featurecollection, geojsonl.")
+	output := fs.String("output", "-", "Where to export records. If -format is \"repo\" this is the root directory of the repository (records will be written to its \"data\" directory). Otherwise it is a path to a file, or \"-\" for STDOUT.")
+
+	var placetypes multi.MultiString
+	fs.Var(&placetypes, "placetype", "Zero or more placetypes to export.")
+
+	var repos multi.MultiString
+	fs.Var(&repos, "repo", "Zero or more wof:repo values to export.")
+
+	is_current := fs.String("is-current", "", "If not empty, export records whose mz:is_current property is (true) or is not (false) 1.")
+	lastmod_min := fs.Int64("lastmodified-min", 0, "If greater than zero, export records last modified at or after this Unix timestamp.")
+	lastmod_max := fs.Int64("lastmodified-max", 0, "If greater than zero, export records last modified at or before this Unix timestamp.")
+	include_alt := fs.Bool("alt", true, "Export alternate geometries.")
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	db_uri, err := runtimevar.StringVar(ctx, *database_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive database URI, %v", err)
+	}
+
+	db_u, err := url.Parse(strings.TrimSpace(db_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to parse database URI, %v", err)
+	}
+
+	dsn := db_u.Query().Get("dsn")
+
+	if dsn == "" {
+		log.Fatalf("Database URI is missing ?dsn= parameter")
+	}
+
+	q := url.Values{}
+	q.Set("dsn", dsn)
+
+	for _, pt := range placetypes {
+		q.Add("placetype", pt)
+	}
+
+	for _, r := range repos {
+		q.Add("repo", r)
+	}
+
+	if *is_current != "" {
+		q.Set("is-current", *is_current)
+	}
+
+	if *lastmod_min > 0 {
+		q.Set("lastmodified-min", strconv.FormatInt(*lastmod_min, 10))
+	}
+
+	if *lastmod_max > 0 {
+		q.Set("lastmodified-max", strconv.FormatInt(*lastmod_max, 10))
+	}
+
+	q.Set("alt", strconv.FormatBool(*include_alt))
+
+	em_uri := url.URL{}
+	em_uri.Scheme = "mysql"
+	em_uri.RawQuery = q.Encode()
+
+	em, err := emitter.NewMySQLEmitter(ctx, em_uri.String())
+
+	if err != nil {
+		log.Fatalf("Failed to create emitter, %v", err)
+	}
+
+	var export_cb wof_emitter.EmitterCallbackFunc
+	var finalize func() error
+
+	count := 0
+
+	switch *format {
+	case FORMAT_REPO:
+
+		root, err := filepath.Abs(*output)
+
+		if err != nil {
+			log.Fatalf("Failed to derive absolute path for %s, %v", *output, err)
+		}
+
+		wr, err := writer.NewWriter(ctx, fmt.Sprintf("repo://%s", root))
+
+		if err != nil {
+			log.Fatalf("Failed to create writer, %v", err)
+		}
+
+		export_cb = func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+			_, err := wr.Write(ctx, path, r)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write %s, %w", path, err)
+			}
+
+			count += 1
+			return nil
+		}
+
+		finalize = func() error {
+			return wr.Close(ctx)
+		}
+
+	case FORMAT_FEATURECOLLECTION, FORMAT_GEOJSONL:
+
+		out, close_out, err := openOutput(*output)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		buf := bufio.NewWriter(out)
+
+		if *format == FORMAT_FEATURECOLLECTION {
+
+			_, err := buf.WriteString(`{"type":"FeatureCollection","features":[`)
+
+			if err != nil {
+				log.Fatalf("Failed to write FeatureCollection header, %v", err)
+			}
+		}
+
+		export_cb = func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+			body, err := io.ReadAll(r)
+
+			if err != nil {
+				return fmt.Errorf("Failed to read %s, %w", path, err)
+			}
+
+			var compact bytes.Buffer
+
+			err = json.Compact(&compact, body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to compact %s, %w", path, err)
+			}
+
+			if *format == FORMAT_FEATURECOLLECTION && count > 0 {
+				buf.WriteString(",")
+			}
+
+			_, err = buf.Write(compact.Bytes())
+
+			if err != nil {
+				return fmt.Errorf("Failed to write %s, %w", path, err)
+			}
+
+			if *format == FORMAT_GEOJSONL {
+				buf.WriteString("\n")
+			}
+
+			count += 1
+			return nil
+		}
+
+		finalize = func() error {
+
+			if *format == FORMAT_FEATURECOLLECTION {
+
+				_, err := buf.WriteString("]}")
+
+				if err != nil {
+					return fmt.Errorf("Failed to write FeatureCollection footer, %w", err)
+				}
+			}
+
+			err := buf.Flush()
+
+			if err != nil {
+				return fmt.Errorf("Failed to flush output, %w", err)
+			}
+
+			return close_out()
+		}
+
+	default:
+		log.Fatalf("Invalid or unsupported format '%s'", *format)
+	}
+
+	err = em.WalkURI(ctx, export_cb, "*")
+
+	if err != nil {
+		log.Fatalf("Failed to export records, %v", err)
+	}
+
+	err = finalize()
+
+	if err != nil {
+		log.Fatalf("Failed to finalize export, %v", err)
+	}
+
+	log.Printf("Exported %d records", count)
+}
+
+// openOutput returns an `io.Writer` for 'path' and a function to close it. If 'path' is "-" STDOUT is returned.
+func openOutput(path string) (io.Writer, func() error, error) {
+
+	if path == "-" {
+
+		close_func := func() error {
+			return nil
+		}
+
+		return os.Stdout, close_func, nil
+	}
+
+	fh, err := os.Create(path)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create %s, %w", path, err)
+	}
+
+	return fh, fh.Close, nil
+}
@@ -2,25 +2,195 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"log"
 	"log/slog"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/whosonfirst/go-whosonfirst-iterate-git/v2"
+	_ "github.com/whosonfirst/go-whosonfirst-mysql/emitter"
 	_ "github.com/whosonfirst/go-whosonfirst-mysql/writer"
-	
+
+	"github.com/sfomuseum/go-flags/multi"
+	"github.com/sfomuseum/runtimevar"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
 	"github.com/whosonfirst/go-whosonfirst-iterwriter/app/iterwriter"
+	"github.com/whosonfirst/go-whosonfirst-mysql/checkpoint"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	"github.com/whosonfirst/go-writer/v3"
 )
 
 func main() {
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	logger := slog.Default()
 
-	err := iterwriter.Run(ctx, logger)
+	fs := iterwriter.DefaultFlagSet()
+
+	metrics_address := fs.String("metrics-address", "", "If not empty, the address (for example \":9100\") of a HTTP server that will expose indexing metrics in the Prometheus exposition format from the /metrics endpoint.")
+
+	tracing_uri := fs.String("tracing-uri", "", "If not empty, a URI used to configure an OpenTelemetry exporter for indexing spans. Valid options are: stdout://, stderr:// and otlp://{HOST}:{PORT}.")
+
+	checkpoint_database_uri := fs.String("checkpoint-database-uri", "", "If not empty, a valid whosonfirst/go-whosonfirst-database-sql URI (for example \"mysql://?dsn={DSN}\"), encoded as a gocloud.dev/runtimevar URI, for the database where import progress will be recorded.")
+	checkpoint_source := fs.String("checkpoint-source", "", "The name used to identify checkpoints for this import. If empty a value derived from the -iterator-uri flag and the paths to iterate will be used.")
+	resume := fs.Bool("resume", false, "Skip records that have already been recorded as indexed in the checkpoints table. Requires the -checkpoint-database-uri flag.")
+
+	opts, err := iterwriter.DefaultOptionsFromFlagSet(fs, false)
+
+	if err != nil {
+		log.Fatalf("Failed to derive options from flags, %v", err)
+	}
+
+	if *metrics_address != "" {
+
+		go func() {
+
+			err := metrics.ListenAndServe(ctx, *metrics_address)
+
+			if err != nil {
+				logger.Error("Failed to serve metrics", "error", err)
+			}
+		}()
+	}
+
+	if *tracing_uri != "" {
+
+		shutdown, err := tracing.SetupTracerProvider(ctx, *tracing_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to set up tracing, %v", err)
+		}
+
+		defer func() {
+
+			err := shutdown(context.Background())
+
+			if err != nil {
+				logger.Error("Failed to shut down tracing", "error", err)
+			}
+		}()
+	}
+
+	if *resume && *checkpoint_database_uri == "" {
+		log.Fatalf("The -resume flag requires that the -checkpoint-database-uri flag be set")
+	}
+
+	if *checkpoint_database_uri != "" {
+
+		db_uri, err := runtimevar.StringVar(ctx, *checkpoint_database_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to derive checkpoint database URI, %v", err)
+		}
+
+		db, err := wof_sql.NewSQLDB(ctx, strings.TrimSpace(db_uri))
+
+		if err != nil {
+			log.Fatalf("Failed to create checkpoint database, %v", err)
+		}
+
+		defer db.Close()
+
+		source := *checkpoint_source
+
+		if source == "" {
+			source = deriveCheckpointSource(opts.IteratorURI, opts.IteratorPaths)
+		}
+
+		cp, err := checkpoint.NewCheckpoints(ctx, db, source)
+
+		if err != nil {
+			log.Fatalf("Failed to create checkpoints, %v", err)
+		}
+
+		iterator_uri, err := checkpoint.OrderedIteratorURI(opts.IteratorURI)
+
+		if err != nil {
+			log.Fatalf("Failed to derive ordered iterator URI, %v", err)
+		}
+
+		opts.IteratorURI = iterator_uri
+
+		if !*resume {
+
+			err := cp.Reset(ctx)
+
+			if err != nil {
+				log.Fatalf("Failed to reset checkpoints, %v", err)
+			}
+		}
+
+		opts.CallbackFunc = checkpoint.CheckpointIterwriterCallback(cp, *resume, opts.CallbackFunc)
+
+		wr, err := newWriter(ctx, fs.Lookup("writer-uri").Value.(*multi.MultiCSVString))
+
+		if err != nil {
+			log.Fatalf("Failed to create writer, %v", err)
+		}
+
+		cp_wr, err := checkpoint.NewCheckpointWriter(ctx, wr, cp)
+
+		if err != nil {
+			log.Fatalf("Failed to create checkpoint writer, %v", err)
+		}
+
+		opts.Writer = cp_wr
+
+		logger.Info("Recording checkpoints", "source", source, "resume", *resume)
+	}
+
+	err = iterwriter.RunWithOptions(ctx, opts, logger)
 
 	if err != nil {
 		log.Fatalf("Failed to iterate, %v", err)
 	}
 
 }
+
+// newWriter returns a new `writer.MultiWriter` instance for 'writer_uris' each of which is expected to be a gocloud.dev/runtimevar URI.
+// This mirrors the way the iterwriter package creates writers so that they can be wrapped before being passed to `iterwriter.RunWithOptions`.
+func newWriter(ctx context.Context, writer_uris *multi.MultiCSVString) (writer.Writer, error) {
+
+	writers := make([]writer.Writer, len(*writer_uris))
+
+	wr_ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	for idx, runtimevar_uri := range *writer_uris {
+
+		wr_uri, err := runtimevar.StringVar(wr_ctx, runtimevar_uri)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive writer URI for %s, %w", runtimevar_uri, err)
+		}
+
+		wr, err := writer.NewWriter(ctx, strings.TrimSpace(wr_uri))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create new writer for %s, %w", runtimevar_uri, err)
+		}
+
+		writers[idx] = wr
+	}
+
+	return writer.NewMultiWriter(ctx, writers...)
+}
+
+// deriveCheckpointSource returns a checkpoint source name derived from 'iterator_uri' and 'iterator_paths'. If the
+// combined value exceeds the maximum length for a checkpoint source its SHA-256 hash is returned instead.
+func deriveCheckpointSource(iterator_uri string, iterator_paths []string) string {
+
+	source := fmt.Sprintf("%s#%s", iterator_uri, strings.Join(iterator_paths, ","))
+
+	if len(source) > checkpoint.MAX_LENGTH {
+		source = fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+
+	return source
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("migrate-belongsto")
+
+	database_uri := fs.String("database-uri", "", "A valid whosonfirst/go-whosonfirst-database-sql mysql:// URI.")
+	batch_size := fs.Int("batch-size", 1000, "The number of records to add to the 'whosonfirst_belongsto' table in a single transaction.")
+	use_table := fs.Bool("table", false, "Populate the 'whosonfirst_belongsto' table even if the server supports multi-valued indexes.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Add a multi-valued index on the 'wof:belongsto' property to the 'whosonfirst' table or, for servers that do not support multi-valued indexes, populate the 'whosonfirst_belongsto' table from existing records.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	logger := log.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		logger.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	if *batch_size < 1 {
+		logger.Fatalf("Invalid -batch-size flag, must be a positive integer")
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, *database_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		logger.Fatalf("Failed to establish database connection, %v", err)
+	}
+
+	supported, err := tables.SupportsMultiValuedIndexes(ctx, conn)
+
+	if err != nil {
+		logger.Fatalf("Failed to determine whether server supports multi-valued indexes, %v", err)
+	}
+
+	if supported && !*use_table {
+
+		err := tables.EnsureBelongsToIndex(ctx, db)
+
+		if err != nil {
+			logger.Fatalf("Failed to ensure belongsto index, %v", err)
+		}
+
+		logger.Printf("Finished adding %s index to %s table", tables.BELONGSTO_INDEX_NAME, wof_tables.WHOSONFIRST_TABLE_NAME)
+		os.Exit(0)
+	}
+
+	t, err := tables.NewBelongsToTableWithDatabase(ctx, db)
+
+	if err != nil {
+		logger.Fatalf("Failed to create belongsto table, %v", err)
+	}
+
+	q_select := fmt.Sprintf(`SELECT id, JSON_EXTRACT(properties, '$."wof:belongsto"') FROM %s WHERE id > ? ORDER BY id LIMIT ?`, wof_tables.WHOSONFIRST_TABLE_NAME)
+
+	last_id := int64(-1)
+	populated := 0
+
+	for {
+
+		rows, err := conn.QueryContext(ctx, q_select, last_id, *batch_size)
+
+		if err != nil {
+			logger.Fatalf("Failed to query whosonfirst table, %v", err)
+		}
+
+		ids := make([]int64, 0)
+		bodies := make([][]byte, 0)
+
+		for rows.Next() {
+
+			var id int64
+			var belongsto sql.NullString
+
+			err := rows.Scan(&id, &belongsto)
+
+			if err != nil {
+				rows.Close()
+				logger.Fatalf("Failed to scan row, %v", err)
+			}
+
+			if !belongsto.Valid {
+				belongsto.String = "[]"
+			}
+
+			// The belongsto table only needs the "wof:id" and "wof:belongsto" properties so index a
+			// minimal feature rather than reading the full record from the "geojson" table.
+
+			body := fmt.Sprintf(`{"type":"Feature","properties":{"wof:id":%d,"wof:belongsto":%s}}`, id, belongsto.String)
+
+			ids = append(ids, id)
+			bodies = append(bodies, []byte(body))
+		}
+
+		err = rows.Close()
+
+		if err != nil {
+			logger.Fatalf("Failed to close rows, %v", err)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			logger.Fatalf("Failed to iterate rows, %v", err)
+		}
+
+		if len(ids) == 0 {
+			break
+		}
+
+		tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: tables.DEFAULT_ISOLATION_LEVEL})
+
+		if err != nil {
+			logger.Fatalf("Failed to create transaction, %v", err)
+		}
+
+		for idx, body := range bodies {
+
+			err := t.IndexFeature(ctx, tx, body)
+
+			if err != nil {
+				tx.Rollback()
+				logger.Fatalf("Failed to index %d, %v", ids[idx], err)
+			}
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			logger.Fatalf("Failed to commit transaction, %v", err)
+		}
+
+		populated += len(ids)
+		last_id = ids[len(ids)-1]
+
+		logger.Printf("Populated %s table for %d records", tables.BELONGSTO_TABLE_NAME, populated)
+	}
+
+	logger.Printf("Finished populating %s table for %d records", tables.BELONGSTO_TABLE_NAME, populated)
+	os.Exit(0)
+}
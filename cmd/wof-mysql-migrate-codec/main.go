@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// row is a single row in the "geojson" table.
+type row struct {
+	id    int64
+	alt   string
+	body  []byte
+	codec string
+	// The row's lastmodified value when it was read, used to guard against overwriting rows re-indexed since.
+	lastmodified int64
+}
+
+func main() {
+
+	fs := flagset.NewFlagSet("migrate-codec")
+
+	database_uri := fs.String("database-uri", "", "A valid whosonfirst/go-whosonfirst-database-sql mysql:// URI.")
+	str_codec := fs.String("codec", tables.CODEC_ZSTD, "The codec to convert bodies in the 'geojson' table to. Valid options are: none, gzip, zstd.")
+	batch_size := fs.Int("batch-size", 100, "The number of rows to convert in a single transaction.")
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	logger := log.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		logger.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	codec, err := tables.ParseCodec(*str_codec)
+
+	if err != nil {
+		logger.Fatalf("Invalid -codec flag, %v", err)
+	}
+
+	if *batch_size < 1 {
+		logger.Fatalf("Invalid -batch-size flag, must be a positive integer")
+	}
+
+	db, err := sql.NewSQLDB(ctx, *database_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	err = tables.EnsureCodecColumn(ctx, db)
+
+	if err != nil {
+		logger.Fatalf("Failed to ensure codec column, %v", err)
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		logger.Fatalf("Failed to establish database connection, %v", err)
+	}
+
+	// Rows are paged through using their (id, alt) unique key rather than OFFSET so that rows which have
+	// already been converted (and no longer match the codec != ? condition) don't shift the pages.
+
+	q_select := fmt.Sprintf(`SELECT id, alt, body, %s, lastmodified FROM %s WHERE %s != ? AND (id > ? OR (id = ? AND alt > ?)) ORDER BY id, alt LIMIT ?`,
+		tables.CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME, tables.CODEC_COLUMN)
+
+	// Rows are only updated if they haven't changed since they were read. Otherwise a row re-indexed (by a writer)
+	// while it is being converted would be overwritten with its previous body.
+
+	q_update := fmt.Sprintf(`UPDATE %s SET body = ?, %s = ? WHERE id = ? AND alt = ? AND lastmodified = ? AND %s = ?`,
+		wof_tables.GEOJSON_TABLE_NAME, tables.CODEC_COLUMN, tables.CODEC_COLUMN)
+
+	last_id := int64(-1)
+	last_alt := ""
+
+	converted := 0
+	changed := 0
+	bytes_before := 0
+	bytes_after := 0
+
+	for {
+
+		rows, err := conn.QueryContext(ctx, q_select, codec, last_id, last_id, last_alt, *batch_size)
+
+		if err != nil {
+			logger.Fatalf("Failed to query geojson table, %v", err)
+		}
+
+		batch := make([]*row, 0)
+
+		for rows.Next() {
+
+			r := new(row)
+
+			err := rows.Scan(&r.id, &r.alt, &r.body, &r.codec, &r.lastmodified)
+
+			if err != nil {
+				rows.Close()
+				logger.Fatalf("Failed to scan row, %v", err)
+			}
+
+			batch = append(batch, r)
+		}
+
+		err = rows.Close()
+
+		if err != nil {
+			logger.Fatalf("Failed to close rows, %v", err)
+		}
+
+		err = rows.Err()
+
+		if err != nil {
+			logger.Fatalf("Failed to iterate rows, %v", err)
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+
+		if err != nil {
+			logger.Fatalf("Failed to create transaction, %v", err)
+		}
+
+		for _, r := range batch {
+
+			decoded, err := tables.DecodeBody(r.codec, r.body)
+
+			if err != nil {
+				tx.Rollback()
+				logger.Fatalf("Failed to decode body for %d (%s), %v", r.id, r.alt, err)
+			}
+
+			encoded, err := tables.EncodeBody(codec, decoded)
+
+			if err != nil {
+				tx.Rollback()
+				logger.Fatalf("Failed to encode body for %d (%s), %v", r.id, r.alt, err)
+			}
+
+			rsp, err := tx.ExecContext(ctx, q_update, encoded, codec, r.id, r.alt, r.lastmodified, r.codec)
+
+			if err != nil {
+				tx.Rollback()
+				logger.Fatalf("Failed to update %d (%s), %v", r.id, r.alt, err)
+			}
+
+			count, err := rsp.RowsAffected()
+
+			if err != nil {
+				tx.Rollback()
+				logger.Fatalf("Failed to determine rows affected for %d (%s), %v", r.id, r.alt, err)
+			}
+
+			if count == 0 {
+				logger.Printf("Skipping %d (%s) which has changed since it was read", r.id, r.alt)
+				changed += 1
+				continue
+			}
+
+			converted += 1
+			bytes_before += len(r.body)
+			bytes_after += len(encoded)
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			logger.Fatalf("Failed to commit transaction, %v", err)
+		}
+
+		last := batch[len(batch)-1]
+		last_id = last.id
+		last_alt = last.alt
+
+		logger.Printf("Converted %d rows (%d bytes to %d bytes), skipped %d changed rows", converted, bytes_before, bytes_after, changed)
+	}
+
+	logger.Printf("Finished converting %d rows to '%s' codec", converted, *str_codec)
+	os.Exit(0)
+}
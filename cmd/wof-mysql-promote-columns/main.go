@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/go-flags/multi"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+func main() {
+
+	var str_columns multi.MultiString
+
+	fs := flagset.NewFlagSet("promote-columns")
+
+	database_uri := fs.String("database-uri", "", "A valid whosonfirst/go-whosonfirst-database-sql mysql:// URI.")
+	fs.Var(&str_columns, "column", "Zero or more columns to promote, in the form of {NAME},{PROPERTY},{TYPE}[,indexed][,stored].")
+	columns_config := fs.String("columns-config", "", "The path to a JSON file defining zero or more columns to promote.")
+	schema := fs.Bool("schema", false, "Print the schema for the 'whosonfirst' table, including promoted columns, and exit.")
+	dry_run := fs.Bool("dry-run", false, "Print the statements needed to add missing columns and indexes to the 'whosonfirst' table without executing them.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Add generated columns, derived from Who's On First properties, to the 'whosonfirst' table.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	logger := log.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		logger.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	columns := make([]*tables.PromotedColumn, 0)
+
+	if *columns_config != "" {
+
+		config_columns, err := tables.ReadPromotedColumns(*columns_config)
+
+		if err != nil {
+			logger.Fatalf("Failed to read columns config, %v", err)
+		}
+
+		columns = append(columns, config_columns...)
+	}
+
+	for _, str_column := range str_columns {
+
+		c, err := tables.ParsePromotedColumn(str_column)
+
+		if err != nil {
+			logger.Fatalf("Invalid -column flag, %v", err)
+		}
+
+		columns = append(columns, c)
+	}
+
+	opts, err := tables.DefaultWhosonfirstTableOptions()
+
+	if err != nil {
+		logger.Fatalf("Failed to create whosonfirst table options, %v", err)
+	}
+
+	opts.PromotedColumns = columns
+
+	t, err := tables.NewWhosonfirstTableWithOptions(ctx, opts)
+
+	if err != nil {
+		logger.Fatalf("Failed to create whosonfirst table, %v", err)
+	}
+
+	if *schema {
+		fmt.Println(t.Schema())
+		os.Exit(0)
+	}
+
+	if len(columns) == 0 {
+		logger.Fatalf("No columns to promote")
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, *database_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	statements, err := tables.PromotedColumnsMigration(ctx, db, columns)
+
+	if err != nil {
+		logger.Fatalf("Failed to determine migration, %v", err)
+	}
+
+	if *dry_run {
+
+		for _, q := range statements {
+			fmt.Printf("%s;\n", q)
+		}
+
+		os.Exit(0)
+	}
+
+	err = tables.EnsurePromotedColumns(ctx, db, columns)
+
+	if err != nil {
+		logger.Fatalf("Failed to promote columns, %v", err)
+	}
+
+	logger.Printf("Finished promoting columns (%d statements executed)", len(statements))
+	os.Exit(0)
+}
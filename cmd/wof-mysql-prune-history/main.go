@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("prune-history")
+
+	database_uri := fs.String("database-uri", "", "A valid whosonfirst/go-whosonfirst-database-sql mysql:// URI.")
+	max_age := fs.Duration("max-age", 0, "Remove versions that were replaced longer ago than this duration (for example \"2160h\"). If 0 versions are not removed because of their age.")
+	max_versions := fs.Int("max-versions", 0, "The maximum number of previous versions to keep for each record. If 0 the number of versions is not limited.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Remove previous versions of records from the 'geojson_history' table according to a retention policy.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	logger := log.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		logger.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	if *max_age < 0 || *max_versions < 0 {
+		logger.Fatalf("Invalid -max-age or -max-versions flag, values must not be negative")
+	}
+
+	if *max_age == 0 && *max_versions == 0 {
+		logger.Fatalf("Nothing to prune, one or both of -max-age and -max-versions must be set")
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, *database_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		logger.Fatalf("Failed to establish database connection, %v", err)
+	}
+
+	retention := &tables.HistoryRetention{
+		MaxAge:      *max_age,
+		MaxVersions: *max_versions,
+	}
+
+	t0 := time.Now()
+
+	removed, err := tables.PruneHistory(ctx, conn, retention)
+
+	if err != nil {
+		logger.Fatalf("Failed to prune %s table, %v", tables.HISTORY_TABLE_NAME, err)
+	}
+
+	logger.Printf("Finished pruning %s table, %d versions removed in %v", tables.HISTORY_TABLE_NAME, removed, time.Since(t0))
+	os.Exit(0)
+}
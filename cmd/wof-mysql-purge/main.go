@@ -10,6 +10,7 @@ import (
 	"github.com/sfomuseum/go-flags/flagset"
 	"github.com/whosonfirst/go-whosonfirst-database-sql"
 	"github.com/whosonfirst/go-whosonfirst-database-sql/prune"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
 	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
 )
 
@@ -26,9 +27,13 @@ func main() {
 	purge_whosonfirst := fs.Bool("whosonfirst", false, "Purge the 'whosonfirst' tables")
 	purge_all := fs.Bool("all", false, "Purge all the tables")
 
+	metrics_address := fs.String("metrics-address", "", "If not empty, the address (for example \":9100\") of a HTTP server that will expose database metrics in the Prometheus exposition format from the /metrics endpoint.")
+
 	flagset.Parse(fs)
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	logger := log.Default()
 
 	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
@@ -45,6 +50,32 @@ func main() {
 
 	defer db.Close()
 
+	if *metrics_address != "" {
+
+		conn, err := db.Conn()
+
+		if err != nil {
+			logger.Fatalf("Failed to establish database connection, %v", err)
+		}
+
+		unregister, err := metrics.RegisterDBStats("purge", conn)
+
+		if err != nil {
+			logger.Fatalf("Failed to register database metrics, %v", err)
+		}
+
+		defer unregister()
+
+		go func() {
+
+			err := metrics.ListenAndServe(ctx, *metrics_address)
+
+			if err != nil {
+				logger.Printf("Failed to serve metrics, %v", err)
+			}
+		}()
+	}
+
 	to_purge := make([]sql.Table, 0)
 
 	if *purge_geojson || *purge_all {
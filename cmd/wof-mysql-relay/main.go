@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/runtimevar"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/relay"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("relay")
+
+	database_uri := fs.String("database-uri", "", "A valid whosonfirst/go-whosonfirst-database-sql mysql:// URI, encoded as a gocloud.dev/runtimevar URI.")
+	writer_uri := fs.String("writer-uri", "stdout://", "A valid whosonfirst/go-writer/v3 URI. Each event is written as a line of JSON with the path \"{SEQ}.json\".")
+	name := fs.String("name", relay.DEFAULT_NAME, "The name used to record the last event delivered by the relay. Relays with different names deliver events independently of one another.")
+	batch_size := fs.Int("batch-size", 100, "The maximum number of events to deliver at a time.")
+	interval := fs.Duration("interval", 0, "The amount of time to wait before checking for new events. If 0 the default interval is used.")
+	gap_timeout := fs.Duration("gap-timeout", 0, "The amount of time to wait for a missing sequence number, which may belong to an uncommitted transaction, before skipping it. If 0 the default timeout is used.")
+	prune := fs.Bool("prune", false, "Remove events from the 'wof_changes' table once they have been delivered by every relay.")
+	once := fs.Bool("once", false, "Deliver the events that are currently available and exit.")
+	metrics_address := fs.String("metrics-address", "", "If not empty, the address (for example \":9100\") of a HTTP server that will expose relay metrics in the Prometheus exposition format from the /metrics endpoint.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Deliver the change events recorded in the 'wof_changes' table to a whosonfirst/go-writer/v3 writer.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := log.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		logger.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	db_uri, err := runtimevar.StringVar(ctx, *database_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to derive database URI, %v", err)
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, strings.TrimSpace(db_uri))
+
+	if err != nil {
+		logger.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	if *metrics_address != "" {
+
+		conn, err := db.Conn()
+
+		if err != nil {
+			logger.Fatalf("Failed to establish database connection, %v", err)
+		}
+
+		unregister, err := metrics.RegisterDBStats("relay", conn)
+
+		if err != nil {
+			logger.Fatalf("Failed to register database metrics, %v", err)
+		}
+
+		defer unregister()
+
+		go func() {
+
+			err := metrics.ListenAndServe(ctx, *metrics_address)
+
+			if err != nil {
+				logger.Printf("Failed to serve metrics, %v", err)
+			}
+		}()
+	}
+
+	wr, err := writer.NewWriter(ctx, *writer_uri)
+
+	if err != nil {
+		logger.Fatalf("Failed to create writer, %v", err)
+	}
+
+	defer wr.Close(ctx)
+
+	opts, err := relay.DefaultRelayOptions()
+
+	if err != nil {
+		logger.Fatalf("Failed to create relay options, %v", err)
+	}
+
+	opts.Name = *name
+	opts.BatchSize = *batch_size
+	opts.Prune = *prune
+
+	if *interval > 0 {
+		opts.Interval = *interval
+	}
+
+	if *gap_timeout > 0 {
+		opts.GapTimeout = *gap_timeout
+	}
+
+	r, err := relay.NewRelayWithOptions(ctx, db, wr, opts)
+
+	if err != nil {
+		logger.Fatalf("Failed to create relay, %v", err)
+	}
+
+	if !*once {
+
+		err := r.Run(ctx)
+
+		if err != nil {
+			logger.Fatalf("Failed to relay changes, %v", err)
+		}
+
+		return
+	}
+
+	for {
+
+		count, err := r.RelayOnce(ctx)
+
+		if err != nil {
+			logger.Fatalf("Failed to relay changes, %v", err)
+		}
+
+		if count < opts.BatchSize {
+			break
+		}
+	}
+}
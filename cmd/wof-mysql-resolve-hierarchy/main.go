@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/runtimevar"
+	"github.com/whosonfirst/go-whosonfirst-mysql/hierarchy"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("resolve-hierarchy")
+
+	database_uri := fs.String("database-uri", "", "A valid mysql://?dsn={DSN} URI, encoded as a gocloud.dev/runtimevar URI.")
+	tie_breaker := fs.String("tie-breaker", hierarchy.TIE_BREAKER_SMALLEST, "The strategy used to choose a parent when there is more than one candidate. Valid options are: first, smallest, fail.")
+	updates_only := fs.Bool("updates-only", false, "Write only the updated properties, rather than the updated record, to STDOUT.")
+	write_back := fs.Bool("write-back", false, "Index the updated record in the database.")
+	write_file := fs.Bool("write-file", false, "Overwrite each input file with the updated record.")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Resolve the parent and hierarchies of one or more Who's On First records using point-in-polygon queries against the 'whosonfirst' table.\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n\t %s [options] path(N) path(N)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "If path is \"-\" the record is read from STDIN.\n")
+		fs.PrintDefaults()
+	}
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	db_uri, err := runtimevar.StringVar(ctx, *database_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive database URI, %v", err)
+	}
+
+	spatial_db, err := spatial.NewMySQLSpatialDatabase(ctx, strings.TrimSpace(db_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer spatial_db.Disconnect(ctx)
+
+	opts, err := hierarchy.DefaultResolverOptions()
+
+	if err != nil {
+		log.Fatalf("Failed to create resolver options, %v", err)
+	}
+
+	opts.TieBreaker = *tie_breaker
+
+	resolver, err := hierarchy.NewResolverWithOptions(ctx, spatial_db, opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create resolver, %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for _, path := range fs.Args() {
+
+		body, err := readBody(path)
+
+		if err != nil {
+			log.Fatalf("Failed to read %s, %v", path, err)
+		}
+
+		updates, err := resolver.Resolve(ctx, body)
+
+		if err != nil {
+			log.Fatalf("Failed to resolve hierarchy for %s, %v", path, err)
+		}
+
+		if *updates_only {
+
+			err := enc.Encode(updates)
+
+			if err != nil {
+				log.Fatalf("Failed to write updates for %s, %v", path, err)
+			}
+		}
+
+		updated, err := hierarchy.Apply(body, updates)
+
+		if err != nil {
+			log.Fatalf("Failed to apply updates to %s, %v", path, err)
+		}
+
+		if *write_back {
+
+			err := spatial_db.IndexFeature(ctx, updated)
+
+			if err != nil {
+				log.Fatalf("Failed to index %s, %v", path, err)
+			}
+		}
+
+		if *write_file && path != "-" {
+
+			err := os.WriteFile(path, updated, 0644)
+
+			if err != nil {
+				log.Fatalf("Failed to write %s, %v", path, err)
+			}
+		}
+
+		if !*updates_only && !*write_file {
+
+			_, err := os.Stdout.Write(updated)
+
+			if err != nil {
+				log.Fatalf("Failed to write %s, %v", path, err)
+			}
+		}
+	}
+}
+
+// readBody returns the body of the record at 'path', or STDIN if 'path' is "-".
+func readBody(path string) ([]byte, error) {
+
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(path)
+}
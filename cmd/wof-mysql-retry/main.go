@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/runtimevar"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/iterator"
+	mysql_writer "github.com/whosonfirst/go-whosonfirst-mysql/writer"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("retry")
+
+	writer_uri := fs.String("writer-uri", "", "A valid whosonfirst/go-writer/v3 mysql:// URI, encoded as a gocloud.dev/runtimevar URI.")
+	iterator_uri := fs.String("iterator-uri", "directory://", "A valid whosonfirst/go-whosonfirst-iterate/v2 URI used to read records from a dead-letter location.")
+	remove := fs.Bool("remove", false, "Remove records, and their dead-letter sidecar files, once they have been successfully re-indexed. This assumes that records are being read from the local filesystem and that the writer URI does not enable workers (since worker errors are not reported until the writer is closed).")
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+	logger := slog.Default()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	wr_uri, err := runtimevar.StringVar(ctx, *writer_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive writer URI, %v", err)
+	}
+
+	wr, err := writer.NewWriter(ctx, strings.TrimSpace(wr_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to create writer, %v", err)
+	}
+
+	indexed := new(atomic.Int64)
+	failed := new(atomic.Int64)
+
+	iter_cb := func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+		if strings.HasSuffix(path, mysql_writer.DEAD_LETTER_SUFFIX) {
+			return nil
+		}
+
+		id, uri_args, err := uri.ParseURI(path)
+
+		if err != nil {
+			return fmt.Errorf("Unable to parse %s, %w", path, err)
+		}
+
+		rel_path, err := uri.Id2RelPath(id, uri_args)
+
+		if err != nil {
+			return fmt.Errorf("Unable to derive relative (WOF) path for %s, %w", path, err)
+		}
+
+		_, err = wr.Write(ctx, rel_path, r)
+
+		if err != nil {
+			logger.Error("Failed to re-index record", "path", path, "error", err)
+			failed.Add(1)
+			return nil
+		}
+
+		indexed.Add(1)
+
+		if *remove {
+
+			for _, p := range []string{path, mysql_writer.DeadLetterPath(path)} {
+
+				err := os.Remove(p)
+
+				if err != nil && !os.IsNotExist(err) {
+					logger.Warn("Failed to remove dead letter", "path", p, "error", err)
+				}
+			}
+		}
+
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, *iterator_uri, iter_cb)
+
+	if err != nil {
+		log.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	err = iter.IterateURIs(ctx, fs.Args()...)
+
+	if err != nil {
+		log.Fatalf("Failed to iterate dead letters, %v", err)
+	}
+
+	err = wr.Close(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to close writer, %v", err)
+	}
+
+	logger.Info("Finished re-indexing dead letters", "indexed", indexed.Load(), "failed", failed.Load())
+
+	if failed.Load() > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/runtimevar"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/api"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+func main() {
+
+	fs := flagset.NewFlagSet("server")
+
+	database_uri := fs.String("database-uri", "", "A valid mysql://?dsn={DSN} URI, encoded as a gocloud.dev/runtimevar URI.")
+	address := fs.String("address", "localhost:8080", "The address the HTTP server should listen for requests on.")
+
+	metrics_address := fs.String("metrics-address", "", "If not empty, the address (for example \":9100\") of a HTTP server that will expose database metrics in the Prometheus exposition format from the /metrics endpoint.")
+
+	flagset.Parse(fs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	db_uri, err := runtimevar.StringVar(ctx, *database_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive database URI, %v", err)
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, strings.TrimSpace(db_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to create database, %v", err)
+	}
+
+	defer db.Close()
+
+	if *metrics_address != "" {
+
+		conn, err := db.Conn()
+
+		if err != nil {
+			log.Fatalf("Failed to establish database connection, %v", err)
+		}
+
+		unregister, err := metrics.RegisterDBStats("server", conn)
+
+		if err != nil {
+			log.Fatalf("Failed to register database metrics, %v", err)
+		}
+
+		defer unregister()
+
+		go func() {
+
+			err := metrics.ListenAndServe(ctx, *metrics_address)
+
+			if err != nil {
+				slog.Error("Failed to serve metrics", "error", err)
+			}
+		}()
+	}
+
+	spatial_db, err := spatial.NewMySQLSpatialDatabaseWithDatabase(ctx, db)
+
+	if err != nil {
+		log.Fatalf("Failed to create spatial database, %v", err)
+	}
+
+	defer spatial_db.Disconnect(ctx)
+
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /id/{id}", api.IdHandler(spatial_db))
+	mux.Handle("GET /pip", api.PointInPolygonHandler(spatial_db))
+	mux.Handle("GET /search", api.SearchHandler(spatial_db))
+	mux.Handle("GET /descendants/{id}", api.DescendantsHandler(spatial_db))
+
+	server := &http.Server{
+		Addr:    *address,
+		Handler: mux,
+	}
+
+	go func() {
+
+		<-ctx.Done()
+
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdown_ctx)
+	}()
+
+	slog.Info("Listening for requests", "address", *address)
+
+	err = server.ListenAndServe()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Failed to serve requests, %v", err)
+	}
+}
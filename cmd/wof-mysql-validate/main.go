@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/whosonfirst/go-whosonfirst-iterate-git/v2"
+
+	"github.com/sfomuseum/go-flags/flagset"
+	"github.com/sfomuseum/runtimevar"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/iterator"
+	mysql_writer "github.com/whosonfirst/go-whosonfirst-mysql/writer"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"github.com/whosonfirst/go-writer/v3"
+)
+
+// Failure is a single line in the validation report.
+type Failure struct {
+	Path  string `json:"path"`
+	Table string `json:"table,omitempty"`
+	Error string `json:"error"`
+}
+
+func main() {
+
+	fs := flagset.NewFlagSet("validate")
+
+	writer_uri := fs.String("writer-uri", "", "A valid whosonfirst/go-writer/v3 mysql:// URI, encoded as a gocloud.dev/runtimevar URI. The URI will be updated to enable \"dry run\" mode and to disable workers.")
+	iterator_uri := fs.String("iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/v2 URI.")
+
+	flagset.Parse(fs)
+
+	ctx := context.Background()
+
+	err := flagset.SetFlagsFromEnvVars(fs, "WOF")
+
+	if err != nil {
+		log.Fatalf("Failed to set flags from environment variables, %v", err)
+	}
+
+	wr_uri, err := runtimevar.StringVar(ctx, *writer_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to derive writer URI, %v", err)
+	}
+
+	u, err := url.Parse(strings.TrimSpace(wr_uri))
+
+	if err != nil {
+		log.Fatalf("Failed to parse writer URI, %v", err)
+	}
+
+	q := u.Query()
+	q.Set("dry-run", "true")
+	q.Del("workers")
+	q.Del("dead-letter")
+
+	u.RawQuery = q.Encode()
+
+	wr, err := writer.NewWriter(ctx, u.String())
+
+	if err != nil {
+		log.Fatalf("Failed to create writer, %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	mu := new(sync.Mutex)
+
+	count := 0
+
+	report := func(f *Failure) {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		count += 1
+
+		err := enc.Encode(f)
+
+		if err != nil {
+			log.Printf("Failed to encode failure for %s, %v", f.Path, err)
+		}
+	}
+
+	iter_cb := func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+
+		id, uri_args, err := uri.ParseURI(path)
+
+		if err != nil {
+			report(&Failure{Path: path, Error: err.Error()})
+			return nil
+		}
+
+		rel_path, err := uri.Id2RelPath(id, uri_args)
+
+		if err != nil {
+			report(&Failure{Path: path, Error: err.Error()})
+			return nil
+		}
+
+		_, err = wr.Write(ctx, rel_path, r)
+
+		if err == nil {
+			return nil
+		}
+
+		reported := false
+
+		for _, e := range unwrapJoined(err) {
+
+			var v_err *mysql_writer.ValidationError
+
+			if errors.As(e, &v_err) {
+				report(&Failure{Path: v_err.Path, Table: v_err.Table, Error: v_err.Err.Error()})
+				reported = true
+			}
+		}
+
+		if !reported {
+			report(&Failure{Path: rel_path, Error: err.Error()})
+		}
+
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, *iterator_uri, iter_cb)
+
+	if err != nil {
+		log.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	err = iter.IterateURIs(ctx, fs.Args()...)
+
+	if err != nil {
+		log.Fatalf("Failed to iterate records, %v", err)
+	}
+
+	err = wr.Close(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to close writer, %v", err)
+	}
+
+	if count > 0 {
+		fmt.Fprintf(os.Stderr, "%d record(s) failed validation\n", count)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// unwrapJoined returns the list of errors wrapped by 'err' if it was created by `errors.Join` (or any other error
+// implementing `Unwrap() []error`), following single-error wrapping along the way. Otherwise it returns 'err'.
+func unwrapJoined(err error) []error {
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+
+		multi, ok := e.(interface{ Unwrap() []error })
+
+		if ok {
+			return multi.Unwrap()
+		}
+	}
+
+	return []error{err}
+}
@@ -0,0 +1,494 @@
+// Package emitter implements the whosonfirst/go-whosonfirst-iterate/v2 `Emitter` interface for records stored in the "geojson" table of a MySQL database.
+package emitter
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/whosonfirst/go-ioutil"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	wof_emitter "github.com/whosonfirst/go-whosonfirst-iterate/v2/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/v2/filters"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+func init() {
+	ctx := context.Background()
+	wof_emitter.RegisterEmitter(ctx, "mysql", NewMySQLEmitter)
+}
+
+// MySQLEmitter implements the `Emitter` interface for crawling records stored in the "geojson" table of a MySQL database.
+type MySQLEmitter struct {
+	wof_emitter.Emitter
+	// db_uri is the whosonfirst/go-whosonfirst-database-sql URI used to open a database for each call to `WalkURI`.
+	db_uri string
+	// query is the set of SQL filters applied to every call to `WalkURI`.
+	query url.Values
+	// filters is a `filters.Filters` instance used to include or exclude specific records from being crawled.
+	filters filters.Filters
+	// page_size is the maximum number of records read from the database at a time.
+	page_size int
+}
+
+// The default maximum number of records read from the database at a time by the `WalkURI` method.
+const DEFAULT_PAGE_SIZE int = 100
+
+// NewMySQLEmitter returns a new `MySQLEmitter` instance configured by 'uri' in the form of:
+//
+//	mysql://?dsn={DSN}&{PARAMETERS}
+//
+// Where {PARAMETERS} may be any of the SQL filters described in the documentation for `NewSelectStatement` as well as:
+// * `?page-size=` The maximum number of records read from the database at a time. Default is 100.
+// * `?include=` Zero or more `aaronland/go-json-query` query strings containing rules that must match for a document to be considered for further processing.
+// * `?exclude=` Zero or more `aaronland/go-json-query`	query strings containing rules that if matched will prevent a document from being considered for further processing.
+// * `?include_mode=` A valid `aaronland/go-json-query` query mode string for testing inclusion rules.
+// * `?exclude_mode=` A valid `aaronland/go-json-query` query mode string for testing exclusion rules.
+func NewMySQLEmitter(ctx context.Context, uri string) (wof_emitter.Emitter, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, fmt.Errorf("Missing ?dsn= parameter")
+	}
+
+	f, err := filters.NewQueryFiltersFromQuery(ctx, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create filters from query, %w", err)
+	}
+
+	page_size := DEFAULT_PAGE_SIZE
+
+	if q.Get("page-size") != "" {
+
+		v, err := strconv.Atoi(q.Get("page-size"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?page-size= parameter, %w", err)
+		}
+
+		if v < 1 {
+			return nil, fmt.Errorf("Invalid ?page-size= parameter, must be a positive integer")
+		}
+
+		page_size = v
+	}
+
+	db_uri := fmt.Sprintf("mysql://?dsn=%s", url.QueryEscape(dsn))
+
+	sql_q := url.Values{}
+
+	for _, k := range FILTER_PARAMETERS {
+
+		if q.Has(k) {
+			sql_q[k] = q[k]
+		}
+	}
+
+	_, _, err = NewSelectStatement(sql_q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &MySQLEmitter{
+		db_uri:    db_uri,
+		query:     sql_q,
+		filters:   f,
+		page_size: page_size,
+	}
+
+	return idx, nil
+}
+
+// WalkURI() queries the "geojson" table and for each matching record (not excluded by any filters specified when
+// `idx` was created) invokes 'index_cb' with the record's relative path and its (decompressed) body. 'uri' is an
+// optional URL-encoded query string (for example "placetype=locality&is-current=1") of SQL filters that are applied
+// in addition to those specified when `idx` was created. If 'uri' is "*" or empty only the latter are applied.
+// See the documentation for `NewSelectStatement` for the list of valid SQL filters. The database is opened when the
+// walk starts and closed when it completes. If 'ctx' is cancelled the walk stops and the context's error is returned.
+func (idx *MySQLEmitter) WalkURI(ctx context.Context, index_cb wof_emitter.EmitterCallbackFunc, uri string) error {
+
+	walk_q := url.Values{}
+
+	for k, v := range idx.query {
+		walk_q[k] = v
+	}
+
+	uri = strings.TrimPrefix(uri, "?")
+
+	if uri != "" && uri != "*" {
+
+		uri_q, err := url.ParseQuery(uri)
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse '%s', %w", uri, err)
+		}
+
+		for k, v := range uri_q {
+			walk_q[k] = v
+		}
+	}
+
+	// Ensure the filters are valid before querying the database
+	_, _, err := NewSelectStatement(walk_q)
+
+	if err != nil {
+		return err
+	}
+
+	db, err := wof_sql.NewSQLDB(ctx, idx.db_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create database, %w", err)
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	// Records are read a page at a time, ordered by their (id, alt) key, and each page is closed before
+	// any callbacks are invoked so that a slow callback does not hold a query (and its snapshot) open.
+
+	var after *pageKey
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		q, args, err := newPageStatement(walk_q, after, idx.page_size)
+
+		if err != nil {
+			return err
+		}
+
+		page, err := readPage(ctx, conn, q, args)
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range page {
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				// pass
+			}
+
+			err := idx.emit(ctx, index_cb, r)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(page) < idx.page_size {
+			return nil
+		}
+
+		last := page[len(page)-1]
+
+		after = &pageKey{
+			id:  last.id,
+			alt: last.alt,
+		}
+	}
+}
+
+// pageKey is the (id, alt) key of the last record in a page of results.
+type pageKey struct {
+	id  int64
+	alt string
+}
+
+// pageRecord is a row from the "geojson" table.
+type pageRecord struct {
+	id    int64
+	alt   string
+	body  []byte
+	codec string
+}
+
+// readPage executes 'q' and returns all the resulting rows, closing the result set before returning.
+func readPage(ctx context.Context, conn *sql.DB, q string, args []interface{}) ([]*pageRecord, error) {
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query database, %w", err)
+	}
+
+	defer rows.Close()
+
+	page := make([]*pageRecord, 0)
+
+	for rows.Next() {
+
+		r := new(pageRecord)
+
+		err := rows.Scan(&r.id, &r.alt, &r.body, &r.codec)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		page = append(page, r)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return page, nil
+}
+
+// emit applies any filters to 'r' and, if they match, invokes 'index_cb' with the record's relative path and (decompressed) body.
+func (idx *MySQLEmitter) emit(ctx context.Context, index_cb wof_emitter.EmitterCallbackFunc, r *pageRecord) error {
+
+	path, err := RelPath(r.id, r.alt)
+
+	if err != nil {
+		return err
+	}
+
+	body, err := tables.DecodeBody(r.codec, r.body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to decode body for '%s', %w", path, err)
+	}
+
+	fh, err := ioutil.NewReadSeekCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new ReadSeekCloser for '%s', %w", path, err)
+	}
+
+	if idx.filters != nil {
+
+		ok, err := idx.filters.Apply(ctx, fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to apply filters for '%s', %w", path, err)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		_, err = fh.Seek(0, 0)
+
+		if err != nil {
+			return fmt.Errorf("Failed to reset file handle for '%s', %w", path, err)
+		}
+	}
+
+	err = index_cb(ctx, path, fh)
+
+	if err != nil {
+		return fmt.Errorf("Index callback failed for '%s', %w", path, err)
+	}
+
+	return nil
+}
+
+// RelPath returns the Who's On First relative path for 'id' and 'alt', where 'alt' is the string representation
+// of an alternate geometry (as stored in the "geojson" table's "alt" column) or the empty string.
+func RelPath(id int64, alt string) (string, error) {
+
+	if alt == "" {
+		return uri.Id2RelPath(id)
+	}
+
+	uri_args, err := uri.NewAlternateURIArgsFromAltLabel(alt)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive URI arguments for %d (%s), %w", id, alt, err)
+	}
+
+	path, err := uri.Id2RelPath(id, uri_args)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to derive path for %d (%s), %w", id, alt, err)
+	}
+
+	return path, nil
+}
+
+// FILTER_PARAMETERS is the list of query parameters used to filter records in the "geojson" table.
+var FILTER_PARAMETERS = []string{
+	"placetype",
+	"is-current",
+	"lastmodified-min",
+	"lastmodified-max",
+	"repo",
+	"alt",
+}
+
+// NewSelectStatement returns the SQL query, and its arguments, for selecting the id, alt, body and codec columns of
+// the records in the "geojson" table matching 'q'. Valid filters are:
+// * `placetype=` One or more placetypes to match. Requires the "whosonfirst" table.
+// * `is-current=` Match records whose "mz:is_current" property is 1 (if true) or is not 1 (if false). Requires the "whosonfirst" table.
+// * `lastmodified-min=` Match records whose lastmodified time is greater than or equal to this Unix timestamp.
+// * `lastmodified-max=` Match records whose lastmodified time is less than or equal to this Unix timestamp.
+// * `repo=` One or more "wof:repo" values to match. Requires the "whosonfirst" table.
+// * `alt=` Whether to include alternate geometries. Default is true.
+func NewSelectStatement(q url.Values) (string, []interface{}, error) {
+	return newPageStatement(q, nil, 0)
+}
+
+// newPageStatement returns the SQL query, and its arguments, for selecting up to 'limit' of the records matching 'q'
+// whose (id, alt) key is greater than 'after'. If 'after' is nil records are selected from the start and if 'limit'
+// is less than one all the matching records are selected.
+func newPageStatement(q url.Values, after *pageKey, limit int) (string, []interface{}, error) {
+
+	for k := range q {
+
+		if !slices.Contains(FILTER_PARAMETERS, k) {
+			return "", nil, fmt.Errorf("Invalid or unsupported filter '%s'", k)
+		}
+	}
+
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	join_whosonfirst := false
+
+	placetypes := q["placetype"]
+
+	if len(placetypes) > 0 {
+
+		where = append(where, fmt.Sprintf("w.placetype IN (%s)", placeholders(len(placetypes))))
+
+		for _, pt := range placetypes {
+			args = append(args, pt)
+		}
+
+		join_whosonfirst = true
+	}
+
+	if q.Get("is-current") != "" {
+
+		is_current, err := strconv.ParseBool(q.Get("is-current"))
+
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to parse is-current filter, %w", err)
+		}
+
+		if is_current {
+			where = append(where, "w.is_current = 1")
+		} else {
+			where = append(where, "(w.is_current IS NULL OR w.is_current != 1)")
+		}
+
+		join_whosonfirst = true
+	}
+
+	if q.Get("lastmodified-min") != "" {
+
+		v, err := strconv.ParseInt(q.Get("lastmodified-min"), 10, 64)
+
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to parse lastmodified-min filter, %w", err)
+		}
+
+		where = append(where, "g.lastmodified >= ?")
+		args = append(args, v)
+	}
+
+	if q.Get("lastmodified-max") != "" {
+
+		v, err := strconv.ParseInt(q.Get("lastmodified-max"), 10, 64)
+
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to parse lastmodified-max filter, %w", err)
+		}
+
+		where = append(where, "g.lastmodified <= ?")
+		args = append(args, v)
+	}
+
+	repos := q["repo"]
+
+	if len(repos) > 0 {
+
+		where = append(where, fmt.Sprintf(`JSON_UNQUOTE(JSON_EXTRACT(w.properties, '$."wof:repo"')) IN (%s)`, placeholders(len(repos))))
+
+		for _, r := range repos {
+			args = append(args, r)
+		}
+
+		join_whosonfirst = true
+	}
+
+	if q.Get("alt") != "" {
+
+		include_alt, err := strconv.ParseBool(q.Get("alt"))
+
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to parse alt filter, %w", err)
+		}
+
+		if !include_alt {
+			where = append(where, "g.alt = ''")
+		}
+	}
+
+	if after != nil {
+		where = append(where, "(g.id > ? OR (g.id = ? AND g.alt > ?))")
+		args = append(args, after.id, after.id, after.alt)
+	}
+
+	sql := fmt.Sprintf("SELECT g.id, g.alt, g.body, g.%s FROM %s g", tables.CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME)
+
+	if join_whosonfirst {
+		sql = fmt.Sprintf("%s JOIN %s w ON w.id = g.id", sql, wof_tables.WHOSONFIRST_TABLE_NAME)
+	}
+
+	if len(where) > 0 {
+		sql = fmt.Sprintf("%s WHERE %s", sql, strings.Join(where, " AND "))
+	}
+
+	sql = fmt.Sprintf("%s ORDER BY g.id, g.alt", sql)
+
+	if limit > 0 {
+		sql = fmt.Sprintf("%s LIMIT %d", sql, limit)
+	}
+
+	return sql, args, nil
+}
+
+// placeholders returns a comma-separated list of 'count' "?" placeholders.
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", count), ",")
+}
@@ -0,0 +1,167 @@
+package emitter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestNewPageStatement(t *testing.T) {
+
+	tests := []struct {
+		query string
+		after *pageKey
+		limit int
+		sql   string
+		args  []interface{}
+	}{
+		{
+			query: "",
+			sql:   "SELECT g.id, g.alt, g.body, g.codec FROM geojson g ORDER BY g.id, g.alt",
+			args:  []interface{}{},
+		},
+		{
+			query: "",
+			limit: 10,
+			sql:   "SELECT g.id, g.alt, g.body, g.codec FROM geojson g ORDER BY g.id, g.alt LIMIT 10",
+			args:  []interface{}{},
+		},
+		{
+			query: "lastmodified-min=100",
+			after: &pageKey{id: 101736545, alt: "quattroshapes"},
+			limit: 10,
+			sql:   "SELECT g.id, g.alt, g.body, g.codec FROM geojson g WHERE g.lastmodified >= ? AND (g.id > ? OR (g.id = ? AND g.alt > ?)) ORDER BY g.id, g.alt LIMIT 10",
+			args:  []interface{}{int64(100), int64(101736545), int64(101736545), "quattroshapes"},
+		},
+		{
+			query: "placetype=locality&placetype=region&alt=false",
+			after: &pageKey{id: 1},
+			limit: 5,
+			sql:   "SELECT g.id, g.alt, g.body, g.codec FROM geojson g JOIN whosonfirst w ON w.id = g.id WHERE w.placetype IN (?,?) AND g.alt = '' AND (g.id > ? OR (g.id = ? AND g.alt > ?)) ORDER BY g.id, g.alt LIMIT 5",
+			args:  []interface{}{"locality", "region", int64(1), int64(1), ""},
+		},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", test.query, err)
+		}
+
+		sql, args, err := newPageStatement(q, test.after, test.limit)
+
+		if err != nil {
+			t.Fatalf("Failed to create statement for '%s', %v", test.query, err)
+		}
+
+		if sql != test.sql {
+			t.Fatalf("Unexpected SQL for '%s': %s", test.query, sql)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("Unexpected arguments for '%s': %v", test.query, args)
+		}
+	}
+}
+
+func TestNewSelectStatementInvalid(t *testing.T) {
+
+	tests := []string{
+		"page=2",
+		"is-current=maybe",
+		"lastmodified-min=yesterday",
+		"alt=sometimes",
+	}
+
+	for _, str_q := range tests {
+
+		q, err := url.ParseQuery(str_q)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", str_q, err)
+		}
+
+		_, _, err = NewSelectStatement(q)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", str_q)
+		}
+	}
+}
+
+func TestNewMySQLEmitter(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		uri string
+		ok  bool
+	}{
+		{"mysql://?dsn=user:pass@/wof&placetype=locality&page-size=10", true},
+		{"mysql://", false},
+		{"mysql://?dsn=user:pass@/wof&page-size=0", false},
+		{"mysql://?dsn=user:pass@/wof&is-current=maybe", false},
+	}
+
+	for _, test := range tests {
+
+		_, err := NewMySQLEmitter(ctx, test.uri)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for '%s', %v", test.uri, err)
+		}
+	}
+}
+
+func TestWalkURICancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	e, err := NewMySQLEmitter(ctx, "mysql://?dsn=user:pass@/wof")
+
+	if err != nil {
+		t.Fatalf("Failed to create emitter, %v", err)
+	}
+
+	cb := func(ctx context.Context, path string, r io.ReadSeeker, args ...interface{}) error {
+		t.Fatalf("Unexpected callback for %s", path)
+		return nil
+	}
+
+	err = e.WalkURI(ctx, cb, "*")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected walking with a cancelled context to return context.Canceled, got %v", err)
+	}
+}
+
+func TestRelPath(t *testing.T) {
+
+	tests := []struct {
+		id       int64
+		alt      string
+		expected string
+	}{
+		{101736545, "", "101/736/545/101736545.geojson"},
+		{101736545, "quattroshapes", "101/736/545/101736545-alt-quattroshapes.geojson"},
+	}
+
+	for _, test := range tests {
+
+		path, err := RelPath(test.id, test.alt)
+
+		if err != nil {
+			t.Fatalf("Failed to derive path for %d (%s), %v", test.id, test.alt, err)
+		}
+
+		if path != test.expected {
+			t.Fatalf("Unexpected path for %d (%s): %s", test.id, test.alt, path)
+		}
+	}
+}
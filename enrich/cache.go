@@ -0,0 +1,209 @@
+package enrich
+
+import (
+	"container/list"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// The amount, in degrees, that the bounding box of each grid cell is padded by when it is queried. This ensures that points
+// on the edge of a cell are inside its bounding box regardless of floating point rounding.
+const CELL_PADDING float64 = 1e-9
+
+// polygonCache is a least-recently-used cache of the candidate polygons for each cell of a fixed-size grid, keyed by
+// placetype, and of the geometries for those candidates. Because the candidates for a cell include every record whose
+// bounding box intersects it the candidates that may contain a point are always known once its cell has been cached, so
+// cached and uncached results are the same. The grid also acts as an index of the candidates' bounding boxes, so only the
+// candidates in a point's cell need to be considered. Candidates which are tiles of subdivided geometries carry their own
+// (small) geometries, which are cached with the cell rather than separately. The cache does not test whether geometries contain points so that
+// callers can do that without holding its lock.
+type polygonCache struct {
+	cell_size  float64
+	cells      *lruCache[cellKey, []*spatial.PointInPolygonCandidate]
+	geometries *lruCache[int64, orb.Geometry]
+	mu         *sync.Mutex
+}
+
+// cellKey identifies the cell of the grid, for a placetype, containing a point.
+type cellKey struct {
+	placetype string
+	x         int64
+	y         int64
+}
+
+// newPolygonCache returns a new `polygonCache` instance that will hold at most 'size' cells and 'size' geometries, for a grid
+// whose cells are 'cell_size' degrees wide and tall.
+func newPolygonCache(size int, cell_size float64) *polygonCache {
+
+	c := &polygonCache{
+		cell_size:  cell_size,
+		cells:      newLRUCache[cellKey, []*spatial.PointInPolygonCandidate](size),
+		geometries: newLRUCache[int64, orb.Geometry](size),
+		mu:         new(sync.Mutex),
+	}
+
+	return c
+}
+
+// Enabled returns a boolean value indicating whether the cache stores any cells or geometries.
+func (c *polygonCache) Enabled() bool {
+	return c.cells.size > 0
+}
+
+// Cell returns the key for the cell containing 'pt' for 'placetype'.
+func (c *polygonCache) Cell(placetype string, pt orb.Point) cellKey {
+
+	k := cellKey{
+		placetype: placetype,
+		x:         int64(math.Floor((pt.X() + 180.0) / c.cell_size)),
+		y:         int64(math.Floor((pt.Y() + 90.0) / c.cell_size)),
+	}
+
+	return k
+}
+
+// CellBound returns the (padded) bounding box of the cell containing 'pt'.
+func (c *polygonCache) CellBound(pt orb.Point) orb.Bound {
+
+	k := c.Cell("", pt)
+
+	min_x := float64(k.x)*c.cell_size - 180.0
+	min_y := float64(k.y)*c.cell_size - 90.0
+
+	b := orb.Bound{
+		Min: orb.Point{min_x, min_y},
+		Max: orb.Point{min_x + c.cell_size, min_y + c.cell_size},
+	}
+
+	return b.Pad(CELL_PADDING)
+}
+
+// Candidates returns the candidates for the cell 'k', ordered using `spatial.ComparePointInPolygonCandidates`, and a
+// boolean value indicating whether the cell has been cached.
+func (c *polygonCache) Candidates(k cellKey) ([]*spatial.PointInPolygonCandidate, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cells.Get(k)
+}
+
+// AddCandidates adds the candidates for the cell 'k' to the cache and returns them ordered using
+// `spatial.ComparePointInPolygonCandidates`. 'candidates' is expected to contain every record whose bounding box intersects
+// the cell.
+func (c *polygonCache) AddCandidates(k cellKey, candidates []*spatial.PointInPolygonCandidate) []*spatial.PointInPolygonCandidate {
+
+	sorted := slices.Clone(candidates)
+	slices.SortFunc(sorted, spatial.ComparePointInPolygonCandidates)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cells.Add(k, sorted)
+	return sorted
+}
+
+// Geometry returns the cached geometry for the record 'id' and a boolean value indicating whether it was found.
+func (c *polygonCache) Geometry(id int64) (orb.Geometry, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.geometries.Get(id)
+}
+
+// AddGeometry adds the geometry for the record 'id' to the cache.
+func (c *polygonCache) AddGeometry(id int64, geom orb.Geometry) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.geometries.Add(id, geom)
+}
+
+// lruCache is a fixed-size, least-recently-used, cache. It is not safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	size    int
+	entries *list.List
+	keys    map[K]*list.Element
+}
+
+// lruEntry is a key and value stored in a `lruCache`.
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache returns a new `lruCache` instance that will hold at most 'size' values. If 'size' is less than or equal to
+// zero no values are stored.
+func newLRUCache[K comparable, V any](size int) *lruCache[K, V] {
+
+	c := &lruCache[K, V]{
+		size:    size,
+		entries: list.New(),
+		keys:    make(map[K]*list.Element),
+	}
+
+	return c
+}
+
+// Get returns the value for 'k', marking it as the most recently used, and a boolean value indicating whether it was found.
+func (c *lruCache[K, V]) Get(k K) (V, bool) {
+
+	el, ok := c.keys[k]
+
+	if !ok {
+		var v V
+		return v, false
+	}
+
+	c.entries.MoveToFront(el)
+	return el.Value.(*lruEntry[K, V]).value, true
+}
+
+// Add sets the value for 'k', evicting the least recently used value if the cache is full.
+func (c *lruCache[K, V]) Add(k K, v V) {
+
+	if c.size <= 0 {
+		return
+	}
+
+	el, ok := c.keys[k]
+
+	if ok {
+		el.Value.(*lruEntry[K, V]).value = v
+		c.entries.MoveToFront(el)
+		return
+	}
+
+	c.keys[k] = c.entries.PushFront(&lruEntry[K, V]{key: k, value: v})
+
+	if c.entries.Len() > c.size {
+		oldest := c.entries.Back()
+		c.entries.Remove(oldest)
+		delete(c.keys, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// Len returns the number of values in the cache.
+func (c *lruCache[K, V]) Len() int {
+	return c.entries.Len()
+}
+
+// geometryContains returns a boolean value indicating whether 'geom' contains 'pt'.
+func geometryContains(geom orb.Geometry, pt orb.Point) bool {
+
+	switch g := geom.(type) {
+	case orb.Polygon:
+		return planar.PolygonContains(g, pt)
+	case orb.MultiPolygon:
+		return planar.MultiPolygonContains(g, pt)
+	default:
+		return false
+	}
+}
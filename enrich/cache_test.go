@@ -0,0 +1,126 @@
+package enrich
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+func TestLRUCache(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		size     int
+		keys     []int
+		get      int
+		add      int
+		expected []int
+	}{
+		{"disabled", 0, []int{1, 2}, 1, 3, []int{}},
+		{"evict oldest", 2, []int{1, 2}, 0, 3, []int{2, 3}},
+		{"evict least recently used", 2, []int{1, 2}, 1, 3, []int{1, 3}},
+		{"update", 2, []int{1, 2}, 0, 1, []int{1, 2}},
+	}
+
+	for _, test := range tests {
+
+		c := newLRUCache[int, int](test.size)
+
+		for _, k := range test.keys {
+			c.Add(k, k)
+		}
+
+		if test.get != 0 {
+			c.Get(test.get)
+		}
+
+		c.Add(test.add, test.add)
+
+		if c.Len() != len(test.expected) {
+			t.Fatalf("Expected %d values for %s, got %d", len(test.expected), test.name, c.Len())
+		}
+
+		for _, k := range test.expected {
+
+			v, ok := c.Get(k)
+
+			if !ok || v != k {
+				t.Fatalf("Expected %d to be cached for %s", k, test.name)
+			}
+		}
+	}
+}
+
+func TestPolygonCacheCell(t *testing.T) {
+
+	c := newPolygonCache(DEFAULT_CACHE_SIZE, 1.0)
+
+	tests := []struct {
+		pt       orb.Point
+		expected cellKey
+	}{
+		{orb.Point{-180, -90}, cellKey{"locality", 0, 0}},
+		{orb.Point{0, 0}, cellKey{"locality", 180, 90}},
+		{orb.Point{-73.5, 45.5}, cellKey{"locality", 106, 135}},
+		{orb.Point{-0.000001, 0.000001}, cellKey{"locality", 179, 90}},
+	}
+
+	for _, test := range tests {
+
+		k := c.Cell("locality", test.pt)
+
+		if k != test.expected {
+			t.Fatalf("Unexpected cell for %v: %v", test.pt, k)
+		}
+
+		b := c.CellBound(test.pt)
+
+		if !b.Contains(test.pt) {
+			t.Fatalf("Expected cell bound %v to contain %v", b, test.pt)
+		}
+
+		if b.Max.X()-b.Min.X() > 1.0+2*CELL_PADDING+1e-12 || b.Max.Y()-b.Min.Y() > 1.0+2*CELL_PADDING+1e-12 {
+			t.Fatalf("Unexpected size for cell bound %v", b)
+		}
+	}
+}
+
+func TestPolygonCacheCandidates(t *testing.T) {
+
+	c := newPolygonCache(DEFAULT_CACHE_SIZE, 1.0)
+
+	k := c.Cell("locality", orb.Point{0.5, 0.5})
+
+	_, ok := c.Candidates(k)
+
+	if ok {
+		t.Fatalf("Expected cell to be missing")
+	}
+
+	added := c.AddCandidates(k, []*spatial.PointInPolygonCandidate{
+		{Id: 3, Bounds: orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}},
+		{Id: 1, Bounds: orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}}},
+		{Id: 2, Bounds: orb.Bound{Min: orb.Point{0.5, 0.5}, Max: orb.Point{1.5, 1.5}}},
+	})
+
+	candidates, ok := c.Candidates(k)
+
+	if !ok {
+		t.Fatalf("Expected cell to be cached")
+	}
+
+	if len(added) != len(candidates) || added[0] != candidates[0] {
+		t.Fatalf("Expected the cached candidates to be returned")
+	}
+
+	ids := make([]int64, len(candidates))
+
+	for idx, candidate := range candidates {
+		ids[idx] = candidate.Id
+	}
+
+	if len(ids) != 3 || ids[0] != 2 || ids[1] != 3 || ids[2] != 1 {
+		t.Fatalf("Unexpected order of candidates: %v", ids)
+	}
+}
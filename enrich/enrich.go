@@ -0,0 +1,307 @@
+// Package enrich provides methods for tagging points with the Who's On First records, of one or more placetypes, that
+// contain them.
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/paulmach/orb"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// The default number of grid cells, and polygons, cached by an `Enricher` instance.
+const DEFAULT_CACHE_SIZE int = 1000
+
+// The default width and height, in degrees, of the grid cells used to cache polygons.
+const DEFAULT_CELL_SIZE float64 = 0.1
+
+// Database is the interface for querying the candidate polygons that may contain a point used by an `Enricher`. It is
+// implemented by `spatial.MySQLSpatialDatabase`.
+type Database interface {
+	// PointInPolygonCandidates returns the records whose bounding boxes intersect a bounding box.
+	PointInPolygonCandidates(context.Context, orb.Bound, ...*spatial.Filters) ([]*spatial.PointInPolygonCandidate, error)
+	// PointInPolygonGeometries returns the geometries for a list of records, keyed by ID.
+	PointInPolygonGeometries(context.Context, []int64) (map[int64]orb.Geometry, error)
+}
+
+// Match is the Who's On First record, of a given placetype, that contains a point.
+type Match struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// EnricherOptions defines options for enriching points.
+type EnricherOptions struct {
+	// Placetypes is the list of placetypes to resolve for each point.
+	Placetypes []string
+	// Workers is the maximum number of points resolved concurrently by the `EnrichBatch` method.
+	Workers int
+	// CacheSize is the maximum number of grid cells, and of polygons, to cache. If 0 nothing is cached.
+	CacheSize int
+	// CellSize is the width and height, in degrees, of the grid cells used to cache polygons.
+	CellSize float64
+	// Filters are applied to the point-in-polygon queries used to resolve points. Its Placetypes property is ignored.
+	Filters *spatial.Filters
+}
+
+// Enricher tags points with the Who's On First records that contain them.
+type Enricher struct {
+	spatial_db Database
+	options    *EnricherOptions
+	cache      *polygonCache
+}
+
+// DefaultEnricherOptions returns a new `EnricherOptions` instance with default values. Points are resolved for the
+// "neighbourhood", "locality", "region" and "country" placetypes using records that are current.
+func DefaultEnricherOptions() (*EnricherOptions, error) {
+
+	opts := &EnricherOptions{
+		Placetypes: []string{"neighbourhood", "locality", "region", "country"},
+		Workers:    runtime.NumCPU(),
+		CacheSize:  DEFAULT_CACHE_SIZE,
+		CellSize:   DEFAULT_CELL_SIZE,
+		Filters: &spatial.Filters{
+			IsCurrent: []int64{1},
+		},
+	}
+
+	return opts, nil
+}
+
+// NewEnricher returns a new `Enricher` instance for 'spatial_db' with default options.
+func NewEnricher(ctx context.Context, spatial_db Database) (*Enricher, error) {
+
+	opts, err := DefaultEnricherOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default enricher options, %w", err)
+	}
+
+	return NewEnricherWithOptions(ctx, spatial_db, opts)
+}
+
+// NewEnricherWithOptions returns a new `Enricher` instance for 'spatial_db' configured by 'opts'.
+func NewEnricherWithOptions(ctx context.Context, spatial_db Database, opts *EnricherOptions) (*Enricher, error) {
+
+	if len(opts.Placetypes) == 0 {
+		return nil, fmt.Errorf("No placetypes to resolve")
+	}
+
+	if opts.Workers < 1 {
+		return nil, fmt.Errorf("Invalid number of workers, must be a positive integer")
+	}
+
+	if opts.CellSize <= 0 {
+		return nil, fmt.Errorf("Invalid cell size, must be a positive number")
+	}
+
+	e := &Enricher{
+		spatial_db: spatial_db,
+		options:    opts,
+		cache:      newPolygonCache(opts.CacheSize, opts.CellSize),
+	}
+
+	return e, nil
+}
+
+// EnrichPoint returns a dictionary of the records, keyed by placetype, that contain 'pt'. Placetypes with no matching
+// record are omitted. If more than one record of a placetype contains 'pt' the one with the smallest bounding box, and
+// then the lowest ID, is chosen. The candidates for the grid cell containing 'pt', and their geometries, are cached so that
+// nearby points can be resolved without querying the database.
+func (e *Enricher) EnrichPoint(ctx context.Context, pt orb.Point) (map[string]*Match, error) {
+
+	candidates := make(map[string][]*spatial.PointInPolygonCandidate)
+	missing := make([]string, 0)
+
+	for _, placetype := range e.options.Placetypes {
+
+		cell_candidates, ok := e.cache.Candidates(e.cache.Cell(placetype, pt))
+
+		if !ok {
+			missing = append(missing, placetype)
+			continue
+		}
+
+		candidates[placetype] = cell_candidates
+	}
+
+	if len(missing) > 0 {
+
+		// If the cache is disabled only the candidates for 'pt' itself are needed
+
+		b := pt.Bound()
+
+		if e.cache.Enabled() {
+			b = e.cache.CellBound(pt)
+		}
+
+		f := new(spatial.Filters)
+
+		if e.options.Filters != nil {
+			*f = *e.options.Filters
+		}
+
+		f.Placetypes = missing
+
+		results, err := e.spatial_db.PointInPolygonCandidates(ctx, b, f)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve point in polygon candidates, %w", err)
+		}
+
+		for _, placetype := range missing {
+
+			cell_candidates := make([]*spatial.PointInPolygonCandidate, 0)
+
+			for _, c := range results {
+
+				if c.Placetype == placetype {
+					cell_candidates = append(cell_candidates, c)
+				}
+			}
+
+			candidates[placetype] = e.cache.AddCandidates(e.cache.Cell(placetype, pt), cell_candidates)
+		}
+	}
+
+	// Only candidates whose bounding boxes contain 'pt' need to be tested. Tiles are cached with their
+	// geometries; retrieve any other geometries which are not cached using a single query.
+
+	possible := make(map[string][]*spatial.PointInPolygonCandidate)
+	geometries := make(map[int64]orb.Geometry)
+	to_fetch := make([]int64, 0)
+
+	for placetype, cell_candidates := range candidates {
+
+		for _, c := range cell_candidates {
+
+			if c.Tile != nil {
+
+				if c.Tile.Bounds.Contains(pt) {
+					possible[placetype] = append(possible[placetype], c)
+				}
+
+				continue
+			}
+
+			if !c.Bounds.Contains(pt) {
+				continue
+			}
+
+			possible[placetype] = append(possible[placetype], c)
+
+			_, seen := geometries[c.Id]
+
+			if seen || slices.Contains(to_fetch, c.Id) {
+				continue
+			}
+
+			geom, ok := e.cache.Geometry(c.Id)
+
+			if !ok {
+				to_fetch = append(to_fetch, c.Id)
+				continue
+			}
+
+			geometries[c.Id] = geom
+		}
+	}
+
+	if len(to_fetch) > 0 {
+
+		fetched, err := e.spatial_db.PointInPolygonGeometries(ctx, to_fetch)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve point in polygon geometries, %w", err)
+		}
+
+		for id, geom := range fetched {
+			geometries[id] = geom
+			e.cache.AddGeometry(id, geom)
+		}
+	}
+
+	matches := make(map[string]*Match)
+
+	for placetype, possible_candidates := range possible {
+
+		for _, c := range possible_candidates {
+
+			geom, ok := geometries[c.Id]
+
+			if c.Tile != nil {
+				geom, ok = c.Tile.Geometry, true
+			}
+
+			if !ok || !geometryContains(geom, pt) {
+				continue
+			}
+
+			matches[placetype] = &Match{Id: c.Id, Name: c.Name}
+			break
+		}
+	}
+
+	return matches, nil
+}
+
+// EnrichBatch returns the result of calling `EnrichPoint` for each of 'points', in the same order. Up to the enricher's
+// `Workers` option points are resolved concurrently.
+func (e *Enricher) EnrichBatch(ctx context.Context, points []orb.Point) ([]map[string]*Match, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]map[string]*Match, len(points))
+
+	throttle := make(chan bool, e.options.Workers)
+
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+
+	var first_err error
+
+	for idx, pt := range points {
+
+		throttle <- true
+		wg.Add(1)
+
+		go func(idx int, pt orb.Point) {
+
+			defer func() {
+				<-throttle
+				wg.Done()
+			}()
+
+			matches, err := e.EnrichPoint(ctx, pt)
+
+			if err != nil {
+
+				mu.Lock()
+
+				if first_err == nil {
+					first_err = fmt.Errorf("Failed to enrich point %d (%f, %f), %w", idx, pt.Lat(), pt.Lon(), err)
+					cancel()
+				}
+
+				mu.Unlock()
+				return
+			}
+
+			results[idx] = matches
+
+		}(idx, pt)
+	}
+
+	wg.Wait()
+
+	if first_err != nil {
+		return nil, first_err
+	}
+
+	return results, nil
+}
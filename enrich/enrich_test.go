@@ -0,0 +1,408 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// testPolygon is a record served by a `testDatabase` instance.
+type testPolygon struct {
+	id        int64
+	name      string
+	placetype string
+	geometry  orb.Geometry
+}
+
+// testDatabase is a `Database` implementation for a fixed list of polygons which counts the queries it is asked to perform.
+// If subdivided is true candidates are returned for the left and right halves of each polygon, like the tiles of the
+// "whosonfirst_subdivided" table.
+type testDatabase struct {
+	polygons           []*testPolygon
+	subdivided         bool
+	mu                 sync.Mutex
+	candidate_queries  int
+	geometry_queries   int
+	geometries_fetched []int64
+}
+
+func (db *testDatabase) PointInPolygonCandidates(ctx context.Context, b orb.Bound, filters ...*spatial.Filters) ([]*spatial.PointInPolygonCandidate, error) {
+
+	db.mu.Lock()
+	db.candidate_queries += 1
+	db.mu.Unlock()
+
+	candidates := make([]*spatial.PointInPolygonCandidate, 0)
+
+	for _, p := range db.polygons {
+
+		if !slices.Contains(filters[0].Placetypes, p.placetype) || !p.geometry.Bound().Intersects(b) {
+			continue
+		}
+
+		if !db.subdivided {
+
+			c := &spatial.PointInPolygonCandidate{
+				Id:        p.id,
+				Name:      p.name,
+				Placetype: p.placetype,
+				Bounds:    p.geometry.Bound(),
+			}
+
+			candidates = append(candidates, c)
+			continue
+		}
+
+		pb := p.geometry.Bound()
+		mid := (pb.Min.X() + pb.Max.X()) / 2
+
+		halves := []orb.Bound{
+			{Min: pb.Min, Max: orb.Point{mid, pb.Max.Y()}},
+			{Min: orb.Point{mid, pb.Min.Y()}, Max: pb.Max},
+		}
+
+		for idx, half := range halves {
+
+			tile := clip.Geometry(half, orb.Clone(p.geometry))
+
+			if tile == nil || !tile.Bound().Intersects(b) {
+				continue
+			}
+
+			c := &spatial.PointInPolygonCandidate{
+				Id:        p.id,
+				Name:      p.name,
+				Placetype: p.placetype,
+				Bounds:    pb,
+				Tile: &spatial.PointInPolygonTile{
+					Tile:     idx,
+					Bounds:   tile.Bound(),
+					Geometry: tile,
+				},
+			}
+
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates, nil
+}
+
+func (db *testDatabase) PointInPolygonGeometries(ctx context.Context, ids []int64) (map[int64]orb.Geometry, error) {
+
+	db.mu.Lock()
+	db.geometry_queries += 1
+	db.geometries_fetched = append(db.geometries_fetched, ids...)
+	db.mu.Unlock()
+
+	geometries := make(map[int64]orb.Geometry)
+
+	for _, p := range db.polygons {
+
+		if slices.Contains(ids, p.id) {
+			geometries[p.id] = p.geometry
+		}
+	}
+
+	return geometries, nil
+}
+
+func square(min float64, max float64) orb.Polygon {
+	return orb.Bound{Min: orb.Point{min, min}, Max: orb.Point{max, max}}.ToPolygon()
+}
+
+func newTestDatabase() *testDatabase {
+
+	return &testDatabase{
+		polygons: []*testPolygon{
+			{1, "Big", "locality", square(0, 10)},
+			// 'Right' has the same bounding box as 'Left' but a higher ID
+			{3, "Right", "locality", square(4, 6)},
+			{2, "Left", "locality", square(4, 6)},
+			// Points in the upper half of the triangle's bounding box are not in the triangle
+			{4, "Triangle", "locality", orb.Polygon{{{1, 1}, {3, 1}, {1, 3}, {1, 1}}}},
+			{5, "Region", "region", orb.MultiPolygon{square(-20, 20)}},
+		},
+	}
+}
+
+func TestEnrichPoint(t *testing.T) {
+
+	ctx := context.Background()
+
+	points := []orb.Point{
+		{5, 5},
+		{1.5, 1.5},
+		{2.8, 2.8},
+		{15, 15},
+		{30, 30},
+		{4.5, 5.5},
+	}
+
+	expected := []string{
+		"locality=2 region=5",
+		"locality=4 region=5",
+		"locality=1 region=5",
+		"region=5",
+		"",
+		"locality=2 region=5",
+	}
+
+	tests := []struct {
+		cache_size int
+		cell_size  float64
+		subdivided bool
+	}{
+		{0, DEFAULT_CELL_SIZE, false},
+		{1, DEFAULT_CELL_SIZE, false},
+		{1, 1.0, false},
+		{DEFAULT_CACHE_SIZE, DEFAULT_CELL_SIZE, false},
+		{DEFAULT_CACHE_SIZE, 1.0, false},
+		{DEFAULT_CACHE_SIZE, 10.0, false},
+		{DEFAULT_CACHE_SIZE, 90.0, false},
+		{0, DEFAULT_CELL_SIZE, true},
+		{1, 1.0, true},
+		{DEFAULT_CACHE_SIZE, 1.0, true},
+		{DEFAULT_CACHE_SIZE, 90.0, true},
+	}
+
+	for _, test := range tests {
+
+		// Results must not depend on the order in which points are resolved
+
+		for _, reverse := range []bool{false, true} {
+
+			name := fmt.Sprintf("cache=%d cell=%f subdivided=%t reverse=%t", test.cache_size, test.cell_size, test.subdivided, reverse)
+
+			db := newTestDatabase()
+			db.subdivided = test.subdivided
+
+			e, err := NewEnricherWithOptions(ctx, db, &EnricherOptions{
+				Placetypes: []string{"locality", "region"},
+				Workers:    1,
+				CacheSize:  test.cache_size,
+				CellSize:   test.cell_size,
+			})
+
+			if err != nil {
+				t.Fatalf("Failed to create enricher for %s, %v", name, err)
+			}
+
+			for i := range points {
+
+				idx := i
+
+				if reverse {
+					idx = len(points) - 1 - i
+				}
+
+				matches, err := e.EnrichPoint(ctx, points[idx])
+
+				if err != nil {
+					t.Fatalf("Failed to enrich %v for %s, %v", points[idx], name, err)
+				}
+
+				str_matches := make([]string, 0)
+
+				for _, placetype := range []string{"locality", "region"} {
+
+					m, ok := matches[placetype]
+
+					if ok {
+						str_matches = append(str_matches, fmt.Sprintf("%s=%d", placetype, m.Id))
+					}
+				}
+
+				v := strings.Join(str_matches, " ")
+
+				if v != expected[idx] {
+					t.Fatalf("Unexpected matches for %v with %s: %s", points[idx], name, v)
+				}
+			}
+		}
+	}
+}
+
+func TestEnrichPointCache(t *testing.T) {
+
+	ctx := context.Background()
+
+	db := newTestDatabase()
+
+	e, err := NewEnricherWithOptions(ctx, db, &EnricherOptions{
+		Placetypes: []string{"locality"},
+		Workers:    1,
+		CacheSize:  DEFAULT_CACHE_SIZE,
+		CellSize:   10.0,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create enricher, %v", err)
+	}
+
+	tests := []struct {
+		pt                orb.Point
+		candidate_queries int
+		geometry_queries  int
+	}{
+		// The first point in a cell retrieves its candidates and the geometries whose bounding boxes contain it
+		{orb.Point{5, 5}, 1, 1},
+		// Points in the same cell are resolved using cached candidates and geometries
+		{orb.Point{5.5, 5.5}, 1, 1},
+		// Geometries which have not been tested before are retrieved
+		{orb.Point{1.5, 1.5}, 1, 2},
+		{orb.Point{2.5, 1.5}, 1, 2},
+		// Points in another cell retrieve that cell's candidates
+		{orb.Point{15, 15}, 2, 2},
+	}
+
+	for _, test := range tests {
+
+		_, err := e.EnrichPoint(ctx, test.pt)
+
+		if err != nil {
+			t.Fatalf("Failed to enrich %v, %v", test.pt, err)
+		}
+
+		if db.candidate_queries != test.candidate_queries || db.geometry_queries != test.geometry_queries {
+			t.Fatalf("Unexpected queries after %v: %d candidate queries, %d geometry queries", test.pt, db.candidate_queries, db.geometry_queries)
+		}
+	}
+
+	slices.Sort(db.geometries_fetched)
+
+	if fmt.Sprintf("%v", db.geometries_fetched) != "[1 2 3 4]" {
+		t.Fatalf("Expected each geometry to be retrieved once, got %v", db.geometries_fetched)
+	}
+}
+
+func TestEnrichPointCacheSubdivided(t *testing.T) {
+
+	ctx := context.Background()
+
+	db := newTestDatabase()
+	db.subdivided = true
+
+	e, err := NewEnricherWithOptions(ctx, db, &EnricherOptions{
+		Placetypes: []string{"locality"},
+		Workers:    1,
+		CacheSize:  DEFAULT_CACHE_SIZE,
+		CellSize:   10.0,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create enricher, %v", err)
+	}
+
+	// Tiles are cached, with their geometries, along with each cell so no geometries are ever retrieved
+
+	tests := []struct {
+		pt                orb.Point
+		candidate_queries int
+	}{
+		{orb.Point{5, 5}, 1},
+		{orb.Point{1.5, 1.5}, 1},
+		{orb.Point{8, 2}, 1},
+		{orb.Point{15, 15}, 2},
+	}
+
+	for _, test := range tests {
+
+		_, err := e.EnrichPoint(ctx, test.pt)
+
+		if err != nil {
+			t.Fatalf("Failed to enrich %v, %v", test.pt, err)
+		}
+
+		if db.candidate_queries != test.candidate_queries || db.geometry_queries != 0 {
+			t.Fatalf("Unexpected queries after %v: %d candidate queries, %d geometry queries", test.pt, db.candidate_queries, db.geometry_queries)
+		}
+	}
+}
+
+func TestEnrichBatch(t *testing.T) {
+
+	ctx := context.Background()
+
+	e, err := NewEnricherWithOptions(ctx, newTestDatabase(), &EnricherOptions{
+		Placetypes: []string{"locality"},
+		Workers:    4,
+		CacheSize:  DEFAULT_CACHE_SIZE,
+		CellSize:   DEFAULT_CELL_SIZE,
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create enricher, %v", err)
+	}
+
+	points := make([]orb.Point, 0)
+
+	for i := 0; i < 100; i++ {
+		points = append(points, orb.Point{5, 5}, orb.Point{8, 8}, orb.Point{50, 50})
+	}
+
+	results, err := e.EnrichBatch(ctx, points)
+
+	if err != nil {
+		t.Fatalf("Failed to enrich batch, %v", err)
+	}
+
+	for idx, matches := range results {
+
+		var expected int64
+
+		switch idx % 3 {
+		case 0:
+			expected = 2
+		case 1:
+			expected = 1
+		}
+
+		m, ok := matches["locality"]
+
+		if expected == 0 {
+
+			if ok {
+				t.Fatalf("Expected no match for point %d, got %d", idx, m.Id)
+			}
+
+			continue
+		}
+
+		if !ok || m.Id != expected {
+			t.Fatalf("Expected %d for point %d, got %v", expected, idx, m)
+		}
+	}
+}
+
+func TestNewEnricherWithOptions(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts *EnricherOptions
+		ok   bool
+	}{
+		{"valid", &EnricherOptions{Placetypes: []string{"locality"}, Workers: 1, CellSize: 1.0}, true},
+		{"no placetypes", &EnricherOptions{Workers: 1, CellSize: 1.0}, false},
+		{"no workers", &EnricherOptions{Placetypes: []string{"locality"}, CellSize: 1.0}, false},
+		{"no cell size", &EnricherOptions{Placetypes: []string{"locality"}, Workers: 1}, false},
+	}
+
+	for _, test := range tests {
+
+		_, err := NewEnricherWithOptions(ctx, newTestDatabase(), test.opts)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for %s, %v", test.name, err)
+		}
+	}
+}
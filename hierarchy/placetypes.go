@@ -0,0 +1,70 @@
+package hierarchy
+
+// placetype_parents maps Who's On First placetypes to their possible parent placetypes, in order of preference.
+// It is derived from the whosonfirst-placetypes specification and only includes the placetypes that are
+// commonly used as parents.
+var placetype_parents = map[string][]string{
+	"planet":        {},
+	"ocean":         {"planet"},
+	"marinearea":    {"ocean", "planet"},
+	"continent":     {"planet"},
+	"empire":        {"continent"},
+	"country":       {"empire", "continent"},
+	"dependency":    {"country", "empire", "continent"},
+	"disputed":      {"country", "dependency", "continent"},
+	"macroregion":   {"country", "dependency", "disputed"},
+	"region":        {"macroregion", "country", "dependency", "disputed"},
+	"macrocounty":   {"region"},
+	"county":        {"macrocounty", "region"},
+	"metroarea":     {"region", "country"},
+	"localadmin":    {"county", "macrocounty", "region"},
+	"locality":      {"localadmin", "county", "macrocounty", "region", "dependency", "disputed", "country"},
+	"postalcode":    {"locality", "localadmin", "county", "region"},
+	"borough":       {"locality"},
+	"macrohood":     {"borough", "locality"},
+	"neighbourhood": {"macrohood", "borough", "locality", "localadmin"},
+	"microhood":     {"neighbourhood"},
+	"campus":        {"microhood", "neighbourhood", "macrohood", "borough", "locality", "localadmin", "county", "region"},
+	"building":      {"campus", "microhood", "neighbourhood", "macrohood", "borough", "locality", "localadmin", "county", "region"},
+	"venue":         {"building", "campus", "microhood", "neighbourhood", "macrohood", "borough", "locality", "localadmin", "county", "region"},
+	"address":       {"building", "venue", "campus", "microhood", "neighbourhood", "macrohood", "borough", "locality"},
+}
+
+// IsValidPlacetype returns a boolean value indicating whether 'pt' is a placetype known to the resolver.
+func IsValidPlacetype(pt string) bool {
+	_, ok := placetype_parents[pt]
+	return ok
+}
+
+// Ancestors returns the list of all the placetypes that may be ancestors of 'pt', ordered from the nearest to the
+// most distant. Placetypes are ordered breadth-first so the preferred parents of each placetype are listed before
+// their own ancestors.
+func Ancestors(pt string) []string {
+
+	ancestors := make([]string, 0)
+	seen := map[string]bool{
+		pt: true,
+	}
+
+	queue := []string{pt}
+
+	for len(queue) > 0 {
+
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, parent := range placetype_parents[current] {
+
+			if seen[parent] {
+				continue
+			}
+
+			seen[parent] = true
+
+			ancestors = append(ancestors, parent)
+			queue = append(queue, parent)
+		}
+	}
+
+	return ancestors
+}
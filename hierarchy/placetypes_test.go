@@ -0,0 +1,52 @@
+package hierarchy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAncestors(t *testing.T) {
+
+	tests := []struct {
+		placetype string
+		expected  []string
+	}{
+		{"planet", []string{}},
+		{"continent", []string{"planet"}},
+		{"country", []string{"empire", "continent", "planet"}},
+		{"macrohood", []string{"borough", "locality", "localadmin", "county", "macrocounty", "region", "dependency", "disputed", "country", "macroregion", "empire", "continent", "planet"}},
+		{"microhood", []string{"neighbourhood", "macrohood", "borough", "locality", "localadmin", "county", "macrocounty", "region", "dependency", "disputed", "country", "macroregion", "empire", "continent", "planet"}},
+		{"unknown", []string{}},
+	}
+
+	for _, test := range tests {
+
+		ancestors := Ancestors(test.placetype)
+
+		if !reflect.DeepEqual(ancestors, test.expected) {
+			t.Fatalf("Unexpected ancestors for %s: %v", test.placetype, ancestors)
+		}
+	}
+}
+
+func TestIsValidPlacetype(t *testing.T) {
+
+	tests := []struct {
+		placetype string
+		expected  bool
+	}{
+		{"locality", true},
+		{"venue", true},
+		{"planet", true},
+		{"Locality", false},
+		{"city", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+
+		if IsValidPlacetype(test.placetype) != test.expected {
+			t.Fatalf("Expected IsValidPlacetype(%s) to be %t", test.placetype, test.expected)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Package hierarchy provides methods for resolving the parent and hierarchies of Who's On First records using
+// point-in-polygon queries against the "whosonfirst" table of a MySQL database.
+package hierarchy
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/sjson"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+// TIE_BREAKER_FIRST is the tie-breaking strategy that chooses the candidate parent with the lowest ID.
+const TIE_BREAKER_FIRST string = "first"
+
+// TIE_BREAKER_SMALLEST is the tie-breaking strategy that chooses the candidate parent with the smallest bounding box.
+const TIE_BREAKER_SMALLEST string = "smallest"
+
+// TIE_BREAKER_FAIL is the tie-breaking strategy that returns `ErrAmbiguousParent` if there is more than one candidate parent.
+const TIE_BREAKER_FAIL string = "fail"
+
+// The value of "wof:parent_id" for records whose parent can not be determined.
+const PARENT_UNKNOWN int64 = -1
+
+// ErrAmbiguousParent is returned when there is more than one candidate parent and the tie-breaking strategy is `TIE_BREAKER_FAIL`.
+var ErrAmbiguousParent = errors.New("Multiple candidate parents")
+
+// ResolverOptions defines options for resolving hierarchies.
+type ResolverOptions struct {
+	// TieBreaker is the strategy used to choose a parent when there is more than one candidate.
+	TieBreaker string
+	// Filters are applied to the point-in-polygon query used to find candidate parents. Its Placetypes property is ignored.
+	Filters *spatial.Filters
+}
+
+// Updates are the properties of a record derived from its resolved parent.
+type Updates struct {
+	ParentId  int64              `json:"wof:parent_id"`
+	Hierarchy []map[string]int64 `json:"wof:hierarchy"`
+	BelongsTo []int64            `json:"wof:belongsto"`
+}
+
+// Resolver resolves the parent and hierarchies of Who's On First records.
+type Resolver struct {
+	spatial_db *spatial.MySQLSpatialDatabase
+	options    *ResolverOptions
+}
+
+// DefaultResolverOptions returns a new `ResolverOptions` instance with default values. Candidate parents are chosen
+// from records that are not deprecated or superseded using the `TIE_BREAKER_SMALLEST` strategy.
+func DefaultResolverOptions() (*ResolverOptions, error) {
+
+	opts := &ResolverOptions{
+		TieBreaker: TIE_BREAKER_SMALLEST,
+		Filters: &spatial.Filters{
+			IsDeprecated: []int64{0},
+			IsSuperseded: []int64{0},
+		},
+	}
+
+	return opts, nil
+}
+
+// ParseTieBreaker ensures that 'str' is a valid tie-breaking strategy.
+func ParseTieBreaker(str string) (string, error) {
+
+	str = strings.ToLower(str)
+
+	switch str {
+	case TIE_BREAKER_FIRST, TIE_BREAKER_SMALLEST, TIE_BREAKER_FAIL:
+		return str, nil
+	default:
+		return "", fmt.Errorf("Invalid or unsupported tie-breaker '%s'", str)
+	}
+}
+
+// NewResolver returns a new `Resolver` instance for 'spatial_db' with default options.
+func NewResolver(ctx context.Context, spatial_db *spatial.MySQLSpatialDatabase) (*Resolver, error) {
+
+	opts, err := DefaultResolverOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default resolver options, %w", err)
+	}
+
+	return NewResolverWithOptions(ctx, spatial_db, opts)
+}
+
+// NewResolverWithOptions returns a new `Resolver` instance for 'spatial_db' configured by 'opts'.
+func NewResolverWithOptions(ctx context.Context, spatial_db *spatial.MySQLSpatialDatabase, opts *ResolverOptions) (*Resolver, error) {
+
+	_, err := ParseTieBreaker(opts.TieBreaker)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Resolver{
+		spatial_db: spatial_db,
+		options:    opts,
+	}
+
+	return r, nil
+}
+
+// Resolve returns the `Updates` for 'body' derived from the records whose geometries contain its centroid. Candidate
+// parents are limited to the placetypes that may be ancestors of the record's placetype and the nearest placetype with
+// any matching records is used. If no parent can be found the parent ID is `PARENT_UNKNOWN`.
+func (r *Resolver) Resolve(ctx context.Context, body []byte) (*Updates, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	pt, err := properties.Placetype(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive placetype, %w", err)
+	}
+
+	if !IsValidPlacetype(pt) {
+		return nil, fmt.Errorf("Invalid or unsupported placetype '%s'", pt)
+	}
+
+	self_key := fmt.Sprintf("%s_id", pt)
+
+	unknown := &Updates{
+		ParentId: PARENT_UNKNOWN,
+		Hierarchy: []map[string]int64{
+			{self_key: id},
+		},
+		BelongsTo: []int64{},
+	}
+
+	ancestors := Ancestors(pt)
+
+	if len(ancestors) == 0 {
+		return unknown, nil
+	}
+
+	centroid, _, err := properties.Centroid(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive centroid, %w", err)
+	}
+
+	f := new(spatial.Filters)
+
+	if r.options.Filters != nil {
+		*f = *r.options.Filters
+	}
+
+	f.Placetypes = ancestors
+
+	results, err := r.spatial_db.PointInPolygon(ctx, centroid, f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to perform point in polygon query, %w", err)
+	}
+
+	// Candidates are the results with the nearest ancestor placetype
+
+	candidates := make([]*spatial.StandardPlacesResult, 0)
+
+	for _, ancestor := range ancestors {
+
+		for _, spr := range results {
+
+			if spr.WOFPlacetype == ancestor && spr.WOFId != id {
+				candidates = append(candidates, spr)
+			}
+		}
+
+		if len(candidates) > 0 {
+			break
+		}
+	}
+
+	if len(candidates) == 0 {
+		return unknown, nil
+	}
+
+	parent, err := r.tieBreak(candidates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parent_r, err := r.spatial_db.Read(ctx, parent.WOFPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read parent record %d, %w", parent.WOFId, err)
+	}
+
+	defer parent_r.Close()
+
+	parent_body, err := io.ReadAll(parent_r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read parent record %d, %w", parent.WOFId, err)
+	}
+
+	parent_hierarchies := properties.Hierarchies(parent_body)
+
+	if len(parent_hierarchies) == 0 {
+
+		parent_hierarchies = []map[string]int64{
+			{fmt.Sprintf("%s_id", parent.WOFPlacetype): parent.WOFId},
+		}
+	}
+
+	hierarchies := make([]map[string]int64, len(parent_hierarchies))
+	belongs_to := make([]int64, 0)
+
+	for idx, parent_h := range parent_hierarchies {
+
+		h := make(map[string]int64)
+
+		for k, v := range parent_h {
+
+			h[k] = v
+
+			if v > 0 && v != id && !slices.Contains(belongs_to, v) {
+				belongs_to = append(belongs_to, v)
+			}
+		}
+
+		h[self_key] = id
+		hierarchies[idx] = h
+	}
+
+	slices.Sort(belongs_to)
+
+	updates := &Updates{
+		ParentId:  parent.WOFId,
+		Hierarchy: hierarchies,
+		BelongsTo: belongs_to,
+	}
+
+	return updates, nil
+}
+
+// tieBreak returns the parent chosen from 'candidates' using the resolver's tie-breaking strategy.
+func (r *Resolver) tieBreak(candidates []*spatial.StandardPlacesResult) (*spatial.StandardPlacesResult, error) {
+
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	switch r.options.TieBreaker {
+	case TIE_BREAKER_FIRST:
+
+		return slices.MinFunc(candidates, func(a, b *spatial.StandardPlacesResult) int {
+			return cmp.Compare(a.WOFId, b.WOFId)
+		}), nil
+
+	case TIE_BREAKER_SMALLEST:
+
+		return slices.MinFunc(candidates, func(a, b *spatial.StandardPlacesResult) int {
+
+			a_area := (a.MZMaxLongitude - a.MZMinLongitude) * (a.MZMaxLatitude - a.MZMinLatitude)
+			b_area := (b.MZMaxLongitude - b.MZMinLongitude) * (b.MZMaxLatitude - b.MZMinLatitude)
+
+			switch {
+			case a_area < b_area:
+				return -1
+			case a_area > b_area:
+				return 1
+			default:
+				return cmp.Compare(a.WOFId, b.WOFId)
+			}
+		}), nil
+
+	default:
+
+		ids := make([]string, len(candidates))
+
+		for idx, spr := range candidates {
+			ids[idx] = fmt.Sprintf("%d", spr.WOFId)
+		}
+
+		return nil, fmt.Errorf("%w (%s)", ErrAmbiguousParent, strings.Join(ids, ", "))
+	}
+}
+
+// Apply returns a copy of 'body' with its "wof:parent_id", "wof:hierarchy" and "wof:belongsto" properties
+// replaced by the values in 'updates'.
+func Apply(body []byte, updates *Updates) ([]byte, error) {
+
+	to_set := map[string]interface{}{
+		"properties.wof:parent_id": updates.ParentId,
+		"properties.wof:hierarchy": updates.Hierarchy,
+		"properties.wof:belongsto": updates.BelongsTo,
+	}
+
+	var err error
+
+	for path, v := range to_set {
+
+		body, err = sjson.SetBytes(body, path, v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to set %s, %w", path, err)
+		}
+	}
+
+	return body, nil
+}
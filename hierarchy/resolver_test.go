@@ -0,0 +1,163 @@
+package hierarchy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-mysql/spatial"
+)
+
+func TestParseTieBreaker(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected string
+		ok       bool
+	}{
+		{"first", TIE_BREAKER_FIRST, true},
+		{"SMALLEST", TIE_BREAKER_SMALLEST, true},
+		{"fail", TIE_BREAKER_FAIL, true},
+		{"largest", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+
+		v, err := ParseTieBreaker(test.str)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result parsing '%s', %v", test.str, err)
+		}
+
+		if v != test.expected {
+			t.Fatalf("Expected '%s' for '%s', got '%s'", test.expected, test.str, v)
+		}
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+
+	// 'large' has the lowest ID and 'small' the smallest bounding box; 'tied' has the same bounding box as 'small'
+	// but a higher ID.
+
+	large := &spatial.StandardPlacesResult{WOFId: 1, MZMinLongitude: -10, MZMinLatitude: -10, MZMaxLongitude: 10, MZMaxLatitude: 10}
+	small := &spatial.StandardPlacesResult{WOFId: 3, MZMinLongitude: -1, MZMinLatitude: -1, MZMaxLongitude: 1, MZMaxLatitude: 1}
+	tied := &spatial.StandardPlacesResult{WOFId: 4, MZMinLongitude: 0, MZMinLatitude: 0, MZMaxLongitude: 2, MZMaxLatitude: 2}
+
+	tests := []struct {
+		name        string
+		tie_breaker string
+		candidates  []*spatial.StandardPlacesResult
+		expected    int64
+		ambiguous   bool
+	}{
+		{"single", TIE_BREAKER_FAIL, []*spatial.StandardPlacesResult{small}, 3, false},
+		{"first", TIE_BREAKER_FIRST, []*spatial.StandardPlacesResult{small, tied, large}, 1, false},
+		{"smallest", TIE_BREAKER_SMALLEST, []*spatial.StandardPlacesResult{large, small}, 3, false},
+		{"smallest tied", TIE_BREAKER_SMALLEST, []*spatial.StandardPlacesResult{tied, large, small}, 3, false},
+		{"fail", TIE_BREAKER_FAIL, []*spatial.StandardPlacesResult{small, large}, 0, true},
+	}
+
+	for _, test := range tests {
+
+		r := &Resolver{
+			options: &ResolverOptions{
+				TieBreaker: test.tie_breaker,
+			},
+		}
+
+		parent, err := r.tieBreak(test.candidates)
+
+		if test.ambiguous {
+
+			if !errors.Is(err, ErrAmbiguousParent) {
+				t.Fatalf("Expected %s to return ErrAmbiguousParent, got %v", test.name, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to break tie for %s, %v", test.name, err)
+		}
+
+		if parent.WOFId != test.expected {
+			t.Fatalf("Expected %s to choose %d, got %d", test.name, test.expected, parent.WOFId)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		body    string
+		updates *Updates
+	}{
+		{
+			name: "replace",
+			body: `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal","wof:parent_id":1,"wof:hierarchy":[{"locality_id":101736545,"country_id":1}],"wof:belongsto":[1]},"geometry":null}`,
+			updates: &Updates{
+				ParentId:  404227581,
+				Hierarchy: []map[string]int64{{"locality_id": 101736545, "localadmin_id": 404227581, "country_id": 85633041}},
+				BelongsTo: []int64{85633041, 404227581},
+			},
+		},
+		{
+			name: "unknown",
+			body: `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal"},"geometry":null}`,
+			updates: &Updates{
+				ParentId:  PARENT_UNKNOWN,
+				Hierarchy: []map[string]int64{{"locality_id": 101736545}},
+				BelongsTo: []int64{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		body, err := Apply([]byte(test.body), test.updates)
+
+		if err != nil {
+			t.Fatalf("Failed to apply updates for %s, %v", test.name, err)
+		}
+
+		if gjson.GetBytes(body, "properties.wof:name").String() != "Montreal" {
+			t.Fatalf("Expected other properties to be preserved for %s: %s", test.name, body)
+		}
+
+		if gjson.GetBytes(body, "properties.wof:parent_id").Int() != test.updates.ParentId {
+			t.Fatalf("Unexpected parent ID for %s: %s", test.name, body)
+		}
+
+		hierarchies := gjson.GetBytes(body, "properties.wof:hierarchy").Array()
+
+		if len(hierarchies) != len(test.updates.Hierarchy) {
+			t.Fatalf("Unexpected hierarchies for %s: %s", test.name, body)
+		}
+
+		for idx, h := range test.updates.Hierarchy {
+
+			for k, v := range h {
+
+				if hierarchies[idx].Get(k).Int() != v {
+					t.Fatalf("Unexpected value for %s in hierarchy %d for %s: %s", k, idx, test.name, body)
+				}
+			}
+		}
+
+		belongs_to := gjson.GetBytes(body, "properties.wof:belongsto").Array()
+
+		if len(belongs_to) != len(test.updates.BelongsTo) {
+			t.Fatalf("Unexpected belongsto for %s: %s", test.name, body)
+		}
+
+		for idx, id := range test.updates.BelongsTo {
+
+			if belongs_to[idx].Int() != id {
+				t.Fatalf("Unexpected belongsto for %s: %s", test.name, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package metrics defines the Prometheus metrics reported by the MySQL writer, tables and change relay and a HTTP server to expose them.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry is the Prometheus registry that the metrics defined in this package, and any per-writer collectors, are registered with.
+var Registry = prometheus.NewRegistry()
+
+// FeaturesTotal counts the number of features processed by `writer.MySQLWriter` instances, partitioned by status ("indexed", "skipped" or "failed").
+var FeaturesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "wof_mysql_features_total",
+	Help: "The number of features processed by the MySQL writer.",
+}, []string{"status"})
+
+// BytesTotal counts the number of bytes indexed by `writer.MySQLWriter` instances.
+var BytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "wof_mysql_bytes_total",
+	Help: "The number of bytes indexed by the MySQL writer.",
+})
+
+// BatchSize measures the number of features indexed by `writer.MySQLWriter` instances between calls to their `Flush` (or `Close`) methods.
+var BatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "wof_mysql_writer_batch_size",
+	Help:    "The number of features indexed by the MySQL writer between flushes.",
+	Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+})
+
+// TableIndexDuration measures the time spent indexing individual records, partitioned by table name.
+var TableIndexDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "wof_mysql_table_index_duration_seconds",
+	Help:    "The time spent indexing a record in a table.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"table"})
+
+// TableErrorsTotal counts the number of errors indexing records, partitioned by table name and MySQL error number.
+var TableErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "wof_mysql_table_errors_total",
+	Help: "The number of errors indexing records in a table, by MySQL error number.",
+}, []string{"table", "error"})
+
+// RetriesTotal counts the number of times operations have been retried, partitioned by MySQL error number.
+var RetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "wof_mysql_retries_total",
+	Help: "The number of times operations have been retried, by MySQL error number.",
+}, []string{"error"})
+
+// RelayEventsTotal counts the number of change events delivered by `relay.Relay` instances, partitioned by relay name.
+var RelayEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "wof_mysql_relay_events_total",
+	Help: "The number of change events delivered by the relay.",
+}, []string{"relay"})
+
+// RelaySkippedTotal counts the number of missing sequence numbers skipped by `relay.Relay` instances, partitioned by relay name.
+var RelaySkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "wof_mysql_relay_skipped_total",
+	Help: "The number of missing sequence numbers skipped by the relay after waiting for them to appear.",
+}, []string{"relay"})
+
+// RelayCursor reports the sequence number of the last change event delivered by `relay.Relay` instances, partitioned by relay name.
+var RelayCursor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "wof_mysql_relay_cursor",
+	Help: "The sequence number of the last change event delivered by the relay.",
+}, []string{"relay"})
+
+func init() {
+
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		FeaturesTotal,
+		BytesTotal,
+		BatchSize,
+		TableIndexDuration,
+		TableErrorsTotal,
+		RetriesTotal,
+		RelayEventsTotal,
+		RelaySkippedTotal,
+		RelayCursor,
+	)
+}
+
+// RegisterDBStats registers a collector reporting the connection pool statistics (`sql.DBStats`) for 'db' with `Registry`.
+// The statistics are labeled with 'id' (as "db_name") so that more than one database can be registered at the same time.
+// The function returned unregisters the collector and should be called when 'db' is closed.
+func RegisterDBStats(id string, db *sql.DB) (func(), error) {
+	return register(collectors.NewDBStatsCollector(db, id))
+}
+
+// RegisterQueueDepth registers a gauge reporting the number of features waiting to be indexed by a writer's worker
+// goroutines, as returned by 'fn', with `Registry`. The gauge is labeled with 'id' (as "writer") so that more than one
+// writer can be registered at the same time. The function returned unregisters the gauge and should be called when the
+// writer is closed.
+func RegisterQueueDepth(id string, fn func() float64) (func(), error) {
+
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "wof_mysql_writer_queue_depth",
+		Help:        "The number of features waiting to be indexed by MySQL writer workers.",
+		ConstLabels: prometheus.Labels{"writer": id},
+	}, fn)
+
+	return register(g)
+}
+
+// register registers 'c' with `Registry` and returns a function to unregister it.
+func register(c prometheus.Collector) (func(), error) {
+
+	err := Registry.Register(c)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register collector, %w", err)
+	}
+
+	unregister := func() {
+		Registry.Unregister(c)
+	}
+
+	return unregister, nil
+}
+
+// Handler returns a `http.Handler` that serves the metrics in `Registry` in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe starts a HTTP server listening on 'address' that will serve the metrics in `Registry`
+// from the "/metrics" endpoint. The server is shut down when 'ctx' is cancelled.
+func ListenAndServe(ctx context.Context, address string) error {
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	s := &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(shutdown_ctx)
+	}()
+
+	err := s.ListenAndServe()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Failed to serve metrics, %w", err)
+	}
+
+	return nil
+}
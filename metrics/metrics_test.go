@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// scrape returns the metrics served by `Handler` in the Prometheus text format.
+func scrape(t *testing.T) string {
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rsp := httptest.NewRecorder()
+
+	Handler().ServeHTTP(rsp, req)
+
+	body, err := io.ReadAll(rsp.Result().Body)
+
+	if err != nil {
+		t.Fatalf("Failed to read metrics, %v", err)
+	}
+
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+
+	FeaturesTotal.WithLabelValues("indexed").Add(2)
+	BytesTotal.Add(1024)
+	BatchSize.Observe(2)
+	TableIndexDuration.WithLabelValues("geojson").Observe(0.01)
+	TableErrorsTotal.WithLabelValues("geojson", "1213").Inc()
+	RetriesTotal.WithLabelValues("1213").Inc()
+	RelayEventsTotal.WithLabelValues("default").Add(3)
+	RelaySkippedTotal.WithLabelValues("default").Inc()
+	RelayCursor.WithLabelValues("default").Set(42)
+
+	body := scrape(t)
+
+	tests := []string{
+		"# TYPE wof_mysql_features_total counter",
+		`wof_mysql_features_total{status="indexed"} 2`,
+		"wof_mysql_bytes_total 1024",
+		"# TYPE wof_mysql_writer_batch_size histogram",
+		`wof_mysql_writer_batch_size_bucket{le="4"} 1`,
+		"wof_mysql_writer_batch_size_count 1",
+		`wof_mysql_table_index_duration_seconds_count{table="geojson"} 1`,
+		`wof_mysql_table_errors_total{error="1213",table="geojson"} 1`,
+		`wof_mysql_retries_total{error="1213"} 1`,
+		`wof_mysql_relay_events_total{relay="default"} 3`,
+		`wof_mysql_relay_skipped_total{relay="default"} 1`,
+		`wof_mysql_relay_cursor{relay="default"} 42`,
+	}
+
+	for _, expected := range tests {
+
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected metrics to contain '%s', got:\n%s", expected, body)
+		}
+	}
+}
+
+func TestRegisterPerWriter(t *testing.T) {
+
+	// sql.Open does not establish any connections so this does not need a running database.
+	db, err := sql.Open("mysql", "user:pass@tcp(localhost:3306)/test")
+
+	if err != nil {
+		t.Fatalf("Failed to open database, %v", err)
+	}
+
+	defer db.Close()
+
+	tests := []struct {
+		id    string
+		depth float64
+	}{
+		{"writer-1", 1},
+		{"writer-2", 3},
+	}
+
+	unregister := make([]func(), 0)
+
+	for _, test := range tests {
+
+		depth := test.depth
+
+		u, err := RegisterQueueDepth(test.id, func() float64 { return depth })
+
+		if err != nil {
+			t.Fatalf("Failed to register queue depth for %s, %v", test.id, err)
+		}
+
+		unregister = append(unregister, u)
+
+		u, err = RegisterDBStats(test.id, db)
+
+		if err != nil {
+			t.Fatalf("Failed to register DB stats for %s, %v", test.id, err)
+		}
+
+		unregister = append(unregister, u)
+	}
+
+	_, err = RegisterQueueDepth("writer-1", func() float64 { return 0 })
+
+	if err == nil {
+		t.Fatalf("Expected duplicate registration to fail")
+	}
+
+	body := scrape(t)
+
+	for _, expected := range []string{
+		`wof_mysql_writer_queue_depth{writer="writer-1"} 1`,
+		`wof_mysql_writer_queue_depth{writer="writer-2"} 3`,
+		`go_sql_open_connections{db_name="writer-1"} 0`,
+		`go_sql_open_connections{db_name="writer-2"} 0`,
+	} {
+
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected metrics to contain '%s', got:\n%s", expected, body)
+		}
+	}
+
+	for _, u := range unregister {
+		u()
+	}
+
+	body = scrape(t)
+
+	for _, unexpected := range []string{"wof_mysql_writer_queue_depth", "go_sql_open_connections"} {
+
+		if strings.Contains(body, unexpected) {
+			t.Fatalf("Expected '%s' to be unregistered", unexpected)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package reader provides a reader for Who's On First records stored in the "geojson" table of a MySQL database.
+//
+// The `MySQLReader` type implements the `Reader` interface defined by the whosonfirst/go-reader package. This package does
+// not import whosonfirst/go-reader directly so applications that want to read records using a "mysql://" URI should register
+// it themselves. For example:
+//
+//	import (
+//		"context"
+//
+//		"github.com/whosonfirst/go-reader"
+//		mysql_reader "github.com/whosonfirst/go-whosonfirst-mysql/reader"
+//	)
+//
+//	func init() {
+//		ctx := context.Background()
+//		reader.RegisterReader(ctx, mysql_reader.SCHEME, func(ctx context.Context, uri string) (reader.Reader, error) {
+//			return mysql_reader.NewMySQLReader(ctx, uri)
+//		})
+//	}
+package reader
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/whosonfirst/go-ioutil"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// The URI scheme for `MySQLReader` instances.
+const SCHEME string = "mysql"
+
+// Reader is the interface for reading Who's On First records. It mirrors the `Reader` interface defined by the
+// whosonfirst/go-reader package.
+type Reader interface {
+	// Read returns an `io.ReadSeekCloser` instance for the record matching a Who's On First relative path.
+	Read(context.Context, string) (io.ReadSeekCloser, error)
+	// ReaderURI returns the URI for a Who's On First relative path.
+	ReaderURI(context.Context, string) string
+}
+
+var _ Reader = (*MySQLReader)(nil)
+
+// MySQLReader reads Who's On First records from the "geojson" table of a MySQL database.
+type MySQLReader struct {
+	Reader
+	db wof_sql.Database
+	// Whether the database connection was created by (and should be closed by) the reader.
+	owns_db bool
+}
+
+// NewMySQLReader returns a new `MySQLReader` instance configured by 'uri' which is expected to take the form of:
+//
+//	mysql://?dsn={DSN}
+func NewMySQLReader(ctx context.Context, uri string) (*MySQLReader, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, fmt.Errorf("Missing ?dsn= parameter")
+	}
+
+	db_uri := fmt.Sprintf("mysql://?dsn=%s", url.QueryEscape(dsn))
+
+	db, err := wof_sql.NewSQLDB(ctx, db_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create database, %w", err)
+	}
+
+	r, err := NewMySQLReaderWithDatabase(ctx, db)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	r.owns_db = true
+	return r, nil
+}
+
+// NewMySQLReaderWithDatabase returns a new `MySQLReader` instance that reads records from 'db'. 'db' is not closed
+// when the reader's `Close` method is invoked.
+func NewMySQLReaderWithDatabase(ctx context.Context, db wof_sql.Database) (*MySQLReader, error) {
+
+	r := &MySQLReader{
+		db: db,
+	}
+
+	return r, nil
+}
+
+// Read returns an `io.ReadSeekCloser` instance for the (decompressed) body of the record matching 'path', which is
+// expected to be a Who's On First relative path (for example "101/736/545/101736545.geojson"). Alternate geometry
+// paths are supported. If there is no matching record the error returned will match `fs.ErrNotExist`.
+func (r *MySQLReader) Read(ctx context.Context, path string) (io.ReadSeekCloser, error) {
+
+	id, alt, err := parsePath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	body, err := tables.GeoJSONBody(ctx, conn, id, alt)
+
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("Failed to read %s, %w", path, fs.ErrNotExist)
+		}
+
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	return ioutil.NewReadSeekCloser(bytes.NewReader(body))
+}
+
+// ReadAsOf returns an `io.ReadSeekCloser` instance for the (decompressed) body of the version of the record matching
+// 'path' that was current at 't'. Previous versions are read from the "geojson_history" table which is only populated
+// by writers that enable it (see the `HistoryTable` documentation in the tables package). If there is no matching
+// version the error returned will match `fs.ErrNotExist`.
+func (r *MySQLReader) ReadAsOf(ctx context.Context, path string, t time.Time) (io.ReadSeekCloser, error) {
+
+	return r.readVersion(ctx, path, func(conn *sql.DB, id int64, alt string) ([]byte, error) {
+		return tables.GeoJSONBodyAsOf(ctx, conn, id, alt, t)
+	})
+}
+
+// ReadWithLastModified returns an `io.ReadSeekCloser` instance for the (decompressed) body of the version of the record
+// matching 'path' whose "wof:lastmodified" property is 'lastmod'. Previous versions are read from the "geojson_history"
+// table. If there is no matching version the error returned will match `fs.ErrNotExist`.
+func (r *MySQLReader) ReadWithLastModified(ctx context.Context, path string, lastmod int64) (io.ReadSeekCloser, error) {
+
+	return r.readVersion(ctx, path, func(conn *sql.DB, id int64, alt string) ([]byte, error) {
+		return tables.GeoJSONBodyWithLastModified(ctx, conn, id, alt, lastmod)
+	})
+}
+
+// readVersion returns an `io.ReadSeekCloser` instance for the body returned by 'version' for the record matching 'path'.
+func (r *MySQLReader) readVersion(ctx context.Context, path string, version func(*sql.DB, int64, string) ([]byte, error)) (io.ReadSeekCloser, error) {
+
+	id, alt, err := parsePath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	body, err := version(conn, id, alt)
+
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("Failed to read %s, %w", path, fs.ErrNotExist)
+		}
+
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	return ioutil.NewReadSeekCloser(bytes.NewReader(body))
+}
+
+// Exists returns a boolean value indicating whether a record matching 'path' exists.
+func (r *MySQLReader) Exists(ctx context.Context, path string) (bool, error) {
+
+	id, alt, err := parsePath(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := r.db.Conn()
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := fmt.Sprintf("SELECT 1 FROM %s WHERE id = ? AND alt = ?", wof_tables.GEOJSON_TABLE_NAME)
+
+	var ok int
+
+	err = conn.QueryRowContext(ctx, q, id, alt).Scan(&ok)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("Failed to query %s, %w", path, err)
+	default:
+		return true, nil
+	}
+}
+
+// ReaderURI returns 'path' since records are identified by their relative paths.
+func (r *MySQLReader) ReaderURI(ctx context.Context, path string) string {
+	return path
+}
+
+// Close closes the underlying database connection if it was created by the reader.
+func (r *MySQLReader) Close() error {
+
+	if !r.owns_db {
+		return nil
+	}
+
+	return r.db.Close()
+}
+
+// parsePath returns the ID and the string representation of any alternate geometry for 'path'.
+func parsePath(path string) (int64, string, error) {
+
+	id, uri_args, err := uri.ParseURI(path)
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to parse %s, %w", path, err)
+	}
+
+	if !uri_args.IsAlternate {
+		return id, "", nil
+	}
+
+	alt, err := uri_args.AltGeom.String()
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to stringify alternate geometry for %s, %w", path, err)
+	}
+
+	return id, alt, nil
+}
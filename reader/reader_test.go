@@ -0,0 +1,55 @@
+package reader
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+
+	tests := []struct {
+		path string
+		id   int64
+		alt  string
+		ok   bool
+	}{
+		{"101/736/545/101736545.geojson", 101736545, "", true},
+		{"101/736/545/101736545-alt-quattroshapes.geojson", 101736545, "quattroshapes", true},
+		{"101/736/545/101736545-alt-naturalearth-display-terrain.geojson", 101736545, "naturalearth-display-terrain", true},
+		{"101736545.geojson", 101736545, "", true},
+		{"montreal.geojson", -1, "", false},
+	}
+
+	for _, test := range tests {
+
+		id, alt, err := parsePath(test.path)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result parsing %s, %v", test.path, err)
+		}
+
+		if id != test.id || alt != test.alt {
+			t.Fatalf("Unexpected values for %s: %d '%s'", test.path, id, alt)
+		}
+	}
+}
+
+func TestNewMySQLReaderInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []string{
+		"mysql://",
+		"mysql://?dsn=",
+		"%%",
+	}
+
+	for _, uri := range tests {
+
+		_, err := NewMySQLReader(ctx, uri)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", uri)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Package relay provides methods for delivering the change events recorded in the "wof_changes" table of a MySQL
+// database to a whosonfirst/go-writer/v3 `Writer` instance.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_writer "github.com/whosonfirst/go-writer/v3"
+)
+
+// The default name used to record the position of a relay in the "wof_changes_cursors" table.
+const DEFAULT_NAME string = "default"
+
+// RelayOptions defines options for relaying change events.
+type RelayOptions struct {
+	// Name is the name used to record the last event delivered by the relay in the "wof_changes_cursors" table. Relays
+	// with different names deliver events independently of one another.
+	Name string
+	// BatchSize is the maximum number of events read, delivered and recorded at a time.
+	BatchSize int
+	// Interval is the amount of time to wait before checking for new events, once all the current events have been delivered.
+	Interval time.Duration
+	// GapTimeout is the amount of time to wait for a missing sequence number before skipping it. Sequence numbers are
+	// assigned when events are recorded but transactions may be committed in a different order, or rolled back, so a
+	// missing sequence number may belong to an event that has not been committed yet or to one that will never exist.
+	GapTimeout time.Duration
+	// Prune indicates whether events that have been delivered by every relay should be removed from the "wof_changes" table.
+	Prune bool
+}
+
+// Relay delivers the events in the "wof_changes" table, in order, to a `Writer` instance. Events are delivered at least
+// once: if the relay is interrupted after delivering events, but before recording its position, those events will be
+// delivered again.
+type Relay struct {
+	store   changesStore
+	writer  wof_writer.Writer
+	options *RelayOptions
+	// The database server's auto_increment_increment setting which is the expected difference between sequence numbers.
+	increment int64
+	// The database server's auto_increment_offset setting which is the expected first sequence number.
+	offset int64
+	// now returns the current time. It is only replaced by tests.
+	now func() time.Time
+}
+
+// changesStore is the interface for reading events, and recording the position of a relay, used by `Relay`.
+type changesStore interface {
+	// Cursor returns the last sequence number delivered by a relay and the range of missing sequence numbers it is waiting for.
+	Cursor(context.Context, string) (int64, *tables.ChangesGap, error)
+	// SetCursor records the last sequence number delivered by a relay and the range of missing sequence numbers it is waiting for.
+	SetCursor(context.Context, string, int64, *tables.ChangesGap) error
+	// ReadChanges returns (up to a limit of) the events following a sequence number.
+	ReadChanges(context.Context, int64, int) ([]*tables.Change, error)
+	// PruneChanges removes the events that have been delivered by every relay.
+	PruneChanges(context.Context) (int64, error)
+}
+
+// databaseChangesStore implements the `changesStore` interface for the "wof_changes" and "wof_changes_cursors" tables.
+type databaseChangesStore struct {
+	db wof_sql.Database
+}
+
+func (s *databaseChangesStore) Cursor(ctx context.Context, name string) (int64, *tables.ChangesGap, error) {
+
+	conn, err := s.db.Conn()
+
+	if err != nil {
+		return 0, nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	return tables.ChangesCursor(ctx, conn, name)
+}
+
+func (s *databaseChangesStore) SetCursor(ctx context.Context, name string, seq int64, gap *tables.ChangesGap) error {
+
+	conn, err := s.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	return tables.SetChangesCursor(ctx, conn, name, seq, gap)
+}
+
+func (s *databaseChangesStore) ReadChanges(ctx context.Context, after int64, limit int) ([]*tables.Change, error) {
+	return tables.ReadChanges(ctx, s.db, after, limit)
+}
+
+func (s *databaseChangesStore) PruneChanges(ctx context.Context) (int64, error) {
+
+	conn, err := s.db.Conn()
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	return tables.PruneChanges(ctx, conn)
+}
+
+// DefaultRelayOptions returns a new `RelayOptions` instance with default values.
+func DefaultRelayOptions() (*RelayOptions, error) {
+
+	opts := &RelayOptions{
+		Name:       DEFAULT_NAME,
+		BatchSize:  100,
+		Interval:   1 * time.Second,
+		GapTimeout: 30 * time.Second,
+	}
+
+	return opts, nil
+}
+
+// NewRelay returns a new `Relay` instance that delivers the events in 'db' to 'wr' with default options.
+func NewRelay(ctx context.Context, db wof_sql.Database, wr wof_writer.Writer) (*Relay, error) {
+
+	opts, err := DefaultRelayOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default relay options, %w", err)
+	}
+
+	return NewRelayWithOptions(ctx, db, wr, opts)
+}
+
+// NewRelayWithOptions returns a new `Relay` instance that delivers the events in 'db' to 'wr' configured by 'opts'.
+// The "wof_changes_cursors" table is created if necessary.
+func NewRelayWithOptions(ctx context.Context, db wof_sql.Database, wr wof_writer.Writer, opts *RelayOptions) (*Relay, error) {
+
+	if opts.Name == "" {
+		return nil, fmt.Errorf("Invalid relay name, must not be empty")
+	}
+
+	if opts.BatchSize < 1 {
+		return nil, fmt.Errorf("Invalid batch size, must be a positive integer")
+	}
+
+	err := tables.EnsureChangesCursorsTable(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	var increment int64
+	var offset int64
+
+	err = conn.QueryRowContext(ctx, "SELECT @@auto_increment_increment, @@auto_increment_offset").Scan(&increment, &offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine auto_increment_increment, %w", err)
+	}
+
+	r := &Relay{
+		store:     &databaseChangesStore{db: db},
+		writer:    wr,
+		options:   opts,
+		increment: increment,
+		offset:    offset,
+		now:       time.Now,
+	}
+
+	return r, nil
+}
+
+// Run delivers events until 'ctx' is cancelled, checking for new events every `RelayOptions.Interval`.
+func (r *Relay) Run(ctx context.Context) error {
+
+	for {
+
+		count, err := r.RelayOnce(ctx)
+
+		if err != nil {
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		// Keep going if there may be more events waiting
+
+		if count == r.options.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.options.Interval):
+			// pass
+		}
+	}
+}
+
+// RelayOnce delivers up to `RelayOptions.BatchSize` events, flushes the writer and records the position of the relay.
+// It returns the number of events delivered. The range of missing sequence numbers the relay is waiting for, if any,
+// is recorded along with its position so that a relay that is restarted does not wait for it all over again.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+
+	cursor, pending, err := r.store.Cursor(ctx, r.options.Name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	changes, err := r.store.ReadChanges(ctx, cursor, r.options.BatchSize)
+
+	if err != nil {
+		return 0, err
+	}
+
+	deliverable, next_gap := r.deliverable(cursor, pending, changes, r.now())
+
+	last := cursor
+	count := 0
+
+	for _, c := range deliverable {
+
+		err := r.deliver(ctx, c)
+
+		if err != nil {
+			return count, err
+		}
+
+		last = c.Seq
+		count += 1
+	}
+
+	if count == 0 && equalGaps(pending, next_gap) {
+		return 0, nil
+	}
+
+	if count > 0 {
+
+		err = r.writer.Flush(ctx)
+
+		if err != nil {
+			return count, fmt.Errorf("Failed to flush writer, %w", err)
+		}
+	}
+
+	err = r.store.SetCursor(ctx, r.options.Name, last, next_gap)
+
+	if err != nil {
+		return count, err
+	}
+
+	metrics.RelayEventsTotal.WithLabelValues(r.options.Name).Add(float64(count))
+	metrics.RelayCursor.WithLabelValues(r.options.Name).Set(float64(last))
+
+	if count > 0 && r.options.Prune {
+
+		_, err := r.store.PruneChanges(ctx)
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// deliverable returns the leading events in 'changes', which are ordered by sequence number and follow 'cursor', that can
+// be delivered at 'now' and the range of missing sequence numbers the relay is still waiting for, or nil. Events are
+// delivered in sequence so the relay stops at the first missing sequence number unless it was first seen to be missing,
+// according to 'pending' if it contains that sequence number, more than `RelayOptions.GapTimeout` ago in which case it
+// is skipped.
+func (r *Relay) deliverable(cursor int64, pending *tables.ChangesGap, changes []*tables.Change, now time.Time) ([]*tables.Change, *tables.ChangesGap) {
+
+	expected := cursor + r.increment
+
+	if cursor == 0 {
+		expected = r.offset
+	}
+
+	count := 0
+
+	for _, c := range changes {
+
+		if c.Seq > expected {
+
+			if pending == nil || expected < pending.From || expected > pending.To {
+
+				pending = &tables.ChangesGap{
+					From:      expected,
+					To:        c.Seq - r.increment,
+					FirstSeen: now.Unix(),
+				}
+			}
+
+			first_seen := time.Unix(pending.FirstSeen, 0)
+
+			if now.Sub(first_seen) < r.options.GapTimeout {
+				slog.Debug("Waiting for missing events", "from", pending.From, "to", pending.To, "first_seen", first_seen)
+				break
+			}
+
+			slog.Warn("Skipping missing events", "from", expected, "to", c.Seq-r.increment, "first_seen", first_seen)
+			metrics.RelaySkippedTotal.WithLabelValues(r.options.Name).Add(float64((c.Seq - expected) / r.increment))
+		}
+
+		expected = c.Seq + r.increment
+		count += 1
+	}
+
+	// Forget the gap once it has been delivered or skipped
+
+	if pending != nil && pending.To < expected {
+		pending = nil
+	}
+
+	return changes[:count], pending
+}
+
+// equalGaps returns true if 'a' and 'b' are both nil or describe the same range first seen at the same time.
+func equalGaps(a *tables.ChangesGap, b *tables.ChangesGap) bool {
+
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// deliver writes 'c', encoded as a line of JSON, to the relay's writer. The path for each event is "{SEQ}.json".
+func (r *Relay) deliver(ctx context.Context, c *tables.Change) error {
+
+	var buf bytes.Buffer
+
+	err := json.NewEncoder(&buf).Encode(c)
+
+	if err != nil {
+		return fmt.Errorf("Failed to encode change %d, %w", c.Seq, err)
+	}
+
+	path := fmt.Sprintf("%d.json", c.Seq)
+
+	_, err = r.writer.Write(ctx, path, bytes.NewReader(buf.Bytes()))
+
+	if err != nil {
+		return fmt.Errorf("Failed to deliver change %d, %w", c.Seq, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_writer "github.com/whosonfirst/go-writer/v3"
+)
+
+// testStore is a `changesStore` implementation for a fixed list of events which records the position of each relay, like
+// the "wof_changes_cursors" table, between calls.
+type testStore struct {
+	changes []*tables.Change
+	cursors map[string]int64
+	gaps    map[string]*tables.ChangesGap
+}
+
+func (s *testStore) Cursor(ctx context.Context, name string) (int64, *tables.ChangesGap, error) {
+
+	var gap *tables.ChangesGap
+
+	// Return a copy, like reading a row, so that relays can not modify the store's state
+
+	g, ok := s.gaps[name]
+
+	if ok {
+		v := *g
+		gap = &v
+	}
+
+	return s.cursors[name], gap, nil
+}
+
+func (s *testStore) SetCursor(ctx context.Context, name string, seq int64, gap *tables.ChangesGap) error {
+
+	s.cursors[name] = seq
+	delete(s.gaps, name)
+
+	if gap != nil {
+		v := *gap
+		s.gaps[name] = &v
+	}
+
+	return nil
+}
+
+func (s *testStore) ReadChanges(ctx context.Context, after int64, limit int) ([]*tables.Change, error) {
+
+	changes := make([]*tables.Change, 0)
+
+	for _, c := range s.changes {
+
+		if c.Seq > after && len(changes) < limit {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *testStore) PruneChanges(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// testWriter is a `Writer` implementation which records the paths of the events it is asked to write.
+type testWriter struct {
+	wof_writer.NullWriter
+	paths []string
+}
+
+func (wr *testWriter) Write(ctx context.Context, path string, fh io.ReadSeeker) (int64, error) {
+	wr.paths = append(wr.paths, path)
+	return 0, nil
+}
+
+func changes(seqs ...int64) []*tables.Change {
+
+	c := make([]*tables.Change, len(seqs))
+
+	for i, seq := range seqs {
+		c[i] = &tables.Change{Seq: seq}
+	}
+
+	return c
+}
+
+func seqs(changes []*tables.Change) []int64 {
+
+	s := make([]int64, len(changes))
+
+	for i, c := range changes {
+		s[i] = c.Seq
+	}
+
+	return s
+}
+
+func TestDeliverable(t *testing.T) {
+
+	t0 := time.Unix(1711123456, 0)
+	timeout := 30 * time.Second
+
+	type poll struct {
+		cursor  int64
+		changes []int64
+		at      time.Duration
+		expect  []int64
+	}
+
+	tests := []struct {
+		name      string
+		increment int64
+		offset    int64
+		polls     []poll
+		pending   bool
+	}{
+		{
+			name:      "contiguous",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 0, changes: []int64{1, 2, 3}, expect: []int64{1, 2, 3}},
+				{cursor: 3, changes: []int64{4, 5}, expect: []int64{4, 5}},
+			},
+		},
+		{
+			name:      "increment",
+			increment: 2,
+			offset:    1,
+			polls: []poll{
+				{cursor: 0, changes: []int64{1, 3, 5}, expect: []int64{1, 3, 5}},
+				{cursor: 5, changes: []int64{7, 11}, expect: []int64{7}},
+			},
+			pending: true,
+		},
+		{
+			name:      "gap filled",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 2, changes: []int64{3, 5, 6}, expect: []int64{3}},
+				{cursor: 3, changes: []int64{4, 5, 6}, at: 10 * time.Second, expect: []int64{4, 5, 6}},
+			},
+		},
+		{
+			name:      "gap skipped",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 2, changes: []int64{5, 6}, expect: []int64{}},
+				{cursor: 2, changes: []int64{5, 6}, at: 29 * time.Second, expect: []int64{}},
+				{cursor: 2, changes: []int64{5, 6}, at: 30 * time.Second, expect: []int64{5, 6}},
+			},
+		},
+		{
+			name:      "gap from start",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 0, changes: []int64{2, 3}, expect: []int64{}},
+				{cursor: 0, changes: []int64{1, 2, 3}, at: 5 * time.Second, expect: []int64{1, 2, 3}},
+			},
+		},
+		{
+			name:      "gap from start skipped",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 0, changes: []int64{1000, 1001}, expect: []int64{}},
+				{cursor: 0, changes: []int64{1000, 1001}, at: time.Minute, expect: []int64{1000, 1001}},
+			},
+		},
+		{
+			name:      "gap partially filled",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 1, changes: []int64{5}, expect: []int64{}},
+				{cursor: 1, changes: []int64{3, 5}, at: 20 * time.Second, expect: []int64{}},
+				{cursor: 1, changes: []int64{3, 5}, at: 30 * time.Second, expect: []int64{3, 5}},
+			},
+		},
+		{
+			name:      "second gap timed separately",
+			increment: 1,
+			offset:    1,
+			polls: []poll{
+				{cursor: 1, changes: []int64{3}, expect: []int64{}},
+				{cursor: 1, changes: []int64{3, 5}, at: 30 * time.Second, expect: []int64{3}},
+				{cursor: 3, changes: []int64{5}, at: 45 * time.Second, expect: []int64{}},
+				{cursor: 3, changes: []int64{5}, at: 60 * time.Second, expect: []int64{5}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			r := &Relay{
+				options:   &RelayOptions{GapTimeout: timeout},
+				increment: test.increment,
+				offset:    test.offset,
+			}
+
+			var pending *tables.ChangesGap
+
+			for i, p := range test.polls {
+
+				deliverable, next_gap := r.deliverable(p.cursor, pending, changes(p.changes...), t0.Add(p.at))
+				pending = next_gap
+
+				got := seqs(deliverable)
+
+				if len(got) != len(p.expect) {
+					t.Fatalf("Poll %d: expected %v, got %v", i, p.expect, got)
+				}
+
+				for j := range got {
+
+					if got[j] != p.expect[j] {
+						t.Fatalf("Poll %d: expected %v, got %v", i, p.expect, got)
+					}
+				}
+			}
+
+			if (pending != nil) != test.pending {
+				t.Fatalf("Unexpected pending gap: %+v", pending)
+			}
+		})
+	}
+}
+
+func TestRelayOnce(t *testing.T) {
+
+	ctx := context.Background()
+
+	t0 := time.Unix(1711123456, 0)
+	timeout := 30 * time.Second
+
+	// Sequence number 3 belongs to a transaction that was rolled back so it will never appear. Each poll uses a new
+	// relay, as if the relay was restarted (or run with -once) between polls, so the time the gap was first seen
+	// must be read from the store.
+
+	store := &testStore{
+		changes: changes(1, 2, 4, 5),
+		cursors: make(map[string]int64),
+		gaps:    make(map[string]*tables.ChangesGap),
+	}
+
+	tests := []struct {
+		at     time.Duration
+		paths  []string
+		cursor int64
+		gap    bool
+	}{
+		{0, []string{"1.json", "2.json"}, 2, true},
+		{20 * time.Second, []string{}, 2, true},
+		{timeout, []string{"4.json", "5.json"}, 5, false},
+		{timeout + time.Second, []string{}, 5, false},
+	}
+
+	for i, test := range tests {
+
+		wr := &testWriter{
+			paths: make([]string, 0),
+		}
+
+		now := t0.Add(test.at)
+
+		r := &Relay{
+			store:     store,
+			writer:    wr,
+			options:   &RelayOptions{Name: DEFAULT_NAME, BatchSize: 10, GapTimeout: timeout},
+			increment: 1,
+			offset:    1,
+			now: func() time.Time {
+				return now
+			},
+		}
+
+		count, err := r.RelayOnce(ctx)
+
+		if err != nil {
+			t.Fatalf("Poll %d: failed to relay changes, %v", i, err)
+		}
+
+		if count != len(test.paths) || fmt.Sprintf("%v", wr.paths) != fmt.Sprintf("%v", test.paths) {
+			t.Fatalf("Poll %d: expected %v, got %v (%d)", i, test.paths, wr.paths, count)
+		}
+
+		if store.cursors[DEFAULT_NAME] != test.cursor {
+			t.Fatalf("Poll %d: expected cursor %d, got %d", i, test.cursor, store.cursors[DEFAULT_NAME])
+		}
+
+		gap, ok := store.gaps[DEFAULT_NAME]
+
+		if ok != test.gap {
+			t.Fatalf("Poll %d: unexpected gap %+v", i, gap)
+		}
+
+		// The gap is always timed from the first poll that noticed it
+
+		if ok && (gap.From != 3 || gap.To != 3 || gap.FirstSeen != t0.Unix()) {
+			t.Fatalf("Poll %d: unexpected gap %+v", i, gap)
+		}
+	}
+}
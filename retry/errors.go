@@ -0,0 +1,39 @@
+package retry
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrorNumber returns the MySQL error number associated with 'err' and a boolean value indicating whether 'err' is (or wraps) a `mysql.MySQLError`.
+func ErrorNumber(err error) (uint16, bool) {
+
+	var mysql_err *mysql.MySQLError
+
+	if !errors.As(err, &mysql_err) {
+		return 0, false
+	}
+
+	return mysql_err.Number, true
+}
+
+// ErrorLabel returns a short string classifying 'err', suitable for use as a metrics label. This will be the
+// MySQL error number for `mysql.MySQLError` errors, "bad_connection" for bad or invalid connection errors and
+// "other" for everything else.
+func ErrorLabel(err error) string {
+
+	n, ok := ErrorNumber(err)
+
+	if ok {
+		return strconv.Itoa(int(n))
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return "bad_connection"
+	}
+
+	return "other"
+}
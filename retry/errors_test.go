@@ -0,0 +1,36 @@
+package retry
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestErrorLabel(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"deadlock", &mysql.MySQLError{Number: ER_LOCK_DEADLOCK}, "1213"},
+		{"wrapped", fmt.Errorf("Failed to index, %w", &mysql.MySQLError{Number: 1062}), "1062"},
+		{"bad connection", driver.ErrBadConn, "bad_connection"},
+		{"invalid connection", fmt.Errorf("Failed to query, %w", mysql.ErrInvalidConn), "bad_connection"},
+		{"other", fmt.Errorf("Failed"), "other"},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			label := ErrorLabel(test.err)
+
+			if label != test.expected {
+				t.Fatalf("Expected label '%s', got '%s'", test.expected, label)
+			}
+		})
+	}
+}
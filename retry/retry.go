@@ -0,0 +1,217 @@
+// Package retry provides methods for retrying database operations that fail with transient (retryable) errors.
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+)
+
+// MySQL error number for "Deadlock found when trying to get lock; try restarting transaction".
+const ER_LOCK_DEADLOCK uint16 = 1213
+
+// MySQL error number for "Lock wait timeout exceeded; try restarting transaction".
+const ER_LOCK_WAIT_TIMEOUT uint16 = 1205
+
+// The default maximum number of times an operation will be retried.
+const DEFAULT_MAX_RETRIES int = 5
+
+// The default amount of time to wait before the first retry.
+const DEFAULT_INITIAL_DELAY time.Duration = 50 * time.Millisecond
+
+// The default maximum amount of time to wait between retries.
+const DEFAULT_MAX_DELAY time.Duration = 5 * time.Second
+
+// Policy defines the rules for retrying operations that fail with transient errors.
+type Policy struct {
+	// The maximum number of times an operation will be retried. If 0 operations are never retried.
+	MaxRetries int
+	// The amount of time to wait before the first retry. This value doubles with each subsequent retry.
+	InitialDelay time.Duration
+	// The maximum amount of time to wait between retries.
+	MaxDelay time.Duration
+	// The list of MySQL error numbers that are considered retryable.
+	ErrorNumbers []uint16
+	retries      *atomic.Int64
+}
+
+// DefaultPolicy returns a new `Policy` instance with default values.
+func DefaultPolicy() *Policy {
+
+	p := &Policy{
+		MaxRetries:   DEFAULT_MAX_RETRIES,
+		InitialDelay: DEFAULT_INITIAL_DELAY,
+		MaxDelay:     DEFAULT_MAX_DELAY,
+		ErrorNumbers: []uint16{
+			ER_LOCK_DEADLOCK,
+			ER_LOCK_WAIT_TIMEOUT,
+		},
+		retries: new(atomic.Int64),
+	}
+
+	return p
+}
+
+// NewPolicyFromQuery returns a new `Policy` instance derived from `DefaultPolicy` and updated by
+// any of the following parameters in 'q':
+// * `?max-retries=` The maximum number of times an operation will be retried.
+// * `?retry-initial-delay=` The amount of time (expressed as a Go duration string) to wait before the first retry.
+// * `?retry-max-delay=` The maximum amount of time (expressed as a Go duration string) to wait between retries.
+func NewPolicyFromQuery(q url.Values) (*Policy, error) {
+
+	p := DefaultPolicy()
+
+	if q.Get("max-retries") != "" {
+
+		v, err := strconv.Atoi(q.Get("max-retries"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?max-retries= parameter, %w", err)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid ?max-retries= parameter, must be a non-negative integer")
+		}
+
+		p.MaxRetries = v
+	}
+
+	if q.Get("retry-initial-delay") != "" {
+
+		d, err := time.ParseDuration(q.Get("retry-initial-delay"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?retry-initial-delay= parameter, %w", err)
+		}
+
+		p.InitialDelay = d
+	}
+
+	if q.Get("retry-max-delay") != "" {
+
+		d, err := time.ParseDuration(q.Get("retry-max-delay"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?retry-max-delay= parameter, %w", err)
+		}
+
+		p.MaxDelay = d
+	}
+
+	return p, nil
+}
+
+// IsRetryable returns a boolean value indicating whether 'err' is a transient error that is
+// considered safe to retry. These are `driver.ErrBadConn` and `mysql.ErrInvalidConn` errors or
+// any `mysql.MySQLError` whose error number is included in the policy's `ErrorNumbers` property.
+func (p *Policy) IsRetryable(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	number, ok := ErrorNumber(err)
+
+	if !ok {
+		return false
+	}
+
+	for _, n := range p.ErrorNumbers {
+
+		if number == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Do invokes 'fn' retrying it, with jittered exponential backoff, for as long as it fails with
+// a retryable error and the policy's retry budget has not been exhausted. It returns the number of
+// times 'fn' was retried and the last error it returned (if any). Since 'fn' may be invoked more
+// than once it is expected to be idempotent and to manage its own transactions.
+func (p *Policy) Do(ctx context.Context, fn func(context.Context) error) (int, error) {
+
+	retries := 0
+
+	for {
+
+		err := fn(ctx)
+
+		if err == nil {
+			return retries, nil
+		}
+
+		if !p.IsRetryable(err) {
+			return retries, err
+		}
+
+		if retries >= p.MaxRetries {
+			return retries, fmt.Errorf("Retry budget (%d) exhausted, %w", p.MaxRetries, err)
+		}
+
+		delay := p.backoff(retries)
+
+		slog.Debug("Retrying operation after transient error", "retry", retries+1, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return retries, fmt.Errorf("Context cancelled waiting to retry, %w", errors.Join(ctx.Err(), err))
+		case <-time.After(delay):
+			// pass
+		}
+
+		retries += 1
+
+		metrics.RetriesTotal.WithLabelValues(ErrorLabel(err)).Inc()
+
+		if p.retries != nil {
+			p.retries.Add(1)
+		}
+	}
+}
+
+// Retries returns the total number of retries performed by all the calls to the policy's `Do` method.
+func (p *Policy) Retries() int64 {
+
+	if p.retries == nil {
+		return 0
+	}
+
+	return p.retries.Load()
+}
+
+// backoff returns a random ("full jitter") delay between zero and the policy's initial delay
+// doubled 'retries' times, capped at the policy's maximum delay.
+func (p *Policy) backoff(retries int) time.Duration {
+
+	d := p.InitialDelay
+
+	for i := 0; i < retries && d < p.MaxDelay; i++ {
+		d = d * 2
+	}
+
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return rand.N(d)
+}
@@ -0,0 +1,181 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestIsRetryable(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"nil", nil, false},
+		{"deadlock", &mysql.MySQLError{Number: ER_LOCK_DEADLOCK}, true},
+		{"lock wait timeout", &mysql.MySQLError{Number: ER_LOCK_WAIT_TIMEOUT}, true},
+		{"wrapped deadlock", fmt.Errorf("Failed to index, %w", &mysql.MySQLError{Number: ER_LOCK_DEADLOCK}), true},
+		{"duplicate key", &mysql.MySQLError{Number: 1062}, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"invalid connection", fmt.Errorf("Failed to query, %w", mysql.ErrInvalidConn), true},
+		{"other", fmt.Errorf("Failed"), false},
+	}
+
+	p := DefaultPolicy()
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			if p.IsRetryable(test.err) != test.retryable {
+				t.Fatalf("Expected retryable to be %t", test.retryable)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+
+	p := &Policy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+	}
+
+	tests := []struct {
+		retries int
+		max     time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+
+		for i := 0; i < 100; i++ {
+
+			d := p.backoff(test.retries)
+
+			if d < 0 || d >= test.max {
+				t.Fatalf("Expected backoff for %d retries to be in [0, %v), got %v", test.retries, test.max, d)
+			}
+		}
+	}
+
+	zero := &Policy{}
+
+	if zero.backoff(3) != 0 {
+		t.Fatalf("Expected zero backoff for a policy without delays")
+	}
+}
+
+func TestDo(t *testing.T) {
+
+	ctx := context.Background()
+
+	deadlock := &mysql.MySQLError{Number: ER_LOCK_DEADLOCK}
+
+	tests := []struct {
+		name        string
+		max_retries int
+		errs        []error
+		retries     int
+		ok          bool
+	}{
+		{"success", 3, []error{nil}, 0, true},
+		{"retried", 3, []error{deadlock, deadlock, nil}, 2, true},
+		{"not retryable", 3, []error{fmt.Errorf("Failed")}, 0, false},
+		{"exhausted", 2, []error{deadlock, deadlock, deadlock, nil}, 2, false},
+		{"disabled", 0, []error{deadlock, nil}, 0, false},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			p := DefaultPolicy()
+			p.MaxRetries = test.max_retries
+			p.InitialDelay = time.Millisecond
+
+			calls := 0
+
+			fn := func(ctx context.Context) error {
+				err := test.errs[calls]
+				calls += 1
+				return err
+			}
+
+			retries, err := p.Do(ctx, fn)
+
+			if retries != test.retries {
+				t.Fatalf("Expected %d retries, got %d", test.retries, retries)
+			}
+
+			if (err == nil) != test.ok {
+				t.Fatalf("Unexpected error, %v", err)
+			}
+
+			if p.Retries() != int64(test.retries) {
+				t.Fatalf("Expected policy to count %d retries, got %d", test.retries, p.Retries())
+			}
+		})
+	}
+}
+
+func TestNewPolicyFromQuery(t *testing.T) {
+
+	tests := []struct {
+		query string
+		ok    bool
+		check func(*Policy) bool
+	}{
+		{"", true, func(p *Policy) bool {
+			return p.MaxRetries == DEFAULT_MAX_RETRIES && p.InitialDelay == DEFAULT_INITIAL_DELAY
+		}},
+		{"max-retries=0", true, func(p *Policy) bool { return p.MaxRetries == 0 }},
+		{"max-retries=2&retry-initial-delay=1s&retry-max-delay=1m", true, func(p *Policy) bool {
+			return p.MaxRetries == 2 && p.InitialDelay == time.Second && p.MaxDelay == time.Minute
+		}},
+		{"max-retries=-1", false, nil},
+		{"max-retries=lots", false, nil},
+		{"retry-initial-delay=soon", false, nil},
+		{"retry-max-delay=later", false, nil},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", test.query, err)
+		}
+
+		p, err := NewPolicyFromQuery(q)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected query '%s' to fail", test.query)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to create policy for '%s', %v", test.query, err)
+		}
+
+		if !test.check(p) {
+			t.Fatalf("Unexpected policy for '%s', %+v", test.query, p)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package spatial
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// PointInPolygonCandidate is a record whose bounding box intersects an area of interest and whose geometry may therefore
+// contain a point in that area. Unlike `StandardPlacesResult` it is intended to be tested (and cached) by the caller, using
+// the geometry returned by the `PointInPolygonGeometries` method or, if the candidate is a tile, the tile's own geometry.
+type PointInPolygonCandidate struct {
+	Id        int64
+	ParentId  int64
+	Name      string
+	Placetype string
+	// Bounds is the bounding box of the record's geometry.
+	Bounds orb.Bound
+	// Tile is the tile of the record's geometry, from the "whosonfirst_subdivided" table, that intersects the area of
+	// interest. It is nil unless the spatial database uses the "whosonfirst_subdivided" table.
+	Tile *PointInPolygonTile
+}
+
+// PointInPolygonTile is a tile of a record's geometry in the "whosonfirst_subdivided" table. A record may have more than
+// one tile intersecting an area of interest; its geometry contains a point if any of those tiles does.
+type PointInPolygonTile struct {
+	Part int
+	Tile int
+	// Bounds is the bounding box of the tile's geometry.
+	Bounds   orb.Bound
+	Geometry orb.Geometry
+}
+
+// Area returns the area, in square degrees, of the candidate's bounding box.
+func (c *PointInPolygonCandidate) Area() float64 {
+	return (c.Bounds.Max.X() - c.Bounds.Min.X()) * (c.Bounds.Max.Y() - c.Bounds.Min.Y())
+}
+
+// ComparePointInPolygonCandidates returns -1, 0 or 1 comparing 'a' and 'b' by the area of their (record) bounding boxes,
+// then by their IDs and then by their tiles, if any. Sorting candidates with this function orders them from the most to
+// the least specific, so that the first candidate whose geometry contains a point is chosen consistently when there is
+// more than one.
+func ComparePointInPolygonCandidates(a *PointInPolygonCandidate, b *PointInPolygonCandidate) int {
+
+	v := cmp.Compare(a.Area(), b.Area())
+
+	if v != 0 {
+		return v
+	}
+
+	v = cmp.Compare(a.Id, b.Id)
+
+	if v != 0 || a.Tile == nil || b.Tile == nil {
+		return v
+	}
+
+	v = cmp.Compare(a.Tile.Part, b.Tile.Part)
+
+	if v != 0 {
+		return v
+	}
+
+	return cmp.Compare(a.Tile.Tile, b.Tile.Tile)
+}
+
+// PointInPolygonCandidates returns the list of `PointInPolygonCandidate` instances for records in the "whosonfirst" table
+// whose bounding boxes intersect 'b' and which match all of 'filters'. The candidates for a bounding box include every
+// record whose geometry may contain any point inside it. If the spatial database uses the "whosonfirst_subdivided" table
+// there is one candidate, with its geometry, for each tile whose bounding box intersects 'b' so that the (much larger)
+// original geometries never need to be retrieved.
+func (spatial_db *MySQLSpatialDatabase) PointInPolygonCandidates(ctx context.Context, b orb.Bound, filters ...*Filters) ([]*PointInPolygonCandidate, error) {
+
+	statement := candidatesStatement
+
+	if spatial_db.subdivided {
+		statement = tileCandidatesStatement
+	}
+
+	q, args, err := statement(b, filters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query database, %w", err)
+	}
+
+	defer rows.Close()
+
+	candidates := make([]*PointInPolygonCandidate, 0)
+
+	for rows.Next() {
+
+		var id int64
+		var parent_id sql.NullInt64
+		var name sql.NullString
+		var placetype sql.NullString
+		var envelope string
+
+		var part int
+		var tile int
+		var enc_tile []byte
+
+		dest := []interface{}{
+			&id,
+			&parent_id,
+			&name,
+			&placetype,
+			&envelope,
+		}
+
+		if spatial_db.subdivided {
+			dest = append(dest, &part, &tile, &enc_tile)
+		}
+
+		err := rows.Scan(dest...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		geom, err := wkt.Unmarshal(envelope)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse envelope for %d, %w", id, err)
+		}
+
+		c := &PointInPolygonCandidate{
+			Id:        id,
+			ParentId:  -1,
+			Name:      name.String,
+			Placetype: placetype.String,
+			Bounds:    geom.Bound(),
+		}
+
+		if parent_id.Valid {
+			c.ParentId = parent_id.Int64
+		}
+
+		if spatial_db.subdivided {
+
+			tile_geom, err := wkb.Unmarshal(enc_tile)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to unmarshal geometry for tile %d of part %d of %d, %w", tile, part, id, err)
+			}
+
+			c.Tile = &PointInPolygonTile{
+				Part:     part,
+				Tile:     tile,
+				Bounds:   tile_geom.Bound(),
+				Geometry: tile_geom,
+			}
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return candidates, nil
+}
+
+// PointInPolygonGeometries returns the geometries of the records in the "whosonfirst" table matching 'ids', keyed by ID.
+// IDs without a matching record are not included in the result.
+func (spatial_db *MySQLSpatialDatabase) PointInPolygonGeometries(ctx context.Context, ids []int64) (map[int64]orb.Geometry, error) {
+
+	geometries := make(map[int64]orb.Geometry)
+
+	if len(ids) == 0 {
+		return geometries, nil
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q, args := geometriesStatement(ids)
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query database, %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var id int64
+		var enc_geom []byte
+
+		err := rows.Scan(&id, &enc_geom)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		geom, err := wkb.Unmarshal(enc_geom)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal geometry for %d, %w", id, err)
+		}
+
+		geometries[id] = geom
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return geometries, nil
+}
+
+// candidatesStatement returns the SQL query, and its arguments, for selecting the records whose bounding boxes intersect
+// 'b' and which match all of 'filters'.
+func candidatesStatement(b orb.Bound, filters ...*Filters) (string, []interface{}, error) {
+
+	where := []string{
+		"MBRIntersects(geometry, ST_GeomFromText(?))",
+	}
+
+	args := []interface{}{
+		boundWKT(b),
+	}
+
+	where, args, err := applyFilters(where, args, filters...)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT id, parent_id, JSON_UNQUOTE(JSON_EXTRACT(properties, '$."wof:name"')), placetype, ST_AsText(ST_Envelope(geometry)) FROM %s WHERE %s`,
+		wof_tables.WHOSONFIRST_TABLE_NAME, strings.Join(where, " AND "))
+
+	return q, args, nil
+}
+
+// tileCandidatesStatement returns the SQL query, and its arguments, for selecting the tiles in the "whosonfirst_subdivided"
+// table whose bounding boxes intersect 'b', along with the records they belong to, for records which match all of 'filters'.
+func tileCandidatesStatement(b orb.Bound, filters ...*Filters) (string, []interface{}, error) {
+
+	// Tiles have an SRID of 4326 so 'b' must be a valid longitude, latitude bounding box
+
+	b = orb.Bound{
+		Min: orb.Point{max(b.Min.X(), -180.0), max(b.Min.Y(), -90.0)},
+		Max: orb.Point{min(b.Max.X(), 180.0), min(b.Max.Y(), 90.0)},
+	}
+
+	where := []string{
+		fmt.Sprintf("MBRIntersects(s.geometry, %s)", tables.SUBDIVIDED_GEOMFROMTEXT),
+	}
+
+	args := []interface{}{
+		boundWKT(b),
+	}
+
+	// The conditions for filters only refer to columns in the "whosonfirst" table, none of which
+	// share a name with the columns in the "whosonfirst_subdivided" table.
+
+	where, args, err := applyFilters(where, args, filters...)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT w.id, w.parent_id, JSON_UNQUOTE(JSON_EXTRACT(w.properties, '$."wof:name"')), w.placetype, ST_AsText(ST_Envelope(w.geometry)), s.part, s.tile, ST_AsBinary(s.geometry, 'axis-order=long-lat') FROM %s s JOIN %s w ON w.id = s.id WHERE %s`,
+		tables.SUBDIVIDED_TABLE_NAME, wof_tables.WHOSONFIRST_TABLE_NAME, strings.Join(where, " AND "))
+
+	return q, args, nil
+}
+
+// boundWKT returns the WKT encoding of 'b'. A zero-area bounding box is encoded as a point since it is not a valid polygon.
+func boundWKT(b orb.Bound) string {
+
+	if b.Min.Equal(b.Max) {
+		return wkt.MarshalString(b.Min)
+	}
+
+	return wkt.MarshalString(b.ToPolygon())
+}
+
+// geometriesStatement returns the SQL query, and its arguments, for selecting the geometries of the records matching 'ids'.
+func geometriesStatement(ids []int64) (string, []interface{}) {
+
+	args := make([]interface{}, len(ids))
+
+	for idx, id := range ids {
+		args[idx] = id
+	}
+
+	q := fmt.Sprintf("SELECT id, ST_AsBinary(geometry) FROM %s WHERE id IN (%s)", wof_tables.WHOSONFIRST_TABLE_NAME, placeholders(len(ids)))
+
+	return q, args
+}
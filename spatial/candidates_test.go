@@ -0,0 +1,138 @@
+package spatial
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestComparePointInPolygonCandidates(t *testing.T) {
+
+	small := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}
+	large := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}}
+
+	tests := []struct {
+		name     string
+		a        *PointInPolygonCandidate
+		b        *PointInPolygonCandidate
+		expected int
+	}{
+		{"smaller", &PointInPolygonCandidate{Id: 2, Bounds: small}, &PointInPolygonCandidate{Id: 1, Bounds: large}, -1},
+		{"larger", &PointInPolygonCandidate{Id: 1, Bounds: large}, &PointInPolygonCandidate{Id: 2, Bounds: small}, 1},
+		{"lower id", &PointInPolygonCandidate{Id: 1, Bounds: small}, &PointInPolygonCandidate{Id: 2, Bounds: small}, -1},
+		{"higher id", &PointInPolygonCandidate{Id: 2, Bounds: small}, &PointInPolygonCandidate{Id: 1, Bounds: small}, 1},
+		{"same", &PointInPolygonCandidate{Id: 1, Bounds: small}, &PointInPolygonCandidate{Id: 1, Bounds: small}, 0},
+		{"lower part", &PointInPolygonCandidate{Id: 1, Bounds: small, Tile: &PointInPolygonTile{Part: 0, Tile: 5}}, &PointInPolygonCandidate{Id: 1, Bounds: small, Tile: &PointInPolygonTile{Part: 1, Tile: 0}}, -1},
+		{"higher tile", &PointInPolygonCandidate{Id: 1, Bounds: small, Tile: &PointInPolygonTile{Part: 1, Tile: 2}}, &PointInPolygonCandidate{Id: 1, Bounds: small, Tile: &PointInPolygonTile{Part: 1, Tile: 1}}, 1},
+		// Records are compared by the area of their own bounding boxes rather than those of their tiles
+		{"record area", &PointInPolygonCandidate{Id: 2, Bounds: small, Tile: &PointInPolygonTile{Bounds: large}}, &PointInPolygonCandidate{Id: 1, Bounds: large, Tile: &PointInPolygonTile{Bounds: small}}, -1},
+	}
+
+	for _, test := range tests {
+
+		v := ComparePointInPolygonCandidates(test.a, test.b)
+
+		if v != test.expected {
+			t.Fatalf("Expected %d for %s, got %d", test.expected, test.name, v)
+		}
+	}
+}
+
+func TestCandidatesStatement(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		bound   orb.Bound
+		filters []*Filters
+		query   string
+		args    []interface{}
+	}{
+		{
+			name:  "bound",
+			bound: orb.Bound{Min: orb.Point{-1, -2}, Max: orb.Point{1, 2}},
+			query: `SELECT id, parent_id, JSON_UNQUOTE(JSON_EXTRACT(properties, '$."wof:name"')), placetype, ST_AsText(ST_Envelope(geometry)) FROM whosonfirst WHERE MBRIntersects(geometry, ST_GeomFromText(?))`,
+			args:  []interface{}{"POLYGON((-1 -2,1 -2,1 2,-1 2,-1 -2))"},
+		},
+		{
+			name:    "point",
+			bound:   orb.Point{-73.5, 45.5}.Bound(),
+			filters: []*Filters{{Placetypes: []string{"locality"}}},
+			query:   `SELECT id, parent_id, JSON_UNQUOTE(JSON_EXTRACT(properties, '$."wof:name"')), placetype, ST_AsText(ST_Envelope(geometry)) FROM whosonfirst WHERE MBRIntersects(geometry, ST_GeomFromText(?)) AND placetype IN (?)`,
+			args:    []interface{}{"POINT(-73.5 45.5)", "locality"},
+		},
+	}
+
+	for _, test := range tests {
+
+		q, args, err := candidatesStatement(test.bound, test.filters...)
+
+		if err != nil {
+			t.Fatalf("Failed to derive statement for %s, %v", test.name, err)
+		}
+
+		if q != test.query {
+			t.Fatalf("Unexpected query for %s: %s", test.name, q)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+	}
+}
+
+func TestTileCandidatesStatement(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		bound   orb.Bound
+		filters []*Filters
+		query   string
+		args    []interface{}
+	}{
+		{
+			name:    "bound",
+			bound:   orb.Bound{Min: orb.Point{-1, -2}, Max: orb.Point{1, 2}},
+			filters: []*Filters{{Placetypes: []string{"locality"}}},
+			query:   `SELECT w.id, w.parent_id, JSON_UNQUOTE(JSON_EXTRACT(w.properties, '$."wof:name"')), w.placetype, ST_AsText(ST_Envelope(w.geometry)), s.part, s.tile, ST_AsBinary(s.geometry, 'axis-order=long-lat') FROM whosonfirst_subdivided s JOIN whosonfirst w ON w.id = s.id WHERE MBRIntersects(s.geometry, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) AND placetype IN (?)`,
+			args:    []interface{}{"POLYGON((-1 -2,1 -2,1 2,-1 2,-1 -2))", "locality"},
+		},
+		{
+			// Bounding boxes are clamped to valid longitudes and latitudes
+			name:  "clamped",
+			bound: orb.Bound{Min: orb.Point{179.9, 89.9}, Max: orb.Point{180.1, 90.1}},
+			query: `SELECT w.id, w.parent_id, JSON_UNQUOTE(JSON_EXTRACT(w.properties, '$."wof:name"')), w.placetype, ST_AsText(ST_Envelope(w.geometry)), s.part, s.tile, ST_AsBinary(s.geometry, 'axis-order=long-lat') FROM whosonfirst_subdivided s JOIN whosonfirst w ON w.id = s.id WHERE MBRIntersects(s.geometry, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))`,
+			args:  []interface{}{"POLYGON((179.9 89.9,180 89.9,180 90,179.9 90,179.9 89.9))"},
+		},
+	}
+
+	for _, test := range tests {
+
+		q, args, err := tileCandidatesStatement(test.bound, test.filters...)
+
+		if err != nil {
+			t.Fatalf("Failed to derive statement for %s, %v", test.name, err)
+		}
+
+		if q != test.query {
+			t.Fatalf("Unexpected query for %s: %s", test.name, q)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+	}
+}
+
+func TestGeometriesStatement(t *testing.T) {
+
+	q, args := geometriesStatement([]int64{101736545, 85922583})
+
+	if q != "SELECT id, ST_AsBinary(geometry) FROM whosonfirst WHERE id IN (?,?)" {
+		t.Fatalf("Unexpected query: %s", q)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{int64(101736545), int64(85922583)}) {
+		t.Fatalf("Unexpected arguments: %v", args)
+	}
+}
@@ -0,0 +1,457 @@
+// Package spatial provides a spatial database for Who's On First records backed by the "geojson" and "whosonfirst"
+// tables of a MySQL database.
+//
+// The `MySQLSpatialDatabase` type mirrors the `SpatialDatabase` interface defined by the whosonfirst/go-whosonfirst-spatial
+// package (point-in-polygon and intersects queries returning standard places results, `IndexFeature` and `RemoveFeature`
+// methods and a `Read` method for retrieving records) but does not import that package directly. Applications using
+// go-whosonfirst-spatial can wrap it, and register it, with a thin adapter.
+package spatial
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/reader"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// MySQLSpatialDatabase is a spatial database for Who's On First records backed by the "geojson" and "whosonfirst" tables
+// of a MySQL database.
+type MySQLSpatialDatabase struct {
+	db     wof_sql.Database
+	tables []wof_sql.Table
+	reader *reader.MySQLReader
+	// Whether the database connection was created by (and should be closed by) the spatial database.
+	owns_db bool
+	// Whether spatial queries use the "whosonfirst_subdivided" table.
+	subdivided bool
+	// The "whosonfirst_belongsto" table which is indexed, and used by descendant queries, if the server does not support
+	// multi-valued indexes.
+	belongsto_table wof_sql.Table
+	// Whether the server supports multi-valued indexes. This is nil until it is determined by the `multiValued` method.
+	multi_valued *bool
+	mu           *sync.Mutex
+}
+
+// MySQLSpatialDatabaseOptions defines options for a `MySQLSpatialDatabase` instance.
+type MySQLSpatialDatabaseOptions struct {
+	// Subdivided indicates whether records should also be indexed in the "whosonfirst_subdivided" table and whether
+	// spatial queries should use that table, rather than the "whosonfirst" table's geometries, to find matching records.
+	Subdivided bool
+}
+
+// DefaultMySQLSpatialDatabaseOptions returns a new `MySQLSpatialDatabaseOptions` instance with default values.
+func DefaultMySQLSpatialDatabaseOptions() (*MySQLSpatialDatabaseOptions, error) {
+
+	opts := &MySQLSpatialDatabaseOptions{
+		Subdivided: false,
+	}
+
+	return opts, nil
+}
+
+// NewMySQLSpatialDatabase returns a new `MySQLSpatialDatabase` instance configured by 'uri' which is expected to take the form of:
+//
+//	mysql://?dsn={DSN}
+//
+// If the URI contains a `?subdivided=true` parameter records are also indexed in, and spatial queries use, the
+// "whosonfirst_subdivided" table.
+func NewMySQLSpatialDatabase(ctx context.Context, uri string) (*MySQLSpatialDatabase, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	dsn := q.Get("dsn")
+
+	if dsn == "" {
+		return nil, fmt.Errorf("Missing ?dsn= parameter")
+	}
+
+	opts, err := DefaultMySQLSpatialDatabaseOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default spatial database options, %w", err)
+	}
+
+	if q.Get("subdivided") != "" {
+
+		v, err := strconv.ParseBool(q.Get("subdivided"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?subdivided= parameter, %w", err)
+		}
+
+		opts.Subdivided = v
+	}
+
+	db_uri := fmt.Sprintf("mysql://?dsn=%s", url.QueryEscape(dsn))
+
+	db, err := wof_sql.NewSQLDB(ctx, db_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create database, %w", err)
+	}
+
+	spatial_db, err := NewMySQLSpatialDatabaseWithDatabaseAndOptions(ctx, db, opts)
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	spatial_db.owns_db = true
+	return spatial_db, nil
+}
+
+// NewMySQLSpatialDatabaseWithDatabase returns a new `MySQLSpatialDatabase` instance for 'db' with default options. 'db' is
+// not closed when the spatial database's `Disconnect` method is invoked. No tables are created or altered, so that the spatial
+// database can be used with a read-only connection; use the `InitializeTables` method to create the tables before indexing records.
+func NewMySQLSpatialDatabaseWithDatabase(ctx context.Context, db wof_sql.Database) (*MySQLSpatialDatabase, error) {
+
+	opts, err := DefaultMySQLSpatialDatabaseOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default spatial database options, %w", err)
+	}
+
+	return NewMySQLSpatialDatabaseWithDatabaseAndOptions(ctx, db, opts)
+}
+
+// NewMySQLSpatialDatabaseWithDatabaseAndOptions returns a new `MySQLSpatialDatabase` instance for 'db' configured by 'opts'.
+// 'db' is not closed when the spatial database's `Disconnect` method is invoked. As with `NewMySQLSpatialDatabaseWithDatabase`
+// no tables are created or altered.
+func NewMySQLSpatialDatabaseWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *MySQLSpatialDatabaseOptions) (*MySQLSpatialDatabase, error) {
+
+	geojson_table, err := tables.NewGeoJSONTable(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GeoJSON table, %w", err)
+	}
+
+	whosonfirst_table, err := tables.NewWhosonfirstTable(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Whosonfirst table, %w", err)
+	}
+
+	to_index := []wof_sql.Table{geojson_table, whosonfirst_table}
+
+	if opts.Subdivided {
+
+		subdivided_table, err := tables.NewSubdividedTable(ctx)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create subdivided table, %w", err)
+		}
+
+		to_index = append(to_index, subdivided_table)
+	}
+
+	belongsto_table, err := tables.NewBelongsToTable(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create belongsto table, %w", err)
+	}
+
+	r, err := reader.NewMySQLReaderWithDatabase(ctx, db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create reader, %w", err)
+	}
+
+	spatial_db := &MySQLSpatialDatabase{
+		db:              db,
+		tables:          to_index,
+		reader:          r,
+		subdivided:      opts.Subdivided,
+		belongsto_table: belongsto_table,
+		mu:              new(sync.Mutex),
+	}
+
+	return spatial_db, nil
+}
+
+// InitializeTables creates the "geojson", "whosonfirst" and (if necessary) "whosonfirst_subdivided" and "whosonfirst_belongsto"
+// tables, and updates their schemas, if necessary.
+func (spatial_db *MySQLSpatialDatabase) InitializeTables(ctx context.Context) error {
+
+	to_index, err := spatial_db.indexTables(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, t := range to_index {
+
+		err := t.InitializeTable(ctx, spatial_db.db)
+
+		if err != nil {
+			return fmt.Errorf("Failed to initialize %s table, %w", t.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// IndexFeature indexes 'body' in the "geojson", "whosonfirst" and (if necessary) "whosonfirst_subdivided" and
+// "whosonfirst_belongsto" tables in a single transaction. If 'body' has a "src:alt_label" property it is indexed as an
+// alternate geometry.
+func (spatial_db *MySQLSpatialDatabase) IndexFeature(ctx context.Context, body []byte) error {
+
+	args := make([]interface{}, 0)
+
+	alt_label, _ := properties.AltLabel(body)
+
+	if alt_label != "" {
+
+		uri_args, err := uri.NewAlternateURIArgsFromAltLabel(alt_label)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive alternate geometry from '%s', %w", alt_label, err)
+		}
+
+		args = append(args, uri_args.AltGeom)
+	}
+
+	to_index, err := spatial_db.indexTables(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: tables.DEFAULT_ISOLATION_LEVEL})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	for _, t := range to_index {
+
+		err := t.IndexFeature(ctx, tx, body, args...)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to index %s table, %w", t.Name(), err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFeature removes the record matching 'str_id', and all its alternate geometries, from each of the tables indexed
+// by the spatial database in a single transaction.
+func (spatial_db *MySQLSpatialDatabase) RemoveFeature(ctx context.Context, str_id string) error {
+
+	id, err := strconv.ParseInt(str_id, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("Failed to parse ID '%s', %w", str_id, err)
+	}
+
+	to_index, err := spatial_db.indexTables(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: tables.DEFAULT_ISOLATION_LEVEL})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	for _, t := range to_index {
+
+		table_name := t.Name()
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ?", table_name)
+
+		_, err := tx.ExecContext(ctx, q, id)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to remove %d from %s table, %w", id, table_name, err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+// indexTables returns the list of tables that records are indexed in. This includes the "whosonfirst_belongsto" table if
+// the server does not support multi-valued indexes.
+func (spatial_db *MySQLSpatialDatabase) indexTables(ctx context.Context) ([]wof_sql.Table, error) {
+
+	multi_valued, err := spatial_db.multiValued(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if multi_valued {
+		return spatial_db.tables, nil
+	}
+
+	to_index := append(slices.Clone(spatial_db.tables), spatial_db.belongsto_table)
+	return to_index, nil
+}
+
+// multiValued returns a boolean value indicating whether the server supports multi-valued indexes. The server is only
+// queried the first time this method is invoked (successfully) so that creating a spatial database does not require a
+// database connection.
+func (spatial_db *MySQLSpatialDatabase) multiValued(ctx context.Context) (bool, error) {
+
+	spatial_db.mu.Lock()
+	defer spatial_db.mu.Unlock()
+
+	if spatial_db.multi_valued != nil {
+		return *spatial_db.multi_valued, nil
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	supported, err := tables.SupportsMultiValuedIndexes(ctx, conn)
+
+	if err != nil {
+		return false, err
+	}
+
+	spatial_db.multi_valued = &supported
+	return supported, nil
+}
+
+// Read returns an `io.ReadSeekCloser` instance for the record matching 'path', which is expected to be a Who's On First
+// relative path.
+func (spatial_db *MySQLSpatialDatabase) Read(ctx context.Context, path string) (io.ReadSeekCloser, error) {
+	return spatial_db.reader.Read(ctx, path)
+}
+
+// Features returns the (decoded) bodies of the principal records, excluding alternate geometries, matching 'ids'
+// using a single query, keyed by ID. IDs without a matching record are not included in the result.
+func (spatial_db *MySQLSpatialDatabase) Features(ctx context.Context, ids []int64) (map[int64][]byte, error) {
+
+	features := make(map[int64][]byte)
+
+	if len(ids) == 0 {
+		return features, nil
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q, args := featuresStatement(ids)
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query database, %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var id int64
+		var body []byte
+		var codec string
+
+		err := rows.Scan(&id, &body, &codec)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		decoded, err := tables.DecodeBody(codec, body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode body for %d, %w", id, err)
+		}
+
+		features[id] = decoded
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return features, nil
+}
+
+// featuresStatement returns the SQL query, and its arguments, for selecting the principal records matching 'ids'
+// from the "geojson" table.
+func featuresStatement(ids []int64) (string, []interface{}) {
+
+	args := make([]interface{}, len(ids))
+
+	for idx, id := range ids {
+		args[idx] = id
+	}
+
+	q := fmt.Sprintf("SELECT id, body, %s FROM %s WHERE alt = '' AND id IN (%s)", tables.CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME, placeholders(len(ids)))
+
+	return q, args
+}
+
+// ReaderURI returns 'path' since records are identified by their relative paths.
+func (spatial_db *MySQLSpatialDatabase) ReaderURI(ctx context.Context, path string) string {
+	return spatial_db.reader.ReaderURI(ctx, path)
+}
+
+// Disconnect closes the underlying database connection if it was created by the spatial database.
+func (spatial_db *MySQLSpatialDatabase) Disconnect(ctx context.Context) error {
+
+	if !spatial_db.owns_db {
+		return nil
+	}
+
+	return spatial_db.db.Close()
+}
@@ -0,0 +1,96 @@
+package spatial
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+// DateRange is an inclusive range of time used to filter records by the dates they existed. A nil Start or End means
+// the range is open at that end.
+type DateRange struct {
+	Start *time.Time
+	End   *time.Time
+}
+
+// ValidAt returns a new `DateRange` instance for the single point in time 't'.
+func ValidAt(t time.Time) *DateRange {
+
+	r := &DateRange{
+		Start: &t,
+		End:   &t,
+	}
+
+	return r
+}
+
+// DateRangeFromEDTF returns a new `DateRange` instance spanning the earliest and latest times described by the EDTF
+// string 'edtf_str'. For example "1906-04-18" is that whole day and "1900/1910" is the years 1900 to 1910.
+func DateRangeFromEDTF(edtf_str string) (*DateRange, error) {
+
+	lower, upper, err := tables.EDTFBounds(edtf_str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lower == nil && upper == nil {
+		return nil, fmt.Errorf("EDTF string '%s' does not have any bounds", edtf_str)
+	}
+
+	r := &DateRange{
+		Start: lower,
+		End:   upper,
+	}
+
+	return r, nil
+}
+
+// where returns the SQL conditions, and their arguments, matching records that existed at any time during 'r'. Records
+// are matched using the "whosonfirst" table's "inception_lower" and "cessation_upper" columns and a NULL
+// value is treated as unbounded, so records whose inception or cessation dates are unknown are always matched.
+func (r *DateRange) where() ([]string, []interface{}) {
+
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if r.End != nil {
+		where = append(where, fmt.Sprintf("(%s IS NULL OR %s <= ?)", tables.INCEPTION_LOWER_COLUMN, tables.INCEPTION_LOWER_COLUMN))
+		args = append(args, r.End.Format(tables.DATE_FORMAT))
+	}
+
+	if r.Start != nil {
+		where = append(where, fmt.Sprintf("(%s IS NULL OR %s >= ?)", tables.CESSATION_UPPER_COLUMN, tables.CESSATION_UPPER_COLUMN))
+		args = append(args, r.Start.Format(tables.DATE_FORMAT))
+	}
+
+	return where, args
+}
+
+// LookupId returns the `StandardPlacesResult` for the record in the "whosonfirst" table whose ID is 'id' and which matches
+// all of 'filters'. If there is no matching record an error wrapping `fs.ErrNotExist` is returned.
+func (spatial_db *MySQLSpatialDatabase) LookupId(ctx context.Context, id int64, filters ...*Filters) (*StandardPlacesResult, error) {
+
+	where := []string{
+		"id = ?",
+	}
+
+	args := []interface{}{
+		id,
+	}
+
+	results, err := spatial_db.find(ctx, where, args, 1, filters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("No matching record for %d, %w", id, fs.ErrNotExist)
+	}
+
+	return results[0], nil
+}
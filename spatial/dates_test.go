@@ -0,0 +1,94 @@
+package spatial
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDateRangeFromEDTF(t *testing.T) {
+
+	tests := []struct {
+		edtf  string
+		start string
+		end   string
+		ok    bool
+	}{
+		{"1906-04-18", "1906-04-18", "1906-04-18", true},
+		{"1900/1910", "1900-01-01", "1910-12-31", true},
+		{"1906/..", "1906-01-01", "", true},
+		{"..", "", "", false},
+		{"tomorrow", "", "", false},
+	}
+
+	format := func(t *time.Time) string {
+
+		if t == nil {
+			return ""
+		}
+
+		return t.Format("2006-01-02")
+	}
+
+	for _, test := range tests {
+
+		r, err := DateRangeFromEDTF(test.edtf)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for '%s', %v", test.edtf, err)
+		}
+
+		if !test.ok {
+			continue
+		}
+
+		if format(r.Start) != test.start || format(r.End) != test.end {
+			t.Fatalf("Unexpected range for '%s': %s to %s", test.edtf, format(r.Start), format(r.End))
+		}
+	}
+}
+
+func TestDateRangeWhere(t *testing.T) {
+
+	start := time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(1910, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		r     *DateRange
+		where []string
+		args  []interface{}
+	}{
+		{
+			name:  "range",
+			r:     &DateRange{Start: &start, End: &end},
+			where: []string{"(inception_lower IS NULL OR inception_lower <= ?)", "(cessation_upper IS NULL OR cessation_upper >= ?)"},
+			args:  []interface{}{"1910-12-31", "1900-01-01"},
+		},
+		{
+			name:  "open end",
+			r:     &DateRange{Start: &start},
+			where: []string{"(cessation_upper IS NULL OR cessation_upper >= ?)"},
+			args:  []interface{}{"1900-01-01"},
+		},
+		{
+			name:  "valid at",
+			r:     ValidAt(end),
+			where: []string{"(inception_lower IS NULL OR inception_lower <= ?)", "(cessation_upper IS NULL OR cessation_upper >= ?)"},
+			args:  []interface{}{"1910-12-31", "1910-12-31"},
+		},
+	}
+
+	for _, test := range tests {
+
+		where, args := test.r.where()
+
+		if !reflect.DeepEqual(where, test.where) {
+			t.Fatalf("Unexpected conditions for %s: %v", test.name, where)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package spatial
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// Filters defines criteria for filtering the results of spatial queries. Empty values are ignored.
+type Filters struct {
+	// Placetypes is a list of placetypes that results must match.
+	Placetypes []string
+	// IsCurrent is a list of "mz:is_current" values (-1, 0 or 1) that results must match. Records without a "mz:is_current" property are treated as -1.
+	IsCurrent []int64
+	// IsCeased is a list of values (0 or 1) that the "whosonfirst" table's "is_ceased" column must match.
+	IsCeased []int64
+	// IsDeprecated is a list of values (0 or 1) that the "whosonfirst" table's "is_deprecated" column must match.
+	IsDeprecated []int64
+	// IsSuperseded is a list of values (0 or 1) that the "whosonfirst" table's "is_superseded" column must match.
+	IsSuperseded []int64
+	// IsSuperseding is a list of values (0 or 1) that the "whosonfirst" table's "is_superseding" column must match.
+	IsSuperseding []int64
+	// Properties is a dictionary of property names and the (JSON-encodable) values that results must match.
+	Properties map[string]interface{}
+	// ValidDuring is a range of time during which results must have existed.
+	ValidDuring *DateRange
+}
+
+// PointInPolygon returns the list of `StandardPlacesResult` instances for records in the "whosonfirst" table whose
+// geometries contain 'pt' and which match all of 'filters'.
+func (spatial_db *MySQLSpatialDatabase) PointInPolygon(ctx context.Context, pt *orb.Point, filters ...*Filters) ([]*StandardPlacesResult, error) {
+	return spatial_db.query(ctx, "ST_Contains", *pt, filters...)
+}
+
+// Intersects returns the list of `StandardPlacesResult` instances for records in the "whosonfirst" table whose
+// geometries intersect 'geom' and which match all of 'filters'.
+func (spatial_db *MySQLSpatialDatabase) Intersects(ctx context.Context, geom orb.Geometry, filters ...*Filters) ([]*StandardPlacesResult, error) {
+	return spatial_db.query(ctx, "ST_Intersects", geom, filters...)
+}
+
+// Search returns up to 'limit' `StandardPlacesResult` instances for records in the "whosonfirst" table whose "wof:name"
+// property starts with 'name' and which match all of 'filters'. Names are matched using the indexed "name" column, added
+// by `tables.EnsureNameColumn`, and so are compared using that column's collation which, for the default MySQL 8 collation,
+// is case-insensitive.
+func (spatial_db *MySQLSpatialDatabase) Search(ctx context.Context, name string, limit int, filters ...*Filters) ([]*StandardPlacesResult, error) {
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(name)
+
+	where := []string{
+		fmt.Sprintf("%s LIKE ?", tables.NAME_COLUMN),
+	}
+
+	args := []interface{}{
+		escaped + "%",
+	}
+
+	return spatial_db.find(ctx, where, args, limit, filters...)
+}
+
+// Descendants returns up to 'limit' `StandardPlacesResult` instances for records in the "whosonfirst" table whose
+// "wof:belongsto" property contains 'id' and which match all of 'filters'.
+func (spatial_db *MySQLSpatialDatabase) Descendants(ctx context.Context, id int64, limit int, filters ...*Filters) ([]*StandardPlacesResult, error) {
+
+	where, args, err := spatial_db.BelongsToConditions(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return spatial_db.find(ctx, where, args, limit, filters...)
+}
+
+// BelongsToConditions returns the SQL conditions, and their arguments, for matching records in the "whosonfirst" table
+// whose "wof:belongsto" property contains 'id'. If the server supports multi-valued indexes this is a `MEMBER OF` test
+// which uses the index on the "wof:belongsto" property. Otherwise records are matched using the "whosonfirst_belongsto"
+// table.
+func (spatial_db *MySQLSpatialDatabase) BelongsToConditions(ctx context.Context, id int64) ([]string, []interface{}, error) {
+
+	multi_valued, err := spatial_db.multiValued(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	where, args := belongsToConditions(id, multi_valued)
+	return where, args, nil
+}
+
+// belongsToConditions returns the SQL conditions, and their arguments, for matching records in the "whosonfirst" table
+// whose "wof:belongsto" property contains 'id' using either a `MEMBER OF` test, if 'multi_valued' is true, or the
+// "whosonfirst_belongsto" table.
+func belongsToConditions(id int64, multi_valued bool) ([]string, []interface{}) {
+
+	args := []interface{}{
+		id,
+	}
+
+	if multi_valued {
+
+		where := []string{
+			fmt.Sprintf("? MEMBER OF (%s)", tables.BELONGSTO_EXPRESSION),
+		}
+
+		return where, args
+	}
+
+	where := []string{
+		fmt.Sprintf("id IN (SELECT id FROM %s WHERE ancestor_id = ?)", tables.BELONGSTO_TABLE_NAME),
+	}
+
+	return where, args
+}
+
+// query returns the list of `StandardPlacesResult` instances for records in the "whosonfirst" table where 'spatial_func'
+// (a MySQL spatial relation function) is true for 'geom' and which match all of 'filters'.
+func (spatial_db *MySQLSpatialDatabase) query(ctx context.Context, spatial_func string, geom orb.Geometry, filters ...*Filters) ([]*StandardPlacesResult, error) {
+
+	where, args := spatial_db.spatialConditions(spatial_func, geom)
+	return spatial_db.find(ctx, where, args, 0, filters...)
+}
+
+// spatialConditions returns the SQL conditions, and their arguments, for testing whether 'spatial_func' (a MySQL
+// spatial relation function) is true for the "geometry" column and 'geom'. If the spatial database uses the
+// "whosonfirst_subdivided" table the conditions match the IDs of records with any tile that intersects 'geom'. For
+// points this is the same as `ST_Contains` except that points on the boundary of a geometry are also matched.
+func (spatial_db *MySQLSpatialDatabase) spatialConditions(spatial_func string, geom orb.Geometry) ([]string, []interface{}) {
+
+	wkt_geom := wkt.MarshalString(geom)
+
+	args := []interface{}{
+		wkt_geom,
+		wkt_geom,
+	}
+
+	// The MBRIntersects test allows the spatial index to be used before the (more expensive)
+	// exact test is performed.
+
+	if spatial_db.subdivided {
+
+		// Tiles are clipped from the original geometry so a geometry is matched by 'spatial_func'
+		// if any of its tiles intersect 'geom'. The tiles' bounding boxes are much smaller than
+		// those of the original geometries so the spatial index excludes far more rows. The tiles
+		// have an SRID of 4326 so 'geom' must have the same SRID for the comparison.
+
+		where := []string{
+			fmt.Sprintf("id IN (SELECT id FROM %s WHERE MBRIntersects(geometry, %s) AND ST_Intersects(geometry, %s))", tables.SUBDIVIDED_TABLE_NAME, tables.SUBDIVIDED_GEOMFROMTEXT, tables.SUBDIVIDED_GEOMFROMTEXT),
+		}
+
+		return where, args
+	}
+
+	where := []string{
+		"MBRIntersects(geometry, ST_GeomFromText(?))",
+		fmt.Sprintf("%s(geometry, ST_GeomFromText(?))", spatial_func),
+	}
+
+	return where, args
+}
+
+// applyFilters returns 'where' and 'args' with the SQL conditions, and their arguments, for 'filters' appended.
+func applyFilters(where []string, args []interface{}, filters ...*Filters) ([]string, []interface{}, error) {
+
+	for _, f := range filters {
+
+		f_where, f_args, err := f.where()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		where = append(where, f_where...)
+		args = append(args, f_args...)
+	}
+
+	return where, args, nil
+}
+
+// find returns up to 'limit' `StandardPlacesResult` instances for records in the "whosonfirst" table matching
+// all of 'where' and 'filters'. If 'limit' is less than or equal to zero all matching records are returned.
+func (spatial_db *MySQLSpatialDatabase) find(ctx context.Context, where []string, args []interface{}, limit int, filters ...*Filters) ([]*StandardPlacesResult, error) {
+
+	where, args, err := applyFilters(where, args, filters...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s", SPR_COLUMNS, wof_tables.WHOSONFIRST_TABLE_NAME, strings.Join(where, " AND "))
+
+	if limit > 0 {
+		q = fmt.Sprintf("%s LIMIT %d", q, limit)
+	}
+
+	conn, err := spatial_db.db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query database, %w", err)
+	}
+
+	defer rows.Close()
+
+	results := make([]*StandardPlacesResult, 0)
+
+	for rows.Next() {
+
+		spr, err := newStandardPlacesResult(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, spr)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return results, nil
+}
+
+// where returns the list of SQL conditions, and their arguments, for 'f'.
+func (f *Filters) where() ([]string, []interface{}, error) {
+
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if len(f.Placetypes) > 0 {
+
+		where = append(where, fmt.Sprintf("placetype IN (%s)", placeholders(len(f.Placetypes))))
+
+		for _, pt := range f.Placetypes {
+			args = append(args, pt)
+		}
+	}
+
+	if len(f.IsCurrent) > 0 {
+
+		where = append(where, fmt.Sprintf(`COALESCE(JSON_EXTRACT(properties, '$."mz:is_current"'), -1) IN (%s)`, placeholders(len(f.IsCurrent))))
+
+		for _, v := range f.IsCurrent {
+			args = append(args, v)
+		}
+	}
+
+	existential := []struct {
+		column string
+		values []int64
+	}{
+		{"is_ceased", f.IsCeased},
+		{"is_deprecated", f.IsDeprecated},
+		{"is_superseded", f.IsSuperseded},
+		{"is_superseding", f.IsSuperseding},
+	}
+
+	for _, e := range existential {
+
+		if len(e.values) == 0 {
+			continue
+		}
+
+		where = append(where, fmt.Sprintf("COALESCE(%s, 0) IN (%s)", e.column, placeholders(len(e.values))))
+
+		for _, v := range e.values {
+			args = append(args, v)
+		}
+	}
+
+	// Properties are sorted so that the same filters always produce the same query
+
+	keys := make([]string, 0, len(f.Properties))
+
+	for k := range f.Properties {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		v := f.Properties[k]
+
+		enc_v, err := json.Marshal(v)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to encode value for '%s' property, %w", k, err)
+		}
+
+		where = append(where, "JSON_EXTRACT(properties, ?) = CAST(? AS JSON)")
+		args = append(args, fmt.Sprintf(`$."%s"`, k), string(enc_v))
+	}
+
+	if f.ValidDuring != nil {
+
+		d_where, d_args := f.ValidDuring.where()
+
+		where = append(where, d_where...)
+		args = append(args, d_args...)
+	}
+
+	return where, args, nil
+}
+
+// placeholders returns a comma-separated list of 'count' "?" placeholders.
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", count), ",")
+}
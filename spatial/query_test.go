@@ -0,0 +1,108 @@
+package spatial
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFiltersWhere(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		filters *Filters
+		where   string
+		args    []interface{}
+	}{
+		{
+			name:    "empty",
+			filters: &Filters{},
+			where:   "",
+			args:    []interface{}{},
+		},
+		{
+			name:    "placetypes",
+			filters: &Filters{Placetypes: []string{"locality", "neighbourhood"}},
+			where:   "placetype IN (?,?)",
+			args:    []interface{}{"locality", "neighbourhood"},
+		},
+		{
+			name:    "is current",
+			filters: &Filters{IsCurrent: []int64{1, -1}},
+			where:   `COALESCE(JSON_EXTRACT(properties, '$."mz:is_current"'), -1) IN (?,?)`,
+			args:    []interface{}{int64(1), int64(-1)},
+		},
+		{
+			name:    "existential",
+			filters: &Filters{IsCeased: []int64{0}, IsSuperseding: []int64{1}},
+			where:   "COALESCE(is_ceased, 0) IN (?) AND COALESCE(is_superseding, 0) IN (?)",
+			args:    []interface{}{int64(0), int64(1)},
+		},
+		{
+			name: "properties",
+			filters: &Filters{Properties: map[string]interface{}{
+				"wof:repo":    "whosonfirst-data-admin-ca",
+				"iso:country": "CA",
+			}},
+			where: "JSON_EXTRACT(properties, ?) = CAST(? AS JSON) AND JSON_EXTRACT(properties, ?) = CAST(? AS JSON)",
+			args:  []interface{}{`$."iso:country"`, `"CA"`, `$."wof:repo"`, `"whosonfirst-data-admin-ca"`},
+		},
+		{
+			name:    "combined",
+			filters: &Filters{Placetypes: []string{"region"}, IsDeprecated: []int64{0}, Properties: map[string]interface{}{"wof:parent_id": 85633041}},
+			where:   "placetype IN (?) AND COALESCE(is_deprecated, 0) IN (?) AND JSON_EXTRACT(properties, ?) = CAST(? AS JSON)",
+			args:    []interface{}{"region", int64(0), `$."wof:parent_id"`, "85633041"},
+		},
+	}
+
+	for _, test := range tests {
+
+		where, args, err := test.filters.where()
+
+		if err != nil {
+			t.Fatalf("Failed to derive conditions for %s, %v", test.name, err)
+		}
+
+		str_where := strings.Join(where, " AND ")
+
+		if str_where != test.where {
+			t.Fatalf("Unexpected conditions for %s: %s", test.name, str_where)
+		}
+
+		if !reflect.DeepEqual(args, test.args) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+	}
+
+	f := &Filters{Properties: map[string]interface{}{"invalid": func() {}}}
+
+	_, _, err := f.where()
+
+	if err == nil {
+		t.Fatalf("Expected a property value that can not be encoded to fail")
+	}
+}
+
+func TestBelongsToConditions(t *testing.T) {
+
+	tests := []struct {
+		multi_valued bool
+		where        string
+	}{
+		{true, `? MEMBER OF (properties->'$."wof:belongsto"')`},
+		{false, "id IN (SELECT id FROM whosonfirst_belongsto WHERE ancestor_id = ?)"},
+	}
+
+	for _, test := range tests {
+
+		where, args := belongsToConditions(85633041, test.multi_valued)
+
+		if strings.Join(where, " AND ") != test.where {
+			t.Fatalf("Unexpected conditions for multi_valued=%t: %v", test.multi_valued, where)
+		}
+
+		if !reflect.DeepEqual(args, []interface{}{int64(85633041)}) {
+			t.Fatalf("Unexpected arguments for multi_valued=%t: %v", test.multi_valued, args)
+		}
+	}
+}
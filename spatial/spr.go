@@ -0,0 +1,131 @@
+package spatial
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/tidwall/gjson"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// StandardPlacesResult is a "standard places result" (SPR) for a Who's On First record. Its fields, and their
+// JSON encodings, match the `WOFStandardPlacesResult` type defined by the whosonfirst/go-whosonfirst-spr package.
+type StandardPlacesResult struct {
+	EDTFInception   string  `json:"edtf:inception"`
+	EDTFCessation   string  `json:"edtf:cessation"`
+	WOFId           int64   `json:"wof:id"`
+	WOFParentId     int64   `json:"wof:parent_id"`
+	WOFName         string  `json:"wof:name"`
+	WOFCountry      string  `json:"wof:country"`
+	WOFPlacetype    string  `json:"wof:placetype"`
+	MZLatitude      float64 `json:"mz:latitude"`
+	MZLongitude     float64 `json:"mz:longitude"`
+	MZMinLatitude   float64 `json:"mz:min_latitude"`
+	MZMinLongitude  float64 `json:"mz:min_longitude"`
+	MZMaxLatitude   float64 `json:"mz:max_latitude"`
+	MZMaxLongitude  float64 `json:"mz:max_longitude"`
+	MZIsCurrent     int64   `json:"mz:is_current"`
+	MZIsCeased      int64   `json:"mz:is_ceased"`
+	MZIsDeprecated  int64   `json:"mz:is_deprecated"`
+	MZIsSuperseded  int64   `json:"mz:is_superseded"`
+	MZIsSuperseding int64   `json:"mz:is_superseding"`
+	WOFSupersedes   []int64 `json:"wof:supersedes"`
+	WOFSupersededBy []int64 `json:"wof:superseded_by"`
+	WOFBelongsTo    []int64 `json:"wof:belongsto"`
+	WOFPath         string  `json:"wof:path"`
+	WOFRepo         string  `json:"wof:repo"`
+	WOFLastModified int64   `json:"wof:lastmodified"`
+}
+
+// SPR_COLUMNS are the columns in the "whosonfirst" table used to derive a `StandardPlacesResult`. They are expected
+// to be scanned by the `newStandardPlacesResult` function.
+const SPR_COLUMNS string = "id, properties, ST_X(centroid), ST_Y(centroid), ST_AsText(ST_Envelope(geometry)), is_ceased, is_deprecated, is_superseded, is_superseding, lastmodified"
+
+// scanner is the interface shared by `sql.Row` and `sql.Rows` for copying columns in to values.
+type scanner interface {
+	Scan(...any) error
+}
+
+// newStandardPlacesResult returns a new `StandardPlacesResult` instance derived from 'row' whose columns are
+// expected to match `SPR_COLUMNS`.
+func newStandardPlacesResult(row scanner) (*StandardPlacesResult, error) {
+
+	var id int64
+	var props []byte
+	var lon float64
+	var lat float64
+	var envelope string
+	var is_ceased sql.NullInt64
+	var is_deprecated sql.NullInt64
+	var is_superseded sql.NullInt64
+	var is_superseding sql.NullInt64
+	var lastmod int64
+
+	err := row.Scan(&id, &props, &lon, &lat, &envelope, &is_ceased, &is_deprecated, &is_superseded, &is_superseding, &lastmod)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan row, %w", err)
+	}
+
+	geom, err := wkt.Unmarshal(envelope)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse envelope for %d, %w", id, err)
+	}
+
+	bounds := geom.Bound()
+
+	path, err := uri.Id2RelPath(id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive path for %d, %w", id, err)
+	}
+
+	is_current := int64(-1)
+
+	if rsp := gjson.GetBytes(props, "mz:is_current"); rsp.Exists() {
+		is_current = rsp.Int()
+	}
+
+	spr := &StandardPlacesResult{
+		EDTFInception:   gjson.GetBytes(props, "edtf:inception").String(),
+		EDTFCessation:   gjson.GetBytes(props, "edtf:cessation").String(),
+		WOFId:           id,
+		WOFParentId:     gjson.GetBytes(props, "wof:parent_id").Int(),
+		WOFName:         gjson.GetBytes(props, "wof:name").String(),
+		WOFCountry:      gjson.GetBytes(props, "wof:country").String(),
+		WOFPlacetype:    gjson.GetBytes(props, "wof:placetype").String(),
+		MZLatitude:      lat,
+		MZLongitude:     lon,
+		MZMinLatitude:   bounds.Min.Lat(),
+		MZMinLongitude:  bounds.Min.Lon(),
+		MZMaxLatitude:   bounds.Max.Lat(),
+		MZMaxLongitude:  bounds.Max.Lon(),
+		MZIsCurrent:     is_current,
+		MZIsCeased:      is_ceased.Int64,
+		MZIsDeprecated:  is_deprecated.Int64,
+		MZIsSuperseded:  is_superseded.Int64,
+		MZIsSuperseding: is_superseding.Int64,
+		WOFSupersedes:   int64Values(props, "wof:supersedes"),
+		WOFSupersededBy: int64Values(props, "wof:superseded_by"),
+		WOFBelongsTo:    int64Values(props, "wof:belongsto"),
+		WOFPath:         path,
+		WOFRepo:         gjson.GetBytes(props, "wof:repo").String(),
+		WOFLastModified: lastmod,
+	}
+
+	return spr, nil
+}
+
+// int64Values returns the list of integer values for 'path' in 'props'.
+func int64Values(props []byte, path string) []int64 {
+
+	values := make([]int64, 0)
+
+	for _, r := range gjson.GetBytes(props, path).Array() {
+		values = append(values, r.Int())
+	}
+
+	return values
+}
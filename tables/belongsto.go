@@ -0,0 +1,337 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the multi-valued index on the "wof:belongsto" property of the "whosonfirst" table.
+const BELONGSTO_INDEX_NAME string = "idx_belongsto"
+
+// The name of the table mapping records to the IDs in their "wof:belongsto" property, for servers that do not support
+// multi-valued indexes.
+const BELONGSTO_TABLE_NAME string = "whosonfirst_belongsto"
+
+// The JSON expression for the "wof:belongsto" property of the "whosonfirst" table. Queries must use this exact
+// expression (for example `? MEMBER OF (...)`) for the multi-valued index to be used.
+const BELONGSTO_EXPRESSION string = `properties->'$."wof:belongsto"'`
+
+const belongsto_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      id BIGINT UNSIGNED NOT NULL,
+      ancestor_id BIGINT UNSIGNED NOT NULL,
+      PRIMARY KEY (ancestor_id, id),
+      KEY id (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+// BelongsToTable maps Who's On First records to each of the IDs in their "wof:belongsto" property. It is used to find the
+// descendants of a record on servers that do not support multi-valued indexes (see `SupportsMultiValuedIndexes`).
+type BelongsToTable struct {
+	*tableIndexer
+	options *BelongsToTableOptions
+}
+
+// BelongsToTableOptions defines options for indexing records in the "whosonfirst_belongsto" table.
+type BelongsToTableOptions struct {
+	IndexOptions
+}
+
+// DefaultBelongsToTableOptions returns a new `BelongsToTableOptions` instance with default values.
+func DefaultBelongsToTableOptions() (*BelongsToTableOptions, error) {
+
+	opts := &BelongsToTableOptions{
+		IndexOptions: defaultIndexOptions(),
+	}
+
+	return opts, nil
+}
+
+func NewBelongsToTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
+
+	opts, err := DefaultBelongsToTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default belongsto table options, %w", err)
+	}
+
+	return NewBelongsToTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewBelongsToTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *BelongsToTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewBelongsToTableWithOptions(ctx, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new belongsto table, %w", err)
+	}
+
+	err = t.InitializeTable(ctx, db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize belongsto table, %w", err)
+	}
+
+	return t, nil
+}
+
+func NewBelongsToTable(ctx context.Context) (wof_sql.Table, error) {
+
+	opts, err := DefaultBelongsToTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default belongsto table options, %w", err)
+	}
+
+	return NewBelongsToTableWithOptions(ctx, opts)
+}
+
+func NewBelongsToTableWithOptions(ctx context.Context, opts *BelongsToTableOptions) (wof_sql.Table, error) {
+
+	t := &BelongsToTable{
+		options: opts,
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
+}
+
+func (t *BelongsToTable) Name() string {
+	return BELONGSTO_TABLE_NAME
+}
+
+func (t *BelongsToTable) Schema() string {
+	return fmt.Sprintf(belongsto_schema, BELONGSTO_TABLE_NAME)
+}
+
+func (t *BelongsToTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
+	return wof_sql.CreateTableIfNecessary(ctx, db, t)
+}
+
+// indexFeature replaces the ancestors for 'body' using 'ex'. Since a record is stored as multiple rows 'ex' should be a
+// `sql.Tx` instance if other clients are reading the table.
+func (t *BelongsToTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	id, ancestors, err := t.ancestors(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if id == -1 {
+		return nil, nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+
+	// Remove any existing rows first since the record may no longer belong to some of its
+	// previous ancestors.
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = ?", BELONGSTO_TABLE_NAME)
+
+	span.AddEvent("delete")
+
+	del_rsp, err := ex.ExecContext(ctx, q, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to remove existing ancestors, %w", err)
+	}
+
+	if len(ancestors) > 0 {
+
+		span.AddEvent("insert")
+
+		stmt := t.newStatement(id, ancestors)
+
+		_, err = ex.ExecContext(ctx, stmt.Query, stmt.Args...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update table, %w", err)
+		}
+	}
+
+	deleted, _ := del_rsp.RowsAffected()
+
+	rsp := &multiRowResult{
+		replaced: deleted > 0,
+	}
+
+	return rsp, nil
+}
+
+// PrepareStatement returns the `Statement` used to insert the ancestors of 'body' in the table, or nil if 'body' should
+// not be indexed in the table or has no ancestors. Existing rows for the record are deleted before the statement is executed.
+func (t *BelongsToTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
+
+	id, ancestors, err := t.ancestors(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if id == -1 || len(ancestors) == 0 {
+		return nil, nil
+	}
+
+	stmt := t.newStatement(id, ancestors)
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// ancestors returns the ID of 'body' and the unique, positive, IDs in its "wof:belongsto" property. If 'body' is an
+// alternate geometry, which is not indexed, the ID is -1.
+func (t *BelongsToTable) ancestors(ctx context.Context, body []byte, custom ...interface{}) (int64, []int64, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return -1, nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	var alt *uri.AltGeom
+
+	if len(custom) >= 1 {
+		alt = custom[0].(*uri.AltGeom)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
+	if alt != nil {
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return -1, nil, nil
+	}
+
+	ancestors := make([]int64, 0)
+
+	for _, ancestor_id := range properties.BelongsTo(body) {
+
+		if ancestor_id > 0 && !slices.Contains(ancestors, ancestor_id) {
+			ancestors = append(ancestors, ancestor_id)
+		}
+	}
+
+	return id, ancestors, nil
+}
+
+func (t *BelongsToTable) newStatement(id int64, ancestors []int64) *Statement {
+
+	values := make([]string, len(ancestors))
+	args := make([]interface{}, 0)
+
+	for idx, ancestor_id := range ancestors {
+		values[idx] = "(?, ?)"
+		args = append(args, id, ancestor_id)
+	}
+
+	q := fmt.Sprintf(`INSERT INTO %s (
+		id, ancestor_id
+	) VALUES %s`, BELONGSTO_TABLE_NAME, strings.Join(values, ", "))
+
+	stmt := &Statement{
+		Query: q,
+		Args:  args,
+	}
+
+	return stmt
+}
+
+// SupportsMultiValuedIndexes returns a boolean value indicating whether the database server supports multi-valued
+// indexes, which were introduced in MySQL 8.0.17. MariaDB does not support them.
+func SupportsMultiValuedIndexes(ctx context.Context, q Querier) (bool, error) {
+
+	var version string
+
+	err := q.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version)
+
+	if err != nil {
+		return false, fmt.Errorf("Failed to determine server version, %w", err)
+	}
+
+	return versionSupportsMultiValuedIndexes(version)
+}
+
+// versionSupportsMultiValuedIndexes returns a boolean value indicating whether the server 'version', as reported by
+// MySQL's `VERSION()` function, supports multi-valued indexes.
+func versionSupportsMultiValuedIndexes(version string) (bool, error) {
+
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false, nil
+	}
+
+	// Versions look like "8.0.35" or "8.0.35-0ubuntu0.22.04.1"
+
+	version, _, _ = strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+
+	numbers := make([]int, 3)
+
+	for idx, str_n := range parts {
+
+		if idx >= len(numbers) {
+			break
+		}
+
+		n, err := strconv.Atoi(str_n)
+
+		if err != nil {
+			return false, fmt.Errorf("Failed to parse server version '%s', %w", version, err)
+		}
+
+		numbers[idx] = n
+	}
+
+	return slices.Compare(numbers, []int{8, 0, 17}) >= 0, nil
+}
+
+// EnsureBelongsToIndex adds a multi-valued index on the "wof:belongsto" property to the "whosonfirst" table if it does not
+// already exist. Callers should ensure that the server supports multi-valued indexes (see `SupportsMultiValuedIndexes`).
+func EnsureBelongsToIndex(ctx context.Context, db wof_sql.Database) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?"
+
+	var count int
+
+	err = conn.QueryRowContext(ctx, q, wof_tables.WHOSONFIRST_TABLE_NAME, BELONGSTO_INDEX_NAME).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine whether %s index exists, %w", BELONGSTO_INDEX_NAME, err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE %s ADD INDEX %s ((CAST(%s AS UNSIGNED ARRAY)))", wof_tables.WHOSONFIRST_TABLE_NAME, BELONGSTO_INDEX_NAME, BELONGSTO_EXPRESSION)
+
+	_, err = conn.ExecContext(ctx, alter)
+
+	if err != nil {
+		return fmt.Errorf("Failed to add %s index, %w", BELONGSTO_INDEX_NAME, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package tables
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+func TestVersionSupportsMultiValuedIndexes(t *testing.T) {
+
+	tests := []struct {
+		version  string
+		expected bool
+		ok       bool
+	}{
+		{"8.0.17", true, true},
+		{"8.0.35-0ubuntu0.22.04.1", true, true},
+		{"8.4.0", true, true},
+		{"9.1.0", true, true},
+		{"8.0.16", false, true},
+		{"5.7.44-log", false, true},
+		{"10.11.6-MariaDB-0+deb12u1", false, true},
+		{"8", false, true},
+		{"eight.0.17", false, false},
+	}
+
+	for _, test := range tests {
+
+		v, err := versionSupportsMultiValuedIndexes(test.version)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for '%s', %v", test.version, err)
+		}
+
+		if v != test.expected {
+			t.Fatalf("Expected %t for '%s', got %t", test.expected, test.version, v)
+		}
+	}
+}
+
+func TestBelongsToTablePrepareStatement(t *testing.T) {
+
+	ctx := context.Background()
+
+	tbl, err := NewBelongsToTable(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to create table, %v", err)
+	}
+
+	alt := &uri.AltGeom{
+		Source: "quattroshapes",
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		custom []interface{}
+		args   []interface{}
+	}{
+		// Ancestors are deduplicated and IDs which are not positive are ignored
+		{"ancestors", `{"properties":{"wof:id":101736545,"wof:belongsto":[85633041,102191575,85633041,-1,0]}}`, nil, []interface{}{int64(101736545), int64(85633041), int64(101736545), int64(102191575)}},
+		{"no ancestors", `{"properties":{"wof:id":102191575,"wof:belongsto":[]}}`, nil, nil},
+		{"alternate", `{"properties":{"wof:id":101736545,"wof:belongsto":[85633041]}}`, []interface{}{alt}, nil},
+	}
+
+	for _, test := range tests {
+
+		stmt, err := tbl.(StatementTable).PrepareStatement(ctx, []byte(test.body), test.custom...)
+
+		if err != nil {
+			t.Fatalf("Failed to prepare statement for %s, %v", test.name, err)
+		}
+
+		if test.args == nil {
+
+			if stmt != nil {
+				t.Fatalf("Expected no statement for %s, got %s", test.name, stmt.Query)
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(stmt.Args, test.args) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, stmt.Args)
+		}
+	}
+
+	_, err = tbl.(StatementTable).PrepareStatement(ctx, []byte(`{"properties":{}}`))
+
+	if err == nil {
+		t.Fatalf("Expected a record without an ID to fail")
+	}
+}
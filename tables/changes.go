@@ -0,0 +1,644 @@
+package tables
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/tidwall/gjson"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the (outbox) table where change events for the records in the "geojson" table are recorded.
+const CHANGES_TABLE_NAME string = "wof_changes"
+
+// The name of the table where consumers of the "wof_changes" table record the last event they have processed.
+const CHANGES_CURSORS_TABLE_NAME string = "wof_changes_cursors"
+
+// CHANGE_INSERT is the operation for change events recording records that did not previously exist.
+const CHANGE_INSERT string = "insert"
+
+// CHANGE_UPDATE is the operation for change events recording records that replaced an existing version.
+const CHANGE_UPDATE string = "update"
+
+const changes_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      seq BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+      id BIGINT UNSIGNED NOT NULL,
+      alt VARCHAR(255) NOT NULL,
+      operation VARCHAR(16) NOT NULL,
+      old_lastmodified INT,
+      new_lastmodified INT NOT NULL,
+      properties JSON NOT NULL,
+      geometry_changed TINYINT NOT NULL DEFAULT 0,
+      created INT NOT NULL,
+      PRIMARY KEY (seq),
+      KEY id_alt (id, alt),
+      KEY created (created)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+const changes_cursors_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      name VARCHAR(255) NOT NULL,
+      seq BIGINT UNSIGNED NOT NULL,
+      gap_from BIGINT UNSIGNED NULL,
+      gap_to BIGINT UNSIGNED NULL,
+      gap_first_seen INT NULL,
+      lastmodified INT NOT NULL,
+      PRIMARY KEY (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+// Change is an event recorded in the "wof_changes" table.
+type Change struct {
+	// Seq is the (increasing) sequence number of the event.
+	Seq int64 `json:"seq"`
+	// Id is the ID of the record that changed.
+	Id int64 `json:"id"`
+	// Alt is the string representation of the alternate geometry label of the record that changed, if present.
+	Alt string `json:"alt,omitempty"`
+	// Operation is the kind of change; one of `CHANGE_INSERT` or `CHANGE_UPDATE`.
+	Operation string `json:"operation"`
+	// OldLastModified is the "wof:lastmodified" property of the version that was replaced, if present.
+	OldLastModified *int64 `json:"old_lastmodified,omitempty"`
+	// NewLastModified is the "wof:lastmodified" property of the new version.
+	NewLastModified int64 `json:"new_lastmodified"`
+	// Properties are the names of the top-level properties that were added, removed or modified. For new records
+	// this is all of the record's properties.
+	Properties []string `json:"properties"`
+	// GeometryChanged indicates whether the record's geometry was added or modified.
+	GeometryChanged bool `json:"geometry_changed"`
+	// Created is the Unix timestamp when the event was recorded.
+	Created int64 `json:"created"`
+}
+
+// ChangesTable records change events for the records in the "geojson" table. The event for a record is derived by
+// comparing it with the existing version in the "geojson" table so, like the `HistoryTable`, the table must be indexed
+// before the "geojson" table and in the same transaction. Records that are identical to their existing version are skipped.
+type ChangesTable struct {
+	*tableIndexer
+	options *ChangesTableOptions
+}
+
+// ChangesTableOptions defines options for indexing records in the "wof_changes" table.
+type ChangesTableOptions struct {
+	IndexOptions
+}
+
+// DefaultChangesTableOptions returns a new `ChangesTableOptions` instance with default values.
+func DefaultChangesTableOptions() (*ChangesTableOptions, error) {
+
+	opts := &ChangesTableOptions{
+		IndexOptions: defaultIndexOptions(),
+	}
+
+	return opts, nil
+}
+
+func NewChangesTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
+
+	opts, err := DefaultChangesTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default changes table options, %w", err)
+	}
+
+	return NewChangesTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewChangesTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *ChangesTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewChangesTableWithOptions(ctx, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new changes table, %w", err)
+	}
+
+	err = t.InitializeTable(ctx, db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize changes table, %w", err)
+	}
+
+	return t, nil
+}
+
+func NewChangesTable(ctx context.Context) (wof_sql.Table, error) {
+
+	opts, err := DefaultChangesTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default changes table options, %w", err)
+	}
+
+	return NewChangesTableWithOptions(ctx, opts)
+}
+
+func NewChangesTableWithOptions(ctx context.Context, opts *ChangesTableOptions) (wof_sql.Table, error) {
+
+	t := &ChangesTable{
+		options: opts,
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
+}
+
+func (t *ChangesTable) Name() string {
+	return CHANGES_TABLE_NAME
+}
+
+func (t *ChangesTable) Schema() string {
+	return fmt.Sprintf(changes_schema, CHANGES_TABLE_NAME)
+}
+
+// InitializeTable creates the "wof_changes" table if necessary. The "geojson" table's "codec" column, which is needed
+// to read existing versions, is also added if it is missing.
+func (t *ChangesTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
+
+	err := wof_sql.CreateTableIfNecessary(ctx, db, t)
+
+	if err != nil {
+		return err
+	}
+
+	return EnsureCodecColumn(ctx, db)
+}
+
+// indexFeature records the change event for 'body' using 'ex', which must also implement the `Querier` interface in
+// order to read the existing version of 'body'.
+func (t *ChangesTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	q, ok := ex.(Querier)
+
+	if !ok {
+		return nil, fmt.Errorf("Execer does not support querying rows")
+	}
+
+	id, str_alt, err := t.changeKey(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("select")
+
+	// Lock the existing row so that concurrent updates to the same record are recorded in the order they are committed.
+
+	query := fmt.Sprintf("SELECT body, %s FROM %s WHERE id = ? AND alt = ? FOR UPDATE", CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME)
+
+	var enc_body []byte
+	var codec string
+
+	var previous []byte
+
+	err = q.QueryRowContext(ctx, query, id, str_alt).Scan(&enc_body, &codec)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// pass
+	case err != nil:
+		return nil, fmt.Errorf("Failed to read existing record, %w", err)
+	default:
+
+		previous, err = DecodeBody(codec, enc_body)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := DeriveChange(previous, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return nil, nil
+	}
+
+	c.Id = id
+	c.Alt = str_alt
+
+	stmt, err := t.newStatement(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	span.AddEvent("insert")
+
+	rsp, err := ex.ExecContext(ctx, stmt.Query, stmt.Args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update changes table, %w", err)
+	}
+
+	return rsp, nil
+}
+
+// PrepareStatement returns the `Statement` used to record 'body' as a new record in the table. Since the existing
+// version of 'body' is not read the statement for records that replace an existing version will differ.
+func (t *ChangesTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
+
+	id, str_alt, err := t.changeKey(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := DeriveChange(nil, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Id = id
+	c.Alt = str_alt
+
+	stmt, err := t.newStatement(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// newStatement returns the `Statement` used to insert 'c' in the table.
+func (t *ChangesTable) newStatement(c *Change) (*Statement, error) {
+
+	enc_props, err := json.Marshal(c.Properties)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal changed properties, %w", err)
+	}
+
+	var old_lastmod interface{}
+
+	if c.OldLastModified != nil {
+		old_lastmod = *c.OldLastModified
+	}
+
+	q := fmt.Sprintf(`INSERT INTO %s (
+		id, alt, operation, old_lastmodified, new_lastmodified, properties, geometry_changed, created
+	) VALUES (
+		?, ?, ?, ?, ?, ?, ?, ?
+	)`, CHANGES_TABLE_NAME)
+
+	stmt := &Statement{
+		Query: q,
+		Args:  []interface{}{c.Id, c.Alt, c.Operation, old_lastmod, c.NewLastModified, string(enc_props), c.GeometryChanged, time.Now().Unix()},
+	}
+
+	return stmt, nil
+}
+
+// changeKey returns the ID of 'body' and the string representation of its alternate geometry label, if present.
+func (t *ChangesTable) changeKey(ctx context.Context, body []byte, custom ...interface{}) (int64, string, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
+	var alt *uri.AltGeom
+
+	if len(custom) >= 1 {
+		alt = custom[0].(*uri.AltGeom)
+	}
+
+	if alt == nil {
+		return id, "", nil
+	}
+
+	str_alt, err := alt.String()
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to stringify alt, %w", err)
+	}
+
+	span.SetAttributes(tracing.ATTRIBUTE_ALT.String(str_alt))
+
+	return id, str_alt, nil
+}
+
+// DeriveChange returns the `Change` describing the differences between 'previous' and 'body', or nil if they have the
+// same properties and geometry. If 'previous' is nil the change is a `CHANGE_INSERT` operation. The Id, Alt, Seq and
+// Created properties of the change are not assigned.
+func DeriveChange(previous []byte, body []byte) (*Change, error) {
+
+	c := &Change{
+		Operation:       CHANGE_INSERT,
+		NewLastModified: properties.LastModified(body),
+		Properties:      make([]string, 0),
+	}
+
+	new_props, err := topLevelProperties(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil {
+
+		for k := range new_props {
+			c.Properties = append(c.Properties, k)
+		}
+
+		slices.Sort(c.Properties)
+
+		c.GeometryChanged = gjson.GetBytes(body, "geometry").Exists()
+		return c, nil
+	}
+
+	old_props, err := topLevelProperties(previous)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Operation = CHANGE_UPDATE
+
+	old_lastmod := properties.LastModified(previous)
+	c.OldLastModified = &old_lastmod
+
+	for k, new_v := range new_props {
+
+		old_v, exists := old_props[k]
+
+		if !exists || !reflect.DeepEqual(old_v, new_v) {
+			c.Properties = append(c.Properties, k)
+		}
+	}
+
+	for k := range old_props {
+
+		_, exists := new_props[k]
+
+		if !exists {
+			c.Properties = append(c.Properties, k)
+		}
+	}
+
+	slices.Sort(c.Properties)
+
+	c.GeometryChanged, err = geometryChanged(previous, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Properties) == 0 && !c.GeometryChanged {
+		return nil, nil
+	}
+
+	return c, nil
+}
+
+// topLevelProperties returns the decoded top-level properties of 'body'.
+func topLevelProperties(body []byte) (map[string]interface{}, error) {
+
+	props := make(map[string]interface{})
+
+	rsp := gjson.GetBytes(body, "properties")
+
+	if !rsp.Exists() {
+		return props, nil
+	}
+
+	err := json.Unmarshal([]byte(rsp.Raw), &props)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode properties, %w", err)
+	}
+
+	return props, nil
+}
+
+// geometryChanged returns a boolean value indicating whether the (compacted) geometries of 'previous' and 'body' differ.
+func geometryChanged(previous []byte, body []byte) (bool, error) {
+
+	compact := func(body []byte) ([]byte, error) {
+
+		var buf bytes.Buffer
+
+		raw := gjson.GetBytes(body, "geometry").Raw
+
+		if raw == "" {
+			return buf.Bytes(), nil
+		}
+
+		err := json.Compact(&buf, []byte(raw))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compact geometry, %w", err)
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	old_geom, err := compact(previous)
+
+	if err != nil {
+		return false, err
+	}
+
+	new_geom, err := compact(body)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(old_geom, new_geom), nil
+}
+
+// ReadChanges returns up to 'limit' events from the "wof_changes" table whose sequence number is greater than 'after',
+// ordered by sequence number.
+func ReadChanges(ctx context.Context, db wof_sql.Database, after int64, limit int) ([]*Change, error) {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := fmt.Sprintf(`SELECT seq, id, alt, operation, old_lastmodified, new_lastmodified, properties, geometry_changed, created
+		FROM %s WHERE seq > ? ORDER BY seq ASC LIMIT ?`, CHANGES_TABLE_NAME)
+
+	rows, err := conn.QueryContext(ctx, q, after, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query changes, %w", err)
+	}
+
+	defer rows.Close()
+
+	changes := make([]*Change, 0)
+
+	for rows.Next() {
+
+		var c Change
+		var old_lastmod sql.NullInt64
+		var enc_props []byte
+
+		err := rows.Scan(&c.Seq, &c.Id, &c.Alt, &c.Operation, &old_lastmod, &c.NewLastModified, &enc_props, &c.GeometryChanged, &c.Created)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan change, %w", err)
+		}
+
+		if old_lastmod.Valid {
+			c.OldLastModified = &old_lastmod.Int64
+		}
+
+		err = json.Unmarshal(enc_props, &c.Properties)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode properties for change %d, %w", c.Seq, err)
+		}
+
+		changes = append(changes, &c)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate changes, %w", err)
+	}
+
+	return changes, nil
+}
+
+// EnsureChangesCursorsTable creates the "wof_changes_cursors" table in 'db' if it is not already present.
+func EnsureChangesCursorsTable(ctx context.Context, db wof_sql.Database) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(changes_cursors_schema, CHANGES_CURSORS_TABLE_NAME))
+
+	if err != nil {
+		return fmt.Errorf("Failed to create %s table, %w", CHANGES_CURSORS_TABLE_NAME, err)
+	}
+
+	return nil
+}
+
+// ChangesGap is a range of sequence numbers, missing from the "wof_changes" table, that a consumer is waiting for.
+type ChangesGap struct {
+	// From is the first missing sequence number.
+	From int64
+	// To is the last missing sequence number.
+	To int64
+	// FirstSeen is the Unix timestamp when the consumer first noticed the range was missing.
+	FirstSeen int64
+}
+
+// ChangesCursor returns the sequence number of the last event processed by the consumer 'name', or 0 if it has not
+// processed any events, and the range of missing sequence numbers it is waiting for, or nil if there isn't one.
+func ChangesCursor(ctx context.Context, q Querier, name string) (int64, *ChangesGap, error) {
+
+	query := fmt.Sprintf("SELECT seq, gap_from, gap_to, gap_first_seen FROM %s WHERE name = ?", CHANGES_CURSORS_TABLE_NAME)
+
+	var seq int64
+	var gap_from sql.NullInt64
+	var gap_to sql.NullInt64
+	var gap_first_seen sql.NullInt64
+
+	err := q.QueryRowContext(ctx, query, name).Scan(&seq, &gap_from, &gap_to, &gap_first_seen)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, nil, nil
+	case err != nil:
+		return 0, nil, fmt.Errorf("Failed to read cursor for %s, %w", name, err)
+	}
+
+	if !gap_from.Valid || !gap_to.Valid || !gap_first_seen.Valid {
+		return seq, nil, nil
+	}
+
+	g := &ChangesGap{
+		From:      gap_from.Int64,
+		To:        gap_to.Int64,
+		FirstSeen: gap_first_seen.Int64,
+	}
+
+	return seq, g, nil
+}
+
+// SetChangesCursor records 'seq' as the sequence number of the last event processed by the consumer 'name' and 'gap' as
+// the range of missing sequence numbers it is waiting for. If 'gap' is nil any existing range is removed.
+func SetChangesCursor(ctx context.Context, ex Execer, name string, seq int64, gap *ChangesGap) error {
+
+	q := fmt.Sprintf(`INSERT INTO %s (name, seq, gap_from, gap_to, gap_first_seen, lastmodified) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE seq = ?, gap_from = ?, gap_to = ?, gap_first_seen = ?, lastmodified = ?`, CHANGES_CURSORS_TABLE_NAME)
+
+	var gap_from sql.NullInt64
+	var gap_to sql.NullInt64
+	var gap_first_seen sql.NullInt64
+
+	if gap != nil {
+		gap_from = sql.NullInt64{Int64: gap.From, Valid: true}
+		gap_to = sql.NullInt64{Int64: gap.To, Valid: true}
+		gap_first_seen = sql.NullInt64{Int64: gap.FirstSeen, Valid: true}
+	}
+
+	now := time.Now().Unix()
+
+	_, err := ex.ExecContext(ctx, q, name, seq, gap_from, gap_to, gap_first_seen, now, seq, gap_from, gap_to, gap_first_seen, now)
+
+	if err != nil {
+		return fmt.Errorf("Failed to update cursor for %s, %w", name, err)
+	}
+
+	return nil
+}
+
+// PruneChanges removes the events in the "wof_changes" table that have been processed by every consumer recorded in
+// the "wof_changes_cursors" table and returns the number of events removed. If there are no consumers nothing is removed.
+func PruneChanges(ctx context.Context, ex Execer) (int64, error) {
+
+	// If there are no cursors MIN returns NULL and nothing is removed
+
+	q := fmt.Sprintf(`DELETE FROM %s WHERE seq <= (
+		SELECT min_seq FROM (SELECT MIN(seq) AS min_seq FROM %s) AS cursors
+	)`, CHANGES_TABLE_NAME, CHANGES_CURSORS_TABLE_NAME)
+
+	rsp, err := ex.ExecContext(ctx, q)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to remove processed changes, %w", err)
+	}
+
+	removed, _ := rsp.RowsAffected()
+
+	return removed, nil
+}
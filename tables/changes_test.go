@@ -0,0 +1,124 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestDeriveChange(t *testing.T) {
+
+	previous := []byte(`{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal","wof:lastmodified":1694320392,"wof:placetype":"locality"},"geometry":{"type":"Point","coordinates":[-73.5,45.5]}}`)
+
+	tests := []struct {
+		name       string
+		previous   []byte
+		body       string
+		operation  string
+		properties []string
+		geometry   bool
+		unchanged  bool
+	}{
+		{
+			name:       "insert",
+			body:       `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal"},"geometry":{"type":"Point","coordinates":[-73.5,45.5]}}`,
+			operation:  CHANGE_INSERT,
+			properties: []string{"wof:id", "wof:name"},
+			geometry:   true,
+		},
+		{
+			name:       "modified and removed",
+			previous:   previous,
+			body:       `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montréal","wof:lastmodified":1711123456},"geometry":{"type":"Point","coordinates":[-73.5,45.5]}}`,
+			operation:  CHANGE_UPDATE,
+			properties: []string{"wof:lastmodified", "wof:name", "wof:placetype"},
+		},
+		{
+			name:       "geometry",
+			previous:   previous,
+			body:       `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal","wof:lastmodified":1694320392,"wof:placetype":"locality"},"geometry":{"type":"Point","coordinates":[-73.6,45.5]}}`,
+			operation:  CHANGE_UPDATE,
+			properties: []string{},
+			geometry:   true,
+		},
+		{
+			// Differences in whitespace are not changes to the geometry
+			name:      "unchanged",
+			previous:  previous,
+			body:      `{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montreal","wof:lastmodified":1694320392,"wof:placetype":"locality"},"geometry":{"type": "Point", "coordinates": [-73.5, 45.5]}}`,
+			unchanged: true,
+		},
+	}
+
+	for _, test := range tests {
+
+		c, err := DeriveChange(test.previous, []byte(test.body))
+
+		if err != nil {
+			t.Fatalf("Failed to derive change for %s, %v", test.name, err)
+		}
+
+		if test.unchanged {
+
+			if c != nil {
+				t.Fatalf("Expected no change for %s, got %+v", test.name, c)
+			}
+
+			continue
+		}
+
+		if c.Operation != test.operation || c.GeometryChanged != test.geometry || !reflect.DeepEqual(c.Properties, test.properties) {
+			t.Fatalf("Unexpected change for %s: %+v", test.name, c)
+		}
+
+		if (c.OldLastModified != nil) != (test.operation == CHANGE_UPDATE) {
+			t.Fatalf("Unexpected old lastmodified value for %s: %v", test.name, c.OldLastModified)
+		}
+	}
+}
+
+func TestSetChangesCursor(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		gap  *ChangesGap
+		args []interface{}
+	}{
+		{
+			name: "no gap",
+			args: []interface{}{"default", int64(5), sql.NullInt64{}, sql.NullInt64{}, sql.NullInt64{}},
+		},
+		{
+			name: "gap",
+			gap:  &ChangesGap{From: 6, To: 8, FirstSeen: 1711123456},
+			args: []interface{}{"default", int64(5), sql.NullInt64{Int64: 6, Valid: true}, sql.NullInt64{Int64: 8, Valid: true}, sql.NullInt64{Int64: 1711123456, Valid: true}},
+		},
+	}
+
+	for _, test := range tests {
+
+		ex := &recordingExecer{}
+
+		err := SetChangesCursor(ctx, ex, "default", 5, test.gap)
+
+		if err != nil {
+			t.Fatalf("Failed to set cursor for %s, %v", test.name, err)
+		}
+
+		if len(ex.args) != 1 {
+			t.Fatalf("Unexpected statements for %s: %v", test.name, ex.statements)
+		}
+
+		// The arguments are (name, seq, gap_from, gap_to, gap_first_seen, lastmodified) followed by the
+		// same values, without the name, for the update
+
+		args := ex.args[0]
+
+		if len(args) != 11 || !reflect.DeepEqual(args[0:5], test.args) || !reflect.DeepEqual(args[1:5], args[6:10]) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tables
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// CODEC_NONE is the codec for bodies stored uncompressed in the "geojson" table.
+const CODEC_NONE string = ""
+
+// CODEC_GZIP is the codec for bodies stored gzip-compressed in the "geojson" table.
+const CODEC_GZIP string = "gzip"
+
+// CODEC_ZSTD is the codec for bodies stored zstd-compressed in the "geojson" table.
+const CODEC_ZSTD string = "zstd"
+
+// The name of the column in the "geojson" table that records the codec used to store a body.
+const CODEC_COLUMN string = "codec"
+
+var gzip_magic = []byte{0x1f, 0x8b}
+
+var zstd_magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Querier is the interface for querying rows shared by `sql.DB`, `sql.Conn` and `sql.Tx` instances.
+type Querier interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}
+
+// ParseCodec ensures that 'str' is a valid codec for storing bodies in the "geojson" table. Valid
+// options are "none" (or the empty string), "gzip" and "zstd".
+func ParseCodec(str string) (string, error) {
+
+	str = strings.ToLower(str)
+
+	switch str {
+	case "none", CODEC_NONE:
+		return CODEC_NONE, nil
+	case CODEC_GZIP, CODEC_ZSTD:
+		return str, nil
+	default:
+		return "", fmt.Errorf("Invalid or unsupported codec '%s'", str)
+	}
+}
+
+// EncodeBody returns a copy of 'body' encoded using 'codec'.
+func EncodeBody(codec string, body []byte) ([]byte, error) {
+
+	switch codec {
+	case CODEC_NONE:
+		return body, nil
+	case CODEC_GZIP:
+		return gzipBody(body)
+	case CODEC_ZSTD:
+		return zstdBody(body)
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported codec '%s'", codec)
+	}
+}
+
+// DecodeBody returns a decoded copy of 'body' which was encoded using 'codec'. If 'codec' is empty
+// but 'body' starts with the gzip or zstd magic bytes it will be decoded accordingly; this allows
+// bodies stored before the "codec" column was introduced to be read.
+func DecodeBody(codec string, body []byte) ([]byte, error) {
+
+	if codec == CODEC_NONE {
+
+		switch {
+		case bytes.HasPrefix(body, gzip_magic):
+			codec = CODEC_GZIP
+		case bytes.HasPrefix(body, zstd_magic):
+			codec = CODEC_ZSTD
+		default:
+			return body, nil
+		}
+	}
+
+	switch codec {
+	case CODEC_GZIP:
+
+		r, err := gzip.NewReader(bytes.NewReader(body))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create gzip reader, %w", err)
+		}
+
+		defer r.Close()
+
+		decoded, err := io.ReadAll(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress body, %w", err)
+		}
+
+		return decoded, nil
+
+	case CODEC_ZSTD:
+
+		decoded, err := zstd_decoder.DecodeAll(body, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress body, %w", err)
+		}
+
+		return decoded, nil
+
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported codec '%s'", codec)
+	}
+}
+
+// GeoJSONBody returns the decoded body for the record matching 'id' and 'alt' in the "geojson" table. 'alt' is
+// the string representation of an alternate geometry label (for example "quattroshapes") or the empty string
+// for the main record. It returns `sql.ErrNoRows` if there is no matching record.
+func GeoJSONBody(ctx context.Context, q Querier, id int64, alt string) ([]byte, error) {
+
+	query := fmt.Sprintf("SELECT body, %s FROM %s WHERE id = ? AND alt = ?", CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME)
+
+	var body []byte
+	var codec string
+
+	err := q.QueryRowContext(ctx, query, id, alt).Scan(&body, &codec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeBody(codec, body)
+}
+
+// EnsureCodecColumn adds the "codec" column to the "geojson" table in 'db' if it is not already present. This
+// is only necessary for tables created before the column was introduced.
+func EnsureCodecColumn(ctx context.Context, db wof_sql.Database) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+
+	var count int
+
+	err = conn.QueryRowContext(ctx, q, wof_tables.GEOJSON_TABLE_NAME, CODEC_COLUMN).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine whether %s column exists, %w", CODEC_COLUMN, err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s VARCHAR(16) NOT NULL DEFAULT '' AFTER body", wof_tables.GEOJSON_TABLE_NAME, CODEC_COLUMN)
+
+	_, err = conn.ExecContext(ctx, alter)
+
+	if err != nil {
+		return fmt.Errorf("Failed to add %s column, %w", CODEC_COLUMN, err)
+	}
+
+	return nil
+}
+
+// gzipBody returns a gzip-compressed copy of 'body'.
+func gzipBody(body []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	wr, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create gzip writer, %w", err)
+	}
+
+	_, err = wr.Write(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compress body, %w", err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to close gzip writer, %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// zstdBody returns a zstd-compressed copy of 'body'.
+func zstdBody(body []byte) ([]byte, error) {
+	return zstd_encoder.EncodeAll(body, nil), nil
+}
+
+// zstd encoders and decoders are safe for concurrent use with the EncodeAll and DecodeAll methods
+// and are expensive to create so they are shared.
+
+var zstd_encoder, _ = zstd.NewWriter(nil)
+
+var zstd_decoder, _ = zstd.NewReader(nil)
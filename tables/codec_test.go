@@ -0,0 +1,108 @@
+package tables
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseCodec(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected string
+		ok       bool
+	}{
+		{"", CODEC_NONE, true},
+		{"none", CODEC_NONE, true},
+		{"GZIP", CODEC_GZIP, true},
+		{"zstd", CODEC_ZSTD, true},
+		{"brotli", "", false},
+	}
+
+	for _, test := range tests {
+
+		v, err := ParseCodec(test.str)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result parsing '%s', %v", test.str, err)
+		}
+
+		if v != test.expected {
+			t.Fatalf("Unexpected codec for '%s': '%s'", test.str, v)
+		}
+	}
+}
+
+func TestEncodeDecodeBody(t *testing.T) {
+
+	body := []byte(`{"type":"Feature","properties":{"wof:id":101736545,"wof:name":"Montréal"}}`)
+
+	tests := []struct {
+		name         string
+		encode_codec string
+		decode_codec string
+		compressed   bool
+	}{
+		{"none", CODEC_NONE, CODEC_NONE, false},
+		{"gzip", CODEC_GZIP, CODEC_GZIP, true},
+		{"zstd", CODEC_ZSTD, CODEC_ZSTD, true},
+		// Bodies stored before the codec column existed are identified by their magic bytes
+		{"legacy gzip", CODEC_GZIP, CODEC_NONE, true},
+		{"legacy zstd", CODEC_ZSTD, CODEC_NONE, true},
+	}
+
+	for _, test := range tests {
+
+		encoded, err := EncodeBody(test.encode_codec, body)
+
+		if err != nil {
+			t.Fatalf("Failed to encode body for %s, %v", test.name, err)
+		}
+
+		if bytes.Equal(encoded, body) == test.compressed {
+			t.Fatalf("Unexpected encoded body for %s", test.name)
+		}
+
+		decoded, err := DecodeBody(test.decode_codec, encoded)
+
+		if err != nil {
+			t.Fatalf("Failed to decode body for %s, %v", test.name, err)
+		}
+
+		if !bytes.Equal(decoded, body) {
+			t.Fatalf("Decoded body for %s does not match original body", test.name)
+		}
+	}
+
+	_, err := EncodeBody("brotli", body)
+
+	if err == nil {
+		t.Fatalf("Expected encoding with an invalid codec to fail")
+	}
+
+	_, err = DecodeBody(CODEC_GZIP, body)
+
+	if err == nil {
+		t.Fatalf("Expected decoding an uncompressed body as gzip to fail")
+	}
+}
+
+func TestAddCodecColumn(t *testing.T) {
+
+	schema, err := geojsonSchema()
+
+	if err != nil {
+		t.Fatalf("Failed to derive geojson schema, %v", err)
+	}
+
+	if !strings.Contains(schema, GEOJSON_BODY_COLUMN+"\n      "+CODEC_COLUMN+" VARCHAR(16)") {
+		t.Fatalf("Expected schema to contain codec column, %s", schema)
+	}
+
+	_, err = addCodecColumn("CREATE TABLE geojson (body MEDIUMBLOB NOT NULL)")
+
+	if err == nil {
+		t.Fatalf("Expected adding codec column to a schema without a matching body column to fail")
+	}
+}
@@ -0,0 +1,325 @@
+package tables
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// PromotedColumn is a generated column, derived from a Who's On First property, that is added to the "whosonfirst" table
+// in addition to the columns defined by its schema.
+type PromotedColumn struct {
+	// Name is the name of the column.
+	Name string `json:"name"`
+	// Property is the name of the (top-level) Who's On First property that the column is derived from, for example "wof:country".
+	Property string `json:"property"`
+	// Type is the MySQL type of the column. Valid options are: BIGINT, INT, TINYINT, DOUBLE, DATE, DATETIME, TEXT, JSON,
+	// VARCHAR({N}) and CHAR({N}).
+	Type string `json:"type"`
+	// Stored indicates whether the column's values are stored, rather than computed when rows are read (VIRTUAL).
+	Stored bool `json:"stored,omitempty"`
+	// Indexed indicates whether an index should be added for the column. TEXT and JSON columns can not be indexed.
+	Indexed bool `json:"indexed,omitempty"`
+}
+
+var re_column_name = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,63}$`)
+
+var re_column_type = regexp.MustCompile(`^(?:BIGINT|INT|TINYINT|DOUBLE|DATE|DATETIME|TEXT|JSON|VARCHAR\(\d+\)|CHAR\(\d+\))$`)
+
+// The names of the columns defined by the "whosonfirst" table's schema, which can not be used by promoted columns.
+var reserved_columns = []string{
+	"id",
+	"properties",
+	"geometry",
+	"centroid",
+	"lastmodified",
+	"parent_id",
+	"placetype",
+	"is_current",
+	"is_nullisland",
+	"is_approximate",
+	"is_ceased",
+	"is_deprecated",
+	"is_superseded",
+	"is_superseding",
+	"date_upper",
+	"date_lower",
+	NAME_COLUMN,
+	INCEPTION_LOWER_COLUMN,
+	CESSATION_UPPER_COLUMN,
+}
+
+// ParsePromotedColumn returns a new `PromotedColumn` instance derived from 'str' which is expected to take the form of:
+//
+//	{NAME},{PROPERTY},{TYPE}[,indexed][,stored]
+//
+// For example "country,wof:country,CHAR(2),indexed".
+func ParsePromotedColumn(str string) (*PromotedColumn, error) {
+
+	parts := strings.Split(str, ",")
+
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("Invalid column definition '%s', expected {NAME},{PROPERTY},{TYPE}[,indexed][,stored]", str)
+	}
+
+	c := &PromotedColumn{
+		Name:     parts[0],
+		Property: parts[1],
+		Type:     parts[2],
+	}
+
+	for _, flag := range parts[3:] {
+
+		switch strings.ToLower(flag) {
+		case "indexed":
+			c.Indexed = true
+		case "stored":
+			c.Stored = true
+		default:
+			return nil, fmt.Errorf("Invalid column flag '%s'", flag)
+		}
+	}
+
+	err := c.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ReadPromotedColumns returns the list of `PromotedColumn` instances defined in the JSON file at 'path'. The file is
+// expected to contain a list of objects with "name", "property", "type" and (optional) "indexed" and "stored" keys.
+func ReadPromotedColumns(path string) ([]*PromotedColumn, error) {
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	var columns []*PromotedColumn
+
+	err = json.Unmarshal(body, &columns)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode %s, %w", path, err)
+	}
+
+	for _, c := range columns {
+
+		err := c.Validate()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return columns, nil
+}
+
+// Validate ensures that the column's name, property and type are valid.
+func (c *PromotedColumn) Validate() error {
+
+	if !re_column_name.MatchString(c.Name) {
+		return fmt.Errorf("Invalid column name '%s'", c.Name)
+	}
+
+	if slices.Contains(reserved_columns, c.Name) {
+		return fmt.Errorf("Invalid column name '%s', column is already defined by the %s table", c.Name, wof_tables.WHOSONFIRST_TABLE_NAME)
+	}
+
+	if c.Property == "" || strings.ContainsAny(c.Property, `"'\`) {
+		return fmt.Errorf("Invalid property '%s' for column '%s'", c.Property, c.Name)
+	}
+
+	c.Type = strings.ToUpper(c.Type)
+
+	if !re_column_type.MatchString(c.Type) {
+		return fmt.Errorf("Invalid or unsupported type '%s' for column '%s'", c.Type, c.Name)
+	}
+
+	if c.Indexed && (c.Type == "TEXT" || c.Type == "JSON") {
+		return fmt.Errorf("%s columns can not be indexed", c.Type)
+	}
+
+	return nil
+}
+
+// Definition returns the SQL definition of the column. Values are derived using `JSON_VALUE(... RETURNING {TYPE} NULL ON
+// ERROR)` so that property values which can not be converted to the column's type, for example a string in an INT column
+// or a string longer than a VARCHAR column, are stored as NULL rather than causing the record to fail to be indexed. JSON
+// columns store the property's (unconverted) value. `JSON_VALUE` requires MySQL 8.0.21 or higher.
+func (c *PromotedColumn) Definition() string {
+
+	path := fmt.Sprintf(`'$."%s"'`, c.Property)
+
+	expr := fmt.Sprintf("JSON_EXTRACT(properties, %s)", path)
+
+	if c.Type != "JSON" {
+		expr = fmt.Sprintf("JSON_VALUE(properties, %s RETURNING %s NULL ON ERROR)", path, c.returningType())
+	}
+
+	generated := "VIRTUAL"
+
+	if c.Stored {
+		generated = "STORED"
+	}
+
+	return fmt.Sprintf("%s %s GENERATED ALWAYS AS (%s) %s", c.Name, c.Type, expr, generated)
+}
+
+// returningType returns the `JSON_VALUE` RETURNING type for the column's type. `JSON_VALUE` only returns a subset of
+// MySQL's types so integer columns use SIGNED, VARCHAR columns use CHAR and TEXT columns use CHAR(16383), the largest
+// number of (4-byte) characters that fit in a TEXT column.
+func (c *PromotedColumn) returningType() string {
+
+	switch {
+	case c.Type == "BIGINT", c.Type == "INT", c.Type == "TINYINT":
+		return "SIGNED"
+	case c.Type == "TEXT":
+		return "CHAR(16383)"
+	case strings.HasPrefix(c.Type, "VARCHAR"):
+		return strings.TrimPrefix(c.Type, "VAR")
+	default:
+		return c.Type
+	}
+}
+
+// IndexDefinition returns the SQL definition of the column's index, or an empty string if the column is not indexed.
+func (c *PromotedColumn) IndexDefinition() string {
+
+	if !c.Indexed {
+		return ""
+	}
+
+	return fmt.Sprintf("KEY %s (%s)", c.Name, c.Name)
+}
+
+// promoteColumns returns 'schema', the schema for the "whosonfirst" table, with the definitions for 'columns' and their
+// indexes added.
+func promoteColumns(schema string, columns []*PromotedColumn) (string, error) {
+
+	if len(columns) == 0 {
+		return schema, nil
+	}
+
+	defs := make([]string, 0)
+
+	for _, c := range columns {
+		defs = append(defs, c.Definition())
+	}
+
+	for _, c := range columns {
+
+		idx := c.IndexDefinition()
+
+		if idx != "" {
+			defs = append(defs, idx)
+		}
+	}
+
+	return addDefinitions(schema, defs)
+}
+
+// addDefinitions returns 'schema', the schema for the "whosonfirst" table, with the column and index definitions in
+// 'defs' added before the first of the table's own indexes. An error is returned if that index can not be found, for
+// example because the schema defined by whosonfirst/go-whosonfirst-sql has changed.
+func addDefinitions(schema string, defs []string) (string, error) {
+
+	anchor := "      KEY parent_id (parent_id),"
+
+	if !strings.Contains(schema, anchor) {
+		return "", fmt.Errorf("Failed to locate the parent_id index in the %s schema", wof_tables.WHOSONFIRST_TABLE_NAME)
+	}
+
+	var sb strings.Builder
+
+	for _, d := range defs {
+		sb.WriteString(fmt.Sprintf("      %s,\n", d))
+	}
+
+	return strings.Replace(schema, anchor, sb.String()+anchor, 1), nil
+}
+
+// PromotedColumnsMigration returns the list of statements needed to add any of 'columns', or their indexes, that are
+// missing from the "whosonfirst" table. Existing columns are not modified.
+func PromotedColumnsMigration(ctx context.Context, db wof_sql.Database, columns []*PromotedColumn) ([]string, error) {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q_column := "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+	q_index := "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?"
+
+	statements := make([]string, 0)
+
+	for _, c := range columns {
+
+		var count int
+
+		err := conn.QueryRowContext(ctx, q_column, wof_tables.WHOSONFIRST_TABLE_NAME, c.Name).Scan(&count)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to determine whether %s column exists, %w", c.Name, err)
+		}
+
+		if count == 0 {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", wof_tables.WHOSONFIRST_TABLE_NAME, c.Definition()))
+		}
+
+		if !c.Indexed {
+			continue
+		}
+
+		err = conn.QueryRowContext(ctx, q_index, wof_tables.WHOSONFIRST_TABLE_NAME, c.Name).Scan(&count)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to determine whether %s index exists, %w", c.Name, err)
+		}
+
+		if count == 0 {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD %s", wof_tables.WHOSONFIRST_TABLE_NAME, c.IndexDefinition()))
+		}
+	}
+
+	return statements, nil
+}
+
+// EnsurePromotedColumns adds any of 'columns', or their indexes, that are missing from the "whosonfirst" table.
+func EnsurePromotedColumns(ctx context.Context, db wof_sql.Database, columns []*PromotedColumn) error {
+
+	statements, err := PromotedColumnsMigration(ctx, db, columns)
+
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	for _, q := range statements {
+
+		_, err := conn.ExecContext(ctx, q)
+
+		if err != nil {
+			return fmt.Errorf("Failed to execute '%s', %w", q, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package tables
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+func TestParsePromotedColumn(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected *PromotedColumn
+		ok       bool
+	}{
+		{"country,wof:country,CHAR(2)", &PromotedColumn{Name: "country", Property: "wof:country", Type: "CHAR(2)"}, true},
+		{"country,wof:country,char(2),indexed", &PromotedColumn{Name: "country", Property: "wof:country", Type: "CHAR(2)", Indexed: true}, true},
+		{"population,wof:population,BIGINT,Indexed,STORED", &PromotedColumn{Name: "population", Property: "wof:population", Type: "BIGINT", Indexed: true, Stored: true}, true},
+		{"hierarchy,wof:hierarchy,JSON", &PromotedColumn{Name: "hierarchy", Property: "wof:hierarchy", Type: "JSON"}, true},
+		{"country,wof:country", nil, false},
+		{"country,wof:country,CHAR(2),unique", nil, false},
+		{"Country,wof:country,CHAR(2)", nil, false},
+		{"1country,wof:country,CHAR(2)", nil, false},
+		{"placetype,wof:placetype,VARCHAR(64)", nil, false},
+		{"name,wof:name,VARCHAR(255)", nil, false},
+		{"country,,CHAR(2)", nil, false},
+		{`country,wof:country",CHAR(2)`, nil, false},
+		{"country,wof:country,BLOB", nil, false},
+		{"country,wof:country,CHAR", nil, false},
+		{"notes,wof:notes,TEXT,indexed", nil, false},
+		{"hierarchy,wof:hierarchy,JSON,indexed", nil, false},
+	}
+
+	for _, test := range tests {
+
+		c, err := ParsePromotedColumn(test.str)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.str)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.str, err)
+		}
+
+		if *c != *test.expected {
+			t.Fatalf("Unexpected column for '%s': %+v", test.str, c)
+		}
+	}
+}
+
+func TestReadPromotedColumns(t *testing.T) {
+
+	tests := []struct {
+		body  string
+		count int
+		ok    bool
+	}{
+		{`[{"name":"country","property":"wof:country","type":"CHAR(2)","indexed":true},{"name":"population","property":"wof:population","type":"BIGINT"}]`, 2, true},
+		{`[]`, 0, true},
+		{`[{"name":"id","property":"wof:id","type":"BIGINT"}]`, 0, false},
+		{`{"name":"country"}`, 0, false},
+	}
+
+	for idx, test := range tests {
+
+		path := filepath.Join(t.TempDir(), "columns.json")
+
+		err := os.WriteFile(path, []byte(test.body), 0644)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", path, err)
+		}
+
+		columns, err := ReadPromotedColumns(path)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for test %d, %v", idx, err)
+		}
+
+		if len(columns) != test.count && test.ok {
+			t.Fatalf("Expected %d columns for test %d, got %d", test.count, idx, len(columns))
+		}
+	}
+
+	_, err := ReadPromotedColumns(filepath.Join(t.TempDir(), "missing.json"))
+
+	if err == nil {
+		t.Fatalf("Expected a missing file to fail")
+	}
+}
+
+func TestPromotedColumnDefinition(t *testing.T) {
+
+	tests := []struct {
+		column     *PromotedColumn
+		definition string
+		index      string
+	}{
+		{
+			&PromotedColumn{Name: "country", Property: "wof:country", Type: "CHAR(2)", Indexed: true},
+			`country CHAR(2) GENERATED ALWAYS AS (JSON_VALUE(properties, '$."wof:country"' RETURNING CHAR(2) NULL ON ERROR)) VIRTUAL`,
+			"KEY country (country)",
+		},
+		{
+			&PromotedColumn{Name: "label", Property: "wof:label", Type: "VARCHAR(64)"},
+			`label VARCHAR(64) GENERATED ALWAYS AS (JSON_VALUE(properties, '$."wof:label"' RETURNING CHAR(64) NULL ON ERROR)) VIRTUAL`,
+			"",
+		},
+		{
+			&PromotedColumn{Name: "population", Property: "wof:population", Type: "BIGINT", Stored: true},
+			`population BIGINT GENERATED ALWAYS AS (JSON_VALUE(properties, '$."wof:population"' RETURNING SIGNED NULL ON ERROR)) STORED`,
+			"",
+		},
+		{
+			&PromotedColumn{Name: "area", Property: "geom:area", Type: "DOUBLE"},
+			`area DOUBLE GENERATED ALWAYS AS (JSON_VALUE(properties, '$."geom:area"' RETURNING DOUBLE NULL ON ERROR)) VIRTUAL`,
+			"",
+		},
+		{
+			&PromotedColumn{Name: "inception", Property: "edtf:inception", Type: "DATE"},
+			`inception DATE GENERATED ALWAYS AS (JSON_VALUE(properties, '$."edtf:inception"' RETURNING DATE NULL ON ERROR)) VIRTUAL`,
+			"",
+		},
+		{
+			&PromotedColumn{Name: "notes", Property: "wof:notes", Type: "TEXT"},
+			`notes TEXT GENERATED ALWAYS AS (JSON_VALUE(properties, '$."wof:notes"' RETURNING CHAR(16383) NULL ON ERROR)) VIRTUAL`,
+			"",
+		},
+		{
+			&PromotedColumn{Name: "hierarchy", Property: "wof:hierarchy", Type: "JSON"},
+			`hierarchy JSON GENERATED ALWAYS AS (JSON_EXTRACT(properties, '$."wof:hierarchy"')) VIRTUAL`,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+
+		def := test.column.Definition()
+
+		if def != test.definition {
+			t.Fatalf("Unexpected definition for %s: %s", test.column.Name, def)
+		}
+
+		idx := test.column.IndexDefinition()
+
+		if idx != test.index {
+			t.Fatalf("Unexpected index definition for %s: %s", test.column.Name, idx)
+		}
+	}
+}
+
+func TestPromoteColumns(t *testing.T) {
+
+	schema, err := wof_tables.LoadSchema("mysql", wof_tables.WHOSONFIRST_TABLE_NAME)
+
+	if err != nil {
+		t.Fatalf("Failed to load schema, %v", err)
+	}
+
+	columns := []*PromotedColumn{
+		{Name: "country", Property: "wof:country", Type: "CHAR(2)", Indexed: true},
+		{Name: "population", Property: "wof:population", Type: "BIGINT"},
+	}
+
+	tests := []struct {
+		name     string
+		schema   string
+		columns  []*PromotedColumn
+		contains []string
+		ok       bool
+	}{
+		{"none", schema, nil, nil, true},
+		{"columns", schema, columns, []string{columns[0].Definition() + ",", columns[1].Definition() + ",", "KEY country (country),"}, true},
+		// The definitions can not be added if the table's own indexes can not be found
+		{"missing anchor", strings.Replace(schema, "KEY parent_id", "KEY parent", 1), columns, nil, false},
+	}
+
+	for _, test := range tests {
+
+		s, err := promoteColumns(test.schema, test.columns)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected %s to fail", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to promote columns for %s, %v", test.name, err)
+		}
+
+		if len(test.columns) == 0 && s != test.schema {
+			t.Fatalf("Expected schema to be unchanged for %s", test.name)
+		}
+
+		anchor := strings.Index(s, "KEY parent_id (parent_id)")
+
+		for _, str := range test.contains {
+
+			idx := strings.Index(s, str)
+
+			if idx == -1 || idx > anchor {
+				t.Fatalf("Expected '%s' before the parent_id index for %s: %s", str, test.name, s)
+			}
+		}
+	}
+}
+
+func TestNewWhosonfirstTableWithPromotedColumns(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		columns []*PromotedColumn
+		ok      bool
+	}{
+		{"valid", []*PromotedColumn{{Name: "country", Property: "wof:country", Type: "CHAR(2)"}}, true},
+		{"invalid", []*PromotedColumn{{Name: "country", Property: "wof:country", Type: "BLOB"}}, false},
+		{"duplicate", []*PromotedColumn{{Name: "country", Property: "wof:country", Type: "CHAR(2)"}, {Name: "country", Property: "iso:country", Type: "CHAR(2)"}}, false},
+	}
+
+	for _, test := range tests {
+
+		opts, err := DefaultWhosonfirstTableOptions()
+
+		if err != nil {
+			t.Fatalf("Failed to create table options, %v", err)
+		}
+
+		opts.PromotedColumns = test.columns
+
+		tbl, err := NewWhosonfirstTableWithOptions(ctx, opts)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for %s, %v", test.name, err)
+		}
+
+		if test.ok && !strings.Contains(tbl.Schema(), test.columns[0].Definition()) {
+			t.Fatalf("Expected schema for %s to contain promoted columns", test.name)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sfomuseum/go-edtf"
+	"github.com/sfomuseum/go-edtf/parser"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// The format used for the "date:*" properties and the "inception_lower" and "cessation_upper" columns.
+const DATE_FORMAT string = "2006-01-02"
+
+// The earliest year that can be stored in a MySQL DATE column.
+const DATE_MIN_YEAR int = 1000
+
+// The latest year that can be stored in a MySQL DATE column.
+const DATE_MAX_YEAR int = 9999
+
+// The name of the "whosonfirst" table column containing the earliest date at which a record existed.
+const INCEPTION_LOWER_COLUMN string = "inception_lower"
+
+// The name of the "whosonfirst" table column containing the latest date at which a record existed.
+const CESSATION_UPPER_COLUMN string = "cessation_upper"
+
+// dateColumnDefinitions returns the SQL definitions of the "whosonfirst" table's "inception_lower" and "cessation_upper"
+// columns and their indexes.
+func dateColumnDefinitions() []string {
+
+	return []string{
+		fmt.Sprintf("%s DATE NULL", INCEPTION_LOWER_COLUMN),
+		fmt.Sprintf("%s DATE NULL", CESSATION_UPPER_COLUMN),
+		fmt.Sprintf("KEY %s (%s)", INCEPTION_LOWER_COLUMN, INCEPTION_LOWER_COLUMN),
+		fmt.Sprintf("KEY %s (%s)", CESSATION_UPPER_COLUMN, CESSATION_UPPER_COLUMN),
+	}
+}
+
+// The maximum number of rows updated by each of the statements used to populate the "inception_lower" and
+// "cessation_upper" columns of existing records.
+const DATE_BACKFILL_BATCH_SIZE int = 1000
+
+// EnsureDateColumns adds the "inception_lower" and "cessation_upper" columns, and their indexes, to the "whosonfirst"
+// table if they are missing and then populates them, using `BackfillDateColumns`, for existing records.
+func EnsureDateColumns(ctx context.Context, db wof_sql.Database) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+
+	var count int
+
+	err = conn.QueryRowContext(ctx, q, wof_tables.WHOSONFIRST_TABLE_NAME, INCEPTION_LOWER_COLUMN).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine whether %s column exists, %w", INCEPTION_LOWER_COLUMN, err)
+	}
+
+	if count == 0 {
+
+		defs := dateColumnDefinitions()
+
+		q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s, ADD COLUMN %s, ADD %s, ADD %s", wof_tables.WHOSONFIRST_TABLE_NAME, defs[0], defs[1], defs[2], defs[3])
+
+		_, err := conn.ExecContext(ctx, q)
+
+		if err != nil {
+			return fmt.Errorf("Failed to execute '%s', %w", q, err)
+		}
+	}
+
+	return BackfillDateColumns(ctx, db, DATE_BACKFILL_BATCH_SIZE)
+}
+
+// BackfillDateColumns populates the "inception_lower" and "cessation_upper" columns from the "date_lower" and "date_upper"
+// columns for records where they are NULL, updating at most 'batch_size' rows at a time. Only rows which still need to
+// be updated are selected so it is safe to interrupt and run again; once the columns are populated it only performs one
+// (indexed) query for each column. Bounds derived from EDTF properties are not backfilled; records need to be re-indexed
+// for those to be stored.
+func BackfillDateColumns(ctx context.Context, db wof_sql.Database, batch_size int) error {
+
+	if batch_size < 1 {
+		return fmt.Errorf("Invalid batch size")
+	}
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	for _, q := range dateBackfillStatements() {
+
+		for {
+
+			rsp, err := conn.ExecContext(ctx, q, batch_size)
+
+			if err != nil {
+				return fmt.Errorf("Failed to execute '%s', %w", q, err)
+			}
+
+			updated, err := rsp.RowsAffected()
+
+			if err != nil {
+				return fmt.Errorf("Failed to determine number of rows updated, %w", err)
+			}
+
+			if updated < int64(batch_size) {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// dateBackfillStatements returns the statements used by `BackfillDateColumns` to populate the "inception_lower" and
+// "cessation_upper" columns. Each statement takes the batch size as its only argument.
+func dateBackfillStatements() []string {
+
+	return []string{
+		fmt.Sprintf("UPDATE %s SET %s = date_lower WHERE %s IS NULL AND date_lower IS NOT NULL LIMIT ?", wof_tables.WHOSONFIRST_TABLE_NAME, INCEPTION_LOWER_COLUMN, INCEPTION_LOWER_COLUMN),
+		fmt.Sprintf("UPDATE %s SET %s = date_upper WHERE %s IS NULL AND date_upper IS NOT NULL LIMIT ?", wof_tables.WHOSONFIRST_TABLE_NAME, CESSATION_UPPER_COLUMN, CESSATION_UPPER_COLUMN),
+	}
+}
+
+// EDTFBounds returns the earliest and latest times described by the EDTF string 'edtf_str'. Either value may be nil if
+// the bound is open or unknown (for example "1906-04-18/.."). Deprecated (2012) values like "open" and "uuuu" are treated
+// as their current equivalents.
+func EDTFBounds(edtf_str string) (*time.Time, *time.Time, error) {
+
+	if edtf.IsDeprecated(edtf_str) {
+
+		v, err := edtf.ReplaceDeprecated(edtf_str)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		edtf_str = v
+	}
+
+	if edtf.IsOpen(edtf_str) || edtf.IsUnknown(edtf_str) {
+		return nil, nil, nil
+	}
+
+	d, err := parser.ParseString(edtf_str)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse EDTF string '%s', %w", edtf_str, err)
+	}
+
+	// Lower and Upper return errors for bounds that are not set, for example open ranges
+
+	lower, err := d.Lower()
+
+	if err != nil {
+		lower = nil
+	}
+
+	upper, err := d.Upper()
+
+	if err != nil {
+		upper = nil
+	}
+
+	return lower, upper, nil
+}
+
+// dateBounds returns the values for the "whosonfirst" table's "inception_lower" and "cessation_upper" columns for a
+// record whose properties are 'props'. These are the record's "date:inception_lower" and "date:cessation_upper"
+// properties or, if they are missing (or invalid) and 'derive' is true, the corresponding bounds of its "edtf:inception"
+// and "edtf:cessation" properties. Values that can not be stored in a DATE column are treated as missing. 'props' is not
+// modified.
+func dateBounds(props map[string]interface{}, derive bool) (sql.NullString, sql.NullString) {
+
+	bound := func(date_key string, edtf_key string, lower bool) sql.NullString {
+
+		str_date, ok := props[date_key].(string)
+
+		if ok {
+
+			t, err := time.Parse(DATE_FORMAT, str_date)
+
+			if err == nil && t.Year() >= DATE_MIN_YEAR && t.Year() <= DATE_MAX_YEAR {
+				return sql.NullString{String: str_date, Valid: true}
+			}
+		}
+
+		if !derive {
+			return sql.NullString{}
+		}
+
+		str_edtf, ok := props[edtf_key].(string)
+
+		if !ok {
+			return sql.NullString{}
+		}
+
+		edtf_lower, edtf_upper, err := EDTFBounds(str_edtf)
+
+		if err != nil {
+			return sql.NullString{}
+		}
+
+		t := edtf_upper
+
+		if lower {
+			t = edtf_lower
+		}
+
+		if t == nil || t.Year() < DATE_MIN_YEAR || t.Year() > DATE_MAX_YEAR {
+			return sql.NullString{}
+		}
+
+		return sql.NullString{String: t.Format(DATE_FORMAT), Valid: true}
+	}
+
+	inception := bound("date:inception_lower", "edtf:inception", true)
+	cessation := bound("date:cessation_upper", "edtf:cessation", false)
+
+	return inception, cessation
+}
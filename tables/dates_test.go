@@ -0,0 +1,153 @@
+package tables
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEDTFBounds(t *testing.T) {
+
+	tests := []struct {
+		edtf  string
+		lower string
+		upper string
+		ok    bool
+	}{
+		{"2019-05-21", "2019-05-21", "2019-05-21", true},
+		{"1906", "1906-01-01", "1906-12-31", true},
+		{"1906-04-18/2019", "1906-04-18", "2019-12-31", true},
+		{"1906/..", "1906-01-01", "", true},
+		{"../1906-04-18", "", "1906-04-18", true},
+		{"..", "", "", true},
+		{"open", "", "", true},
+		{"uuuu", "", "", true},
+		{"", "", "", true},
+		{"tomorrow", "", "", false},
+	}
+
+	format := func(t *time.Time) string {
+
+		if t == nil {
+			return ""
+		}
+
+		return t.Format(DATE_FORMAT)
+	}
+
+	for _, test := range tests {
+
+		lower, upper, err := EDTFBounds(test.edtf)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result parsing '%s', %v", test.edtf, err)
+		}
+
+		if format(lower) != test.lower {
+			t.Fatalf("Unexpected lower bound for '%s': %s", test.edtf, format(lower))
+		}
+
+		if format(upper) != test.upper {
+			t.Fatalf("Unexpected upper bound for '%s': %s", test.edtf, format(upper))
+		}
+	}
+}
+
+func TestDateBounds(t *testing.T) {
+
+	valid := func(str string) sql.NullString {
+		return sql.NullString{String: str, Valid: true}
+	}
+
+	tests := []struct {
+		name      string
+		props     map[string]interface{}
+		derive    bool
+		inception sql.NullString
+		cessation sql.NullString
+	}{
+		{
+			name:      "properties",
+			props:     map[string]interface{}{"date:inception_lower": "1906-04-18", "date:cessation_upper": "2019-12-31", "edtf:inception": "1850"},
+			derive:    true,
+			inception: valid("1906-04-18"),
+			cessation: valid("2019-12-31"),
+		},
+		{
+			name:      "derived",
+			props:     map[string]interface{}{"edtf:inception": "1906", "edtf:cessation": "2019-05-21"},
+			derive:    true,
+			inception: valid("1906-01-01"),
+			cessation: valid("2019-05-21"),
+		},
+		{
+			name:   "not derived",
+			props:  map[string]interface{}{"edtf:inception": "1906", "edtf:cessation": "2019-05-21"},
+			derive: false,
+		},
+		{
+			name:      "open",
+			props:     map[string]interface{}{"edtf:inception": "1906/..", "edtf:cessation": ".."},
+			derive:    true,
+			inception: valid("1906-01-01"),
+		},
+		{
+			name:      "out of range",
+			props:     map[string]interface{}{"edtf:inception": "0800", "edtf:cessation": "2019"},
+			derive:    true,
+			cessation: valid("2019-12-31"),
+		},
+		{
+			name:      "invalid property",
+			props:     map[string]interface{}{"date:inception_lower": "soon", "edtf:inception": "1906"},
+			derive:    true,
+			inception: valid("1906-01-01"),
+		},
+		{
+			name:   "missing",
+			props:  nil,
+			derive: true,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			before := make(map[string]interface{})
+
+			for k, v := range test.props {
+				before[k] = v
+			}
+
+			inception, cessation := dateBounds(test.props, test.derive)
+
+			if inception != test.inception {
+				t.Fatalf("Unexpected inception: %v", inception)
+			}
+
+			if cessation != test.cessation {
+				t.Fatalf("Unexpected cessation: %v", cessation)
+			}
+
+			if test.props != nil && !reflect.DeepEqual(before, test.props) {
+				t.Fatalf("Properties were modified: %v", test.props)
+			}
+		})
+	}
+}
+
+func TestDateBackfillStatements(t *testing.T) {
+
+	expected := []string{
+		"UPDATE whosonfirst SET inception_lower = date_lower WHERE inception_lower IS NULL AND date_lower IS NOT NULL LIMIT ?",
+		"UPDATE whosonfirst SET cessation_upper = date_upper WHERE cessation_upper IS NULL AND date_upper IS NOT NULL LIMIT ?",
+	}
+
+	statements := dateBackfillStatements()
+
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("Unexpected backfill statements: %v", statements)
+	}
+}
@@ -3,21 +3,58 @@ package tables
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
 	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
 	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
 	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
 	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// The column definition in the "geojson" table schema after which the "codec" column is added.
+const GEOJSON_BODY_COLUMN string = "body LONGBLOB NOT NULL,"
+
 type GeoJSONTable struct {
-	wof_sql.Table
+	*tableIndexer
+	options *GeoJSONTableOptions
+}
+
+// GeoJSONTableOptions defines options for indexing records in the "geojson" table.
+type GeoJSONTableOptions struct {
+	IndexOptions
+	// Codec is the codec used to compress record bodies. If empty bodies are stored uncompressed.
+	Codec string
+}
+
+// DefaultGeoJSONTableOptions returns a new `GeoJSONTableOptions` instance with default values.
+func DefaultGeoJSONTableOptions() (*GeoJSONTableOptions, error) {
+
+	opts := &GeoJSONTableOptions{
+		IndexOptions: defaultIndexOptions(),
+	}
+
+	return opts, nil
 }
 
 func NewGeoJSONTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
 
-	t, err := NewGeoJSONTable(ctx)
+	opts, err := DefaultGeoJSONTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default GeoJSON table options, %w", err)
+	}
+
+	return NewGeoJSONTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewGeoJSONTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *GeoJSONTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewGeoJSONTableWithOptions(ctx, opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create GeoJSON table, %w", err)
@@ -33,59 +70,112 @@ func NewGeoJSONTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_
 }
 
 func NewGeoJSONTable(ctx context.Context) (wof_sql.Table, error) {
-	t := GeoJSONTable{}
-	return &t, nil
+
+	opts, err := DefaultGeoJSONTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default GeoJSON table options, %w", err)
+	}
+
+	return NewGeoJSONTableWithOptions(ctx, opts)
+}
+
+func NewGeoJSONTableWithOptions(ctx context.Context, opts *GeoJSONTableOptions) (wof_sql.Table, error) {
+
+	t := &GeoJSONTable{
+		options: opts,
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
 }
 
 func (t *GeoJSONTable) Name() string {
 	return wof_tables.GEOJSON_TABLE_NAME
 }
 
+// Schema returns the schema for the "geojson" table defined by whosonfirst/go-whosonfirst-sql with an additional
+// "codec" column used to record how (or whether) each body has been compressed. It returns an empty string if the
+// schema can not be derived; use `InitializeTable` to see why.
 func (t *GeoJSONTable) Schema() string {
-	s, _ := wof_tables.LoadSchema("mysql", wof_tables.GEOJSON_TABLE_NAME)
+	s, _ := geojsonSchema()
 	return s
 }
 
 func (t *GeoJSONTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
-	return wof_sql.CreateTableIfNecessary(ctx, db, t)
-}
 
-func (t *GeoJSONTable) IndexRecord(ctx context.Context, db wof_sql.Database, i interface{}, custom ...interface{}) error {
+	_, err := geojsonSchema()
 
-	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+
+	err = wof_sql.CreateTableIfNecessary(ctx, db, t)
 
 	if err != nil {
-		return fmt.Errorf("Failed to establish database connection, %w", err)
+		return err
 	}
 
-	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	return EnsureCodecColumn(ctx, db)
+}
+
+// geojsonSchema returns the schema for the "geojson" table with the "codec" column added after the "body" column.
+func geojsonSchema() (string, error) {
+
+	s, err := wof_tables.LoadSchema("mysql", wof_tables.GEOJSON_TABLE_NAME)
 
 	if err != nil {
-		return fmt.Errorf("Failed to create transaction, %w", err)
+		return "", fmt.Errorf("Failed to load %s schema, %w", wof_tables.GEOJSON_TABLE_NAME, err)
+	}
+
+	return addCodecColumn(s)
+}
+
+// addCodecColumn returns a copy of 'schema' with the "codec" column added after the "body" column. It returns an
+// error if 'schema' does not contain a "body" column definition matching `GEOJSON_BODY_COLUMN`.
+func addCodecColumn(schema string) (string, error) {
+
+	if !strings.Contains(schema, GEOJSON_BODY_COLUMN) {
+		return "", fmt.Errorf("Failed to add %s column, %s schema does not contain '%s'", CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME, GEOJSON_BODY_COLUMN)
 	}
 
-	err = t.IndexFeature(ctx, tx, i.([]byte), custom...)
+	codec_column := fmt.Sprintf("%s\n      %s VARCHAR(16) NOT NULL DEFAULT '',", GEOJSON_BODY_COLUMN, CODEC_COLUMN)
+
+	return strings.Replace(schema, GEOJSON_BODY_COLUMN, codec_column, 1), nil
+}
+
+func (t *GeoJSONTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	stmt, err := t.PrepareStatement(ctx, body, custom...)
 
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("Failed to index %s table, %w", t.Name(), err)
+		return nil, err
+	}
+
+	if stmt == nil {
+		return nil, nil
 	}
 
-	err = tx.Commit()
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("replace")
+
+	rsp, err := ex.ExecContext(ctx, stmt.Query, stmt.Args...)
 
 	if err != nil {
-		return fmt.Errorf("Failed to commit transaction, %w", err)
+		return nil, fmt.Errorf("Failed to update geojson table, %w", err)
 	}
 
-	return nil
+	return rsp, nil
 }
 
-func (t *GeoJSONTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []byte, custom ...interface{}) error {
+// PrepareStatement returns the `Statement` used to index 'body' in the table, or nil if 'body' should not be indexed in the table.
+func (t *GeoJSONTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
 
 	id, err := properties.Id(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to derive ID, %w", err)
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
 	}
 
 	var alt *uri.AltGeom
@@ -94,6 +184,9 @@ func (t *GeoJSONTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []byte
 		alt = custom[0].(*uri.AltGeom)
 	}
 
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
 	lastmod := properties.LastModified(body)
 
 	str_alt := ""
@@ -103,21 +196,55 @@ func (t *GeoJSONTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []byte
 		str_alt, err = alt.String()
 
 		if err != nil {
-			return fmt.Errorf("Failed to stringify alt, %w", err)
+			return nil, fmt.Errorf("Failed to stringify alt, %w", err)
 		}
+
+		span.SetAttributes(tracing.ATTRIBUTE_ALT.String(str_alt))
+	}
+
+	codec := t.options.Codec
+
+	enc_body, err := EncodeBody(codec, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if codec != CODEC_NONE {
+		span.SetAttributes(attribute.String("codec", codec))
 	}
 
 	q := fmt.Sprintf(`REPLACE INTO %s (
-		id, alt, body, lastmodified
+		id, alt, body, %s, lastmodified
 	) VALUES (
-		?, ?, ?, ?
-	)`, wof_tables.GEOJSON_TABLE_NAME)
+		?, ?, ?, ?, ?
+	)`, wof_tables.GEOJSON_TABLE_NAME, CODEC_COLUMN)
+
+	stmt := &Statement{
+		Query: q,
+		Args:  []interface{}{id, str_alt, enc_body, codec, lastmod},
+	}
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if errors.Is(err, ErrPacketTooLarge) && HasOversizedStrategy(t.options.OversizedStrategy, OVERSIZED_COMPRESS) && codec == CODEC_NONE {
+
+		compressed, gzip_err := gzipBody(body)
 
-	_, err = tx.ExecContext(ctx, q, id, str_alt, string(body), lastmod)
+		if gzip_err != nil {
+			return nil, gzip_err
+		}
+
+		stmt.Args[2] = compressed
+		stmt.Args[3] = CODEC_GZIP
+		span.SetAttributes(attribute.Bool("compressed", true))
+
+		err = checkStatementSize(stmt, t.options.MaxPacketSize)
+	}
 
 	if err != nil {
-		return fmt.Errorf("Failed to update geojson table, %w", err)
+		return nil, err
 	}
 
-	return nil
+	return stmt, nil
 }
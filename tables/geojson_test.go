@@ -0,0 +1,150 @@
+package tables
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+func TestGeoJSONTablePrepareStatement(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts, err := DefaultGeoJSONTableOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create table options, %v", err)
+	}
+
+	tbl, err := NewGeoJSONTableWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create table, %v", err)
+	}
+
+	body := []byte(`{"type":"Feature","properties":{"wof:id":101736545,"wof:lastmodified":1700000000},"geometry":{"type":"Point","coordinates":[0,0]}}`)
+
+	alt := &uri.AltGeom{
+		Source: "quattroshapes",
+	}
+
+	tests := []struct {
+		name   string
+		custom []interface{}
+		alt    string
+	}{
+		{"default", nil, ""},
+		{"alternate", []interface{}{alt}, "quattroshapes"},
+	}
+
+	for _, test := range tests {
+
+		stmt, err := tbl.(StatementTable).PrepareStatement(ctx, body, test.custom...)
+
+		if err != nil {
+			t.Fatalf("Failed to prepare statement for %s, %v", test.name, err)
+		}
+
+		if len(stmt.Args) != 5 {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, stmt.Args)
+		}
+
+		if stmt.Args[0] != int64(101736545) || stmt.Args[1] != test.alt || !bytes.Equal(stmt.Args[2].([]byte), body) || stmt.Args[3] != CODEC_NONE || stmt.Args[4] != int64(1700000000) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, stmt.Args)
+		}
+	}
+
+	_, err = tbl.(StatementTable).PrepareStatement(ctx, []byte(`{"type":"Feature","properties":{}}`))
+
+	if err == nil {
+		t.Fatalf("Expected a record without an ID to fail")
+	}
+}
+
+func TestGeoJSONTablePrepareStatementOversized(t *testing.T) {
+
+	ctx := context.Background()
+
+	props := fmt.Sprintf(`{"wof:id":101736545,"wof:name":"%s"}`, strings.Repeat("Montréal ", 1000))
+	body := []byte(fmt.Sprintf(`{"type":"Feature","properties":%s,"geometry":{"type":"Point","coordinates":[0,0]}}`, props))
+
+	tests := []struct {
+		strategy   string
+		max_packet int
+		compressed bool
+		ok         bool
+	}{
+		{OVERSIZED_FAIL, 0, false, true},
+		{OVERSIZED_FAIL, 1024, false, false},
+		{OVERSIZED_SIMPLIFY, 1024, false, false},
+		{"compress,simplify", 1024, true, true},
+		{OVERSIZED_COMPRESS, 64, false, false},
+	}
+
+	for _, test := range tests {
+
+		opts, err := DefaultGeoJSONTableOptions()
+
+		if err != nil {
+			t.Fatalf("Failed to create table options, %v", err)
+		}
+
+		opts.MaxPacketSize = test.max_packet
+		opts.OversizedStrategy = test.strategy
+
+		tbl, err := NewGeoJSONTableWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create table, %v", err)
+		}
+
+		stmt, err := tbl.(StatementTable).PrepareStatement(ctx, body)
+
+		if !test.ok {
+
+			if !errors.Is(err, ErrPacketTooLarge) {
+				t.Fatalf("Expected '%s' with max packet %d to fail, %v", test.strategy, test.max_packet, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to prepare statement for '%s' with max packet %d, %v", test.strategy, test.max_packet, err)
+		}
+
+		compressed := stmt.Args[2].([]byte)
+		is_compressed := stmt.Args[3] == CODEC_GZIP
+
+		if is_compressed != test.compressed {
+			t.Fatalf("Unexpected body for '%s' with max packet %d", test.strategy, test.max_packet)
+		}
+
+		if !is_compressed {
+			continue
+		}
+
+		gz, err := gzip.NewReader(bytes.NewReader(compressed))
+
+		if err != nil {
+			t.Fatalf("Failed to create gzip reader, %v", err)
+		}
+
+		decompressed, err := io.ReadAll(gz)
+
+		if err != nil {
+			t.Fatalf("Failed to decompress body, %v", err)
+		}
+
+		if !bytes.Equal(decompressed, body) {
+			t.Fatalf("Decompressed body does not match original body")
+		}
+	}
+}
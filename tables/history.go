@@ -0,0 +1,385 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the table where previous versions of the records in the "geojson" table are stored.
+const HISTORY_TABLE_NAME string = "geojson_history"
+
+const history_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      id BIGINT UNSIGNED NOT NULL,
+      alt VARCHAR(255) NOT NULL,
+      lastmodified INT NOT NULL,
+      body LONGBLOB NOT NULL,
+      %s VARCHAR(16) NOT NULL DEFAULT '',
+      replaced_at INT NOT NULL,
+      PRIMARY KEY (id, alt, lastmodified),
+      KEY replaced_at (replaced_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+// HistoryTable stores the previous versions of records in the "geojson" table. When a record is indexed the existing
+// row in the "geojson" table, if its "lastmodified" value differs from the new record's, is copied to this table. This
+// means that the table must be indexed before the "geojson" table and in the same transaction.
+type HistoryTable struct {
+	*tableIndexer
+	options *HistoryTableOptions
+}
+
+// HistoryRetention defines how long previous versions of a record are kept in the "geojson_history" table.
+type HistoryRetention struct {
+	// MaxAge is the maximum amount of time since a version was replaced after which it is removed. If 0 versions are
+	// not removed because of their age.
+	MaxAge time.Duration
+	// MaxVersions is the maximum number of previous versions kept for each record. If 0 the number of versions is not limited.
+	MaxVersions int
+}
+
+// HistoryTableOptions defines options for indexing records in the "geojson_history" table.
+type HistoryTableOptions struct {
+	IndexOptions
+	// Retention defines how long previous versions are kept. Versions are removed when newer versions of the same
+	// record are added. If nil versions are kept indefinitely.
+	Retention *HistoryRetention
+}
+
+// DefaultHistoryTableOptions returns a new `HistoryTableOptions` instance with default values.
+func DefaultHistoryTableOptions() (*HistoryTableOptions, error) {
+
+	opts := &HistoryTableOptions{
+		IndexOptions: defaultIndexOptions(),
+	}
+
+	return opts, nil
+}
+
+func NewHistoryTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
+
+	opts, err := DefaultHistoryTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default history table options, %w", err)
+	}
+
+	return NewHistoryTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewHistoryTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *HistoryTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewHistoryTableWithOptions(ctx, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new history table, %w", err)
+	}
+
+	err = t.InitializeTable(ctx, db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize history table, %w", err)
+	}
+
+	return t, nil
+}
+
+func NewHistoryTable(ctx context.Context) (wof_sql.Table, error) {
+
+	opts, err := DefaultHistoryTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default history table options, %w", err)
+	}
+
+	return NewHistoryTableWithOptions(ctx, opts)
+}
+
+func NewHistoryTableWithOptions(ctx context.Context, opts *HistoryTableOptions) (wof_sql.Table, error) {
+
+	if opts.Retention != nil && (opts.Retention.MaxAge < 0 || opts.Retention.MaxVersions < 0) {
+		return nil, fmt.Errorf("Invalid retention policy, values must not be negative")
+	}
+
+	t := &HistoryTable{
+		options: opts,
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
+}
+
+func (t *HistoryTable) Name() string {
+	return HISTORY_TABLE_NAME
+}
+
+func (t *HistoryTable) Schema() string {
+	return fmt.Sprintf(history_schema, HISTORY_TABLE_NAME, CODEC_COLUMN)
+}
+
+// InitializeTable creates the "geojson_history" table if necessary. The "geojson" table's "codec" column, which
+// versions are copied from, is also added if it is missing.
+func (t *HistoryTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
+
+	err := wof_sql.CreateTableIfNecessary(ctx, db, t)
+
+	if err != nil {
+		return err
+	}
+
+	return EnsureCodecColumn(ctx, db)
+}
+
+// indexFeature copies the existing version of 'body' in the "geojson" table using 'ex'. Records that are not already
+// present in the "geojson" table, or whose "lastmodified" value has not changed, are reported as skipped.
+func (t *HistoryTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	id, str_alt, err := t.versionKey(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := t.PrepareStatement(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("insert")
+
+	rsp, err := ex.ExecContext(ctx, stmt.Query, stmt.Args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update history table, %w", err)
+	}
+
+	affected, err := rsp.RowsAffected()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine rows affected, %w", err)
+	}
+
+	if affected == 0 {
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return nil, nil
+	}
+
+	if t.options.Retention != nil {
+
+		span.AddEvent("prune")
+
+		err := pruneRecordHistory(ctx, ex, t.options.Retention, id, str_alt)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rsp, nil
+}
+
+// PrepareStatement returns the `Statement` used to copy the existing version of 'body' from the "geojson" table to the
+// "geojson_history" table. The statement does nothing if there is no existing version or if its "lastmodified" value
+// matches that of 'body'.
+func (t *HistoryTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
+
+	id, str_alt, err := t.versionKey(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lastmod := properties.LastModified(body)
+
+	// If the same version has been replaced before (for example a record that was reverted) the existing
+	// row is updated rather than failing with a duplicate key error.
+
+	q := fmt.Sprintf(`INSERT INTO %s (
+		id, alt, lastmodified, body, %s, replaced_at
+	) SELECT
+		g.id, g.alt, g.lastmodified, g.body, g.%s, ?
+	FROM %s AS g WHERE g.id = ? AND g.alt = ? AND g.lastmodified != ?
+	ON DUPLICATE KEY UPDATE body = g.body, %s = g.%s, replaced_at = ?`,
+		HISTORY_TABLE_NAME, CODEC_COLUMN, CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME, CODEC_COLUMN, CODEC_COLUMN)
+
+	now := time.Now().Unix()
+
+	stmt := &Statement{
+		Query: q,
+		Args:  []interface{}{now, id, str_alt, lastmod, now},
+	}
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// versionKey returns the ID of 'body' and the string representation of its alternate geometry label, if present.
+func (t *HistoryTable) versionKey(ctx context.Context, body []byte, custom ...interface{}) (int64, string, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
+	var alt *uri.AltGeom
+
+	if len(custom) >= 1 {
+		alt = custom[0].(*uri.AltGeom)
+	}
+
+	if alt == nil {
+		return id, "", nil
+	}
+
+	str_alt, err := alt.String()
+
+	if err != nil {
+		return -1, "", fmt.Errorf("Failed to stringify alt, %w", err)
+	}
+
+	span.SetAttributes(tracing.ATTRIBUTE_ALT.String(str_alt))
+
+	return id, str_alt, nil
+}
+
+// PruneHistory removes the versions in the "geojson_history" table that are older than 'retention' allows, for all
+// records, and returns the number of versions removed.
+func PruneHistory(ctx context.Context, ex Execer, retention *HistoryRetention) (int64, error) {
+
+	removed := int64(0)
+
+	if retention.MaxAge > 0 {
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE replaced_at < ?", HISTORY_TABLE_NAME)
+
+		rsp, err := ex.ExecContext(ctx, q, time.Now().Add(-retention.MaxAge).Unix())
+
+		if err != nil {
+			return removed, fmt.Errorf("Failed to remove expired versions, %w", err)
+		}
+
+		count, _ := rsp.RowsAffected()
+		removed += count
+	}
+
+	if retention.MaxVersions > 0 {
+
+		// A version is removed if there are at least MaxVersions newer versions of the same record. This
+		// uses a self-join, rather than window functions, so that it works with MySQL 5.7. The derived
+		// table is materialized (because it is grouped) which allows it to select from the table being
+		// deleted from.
+
+		q := fmt.Sprintf(`DELETE h FROM %s AS h JOIN (
+			SELECT a.id, a.alt, a.lastmodified FROM %s AS a
+			JOIN %s AS b ON b.id = a.id AND b.alt = a.alt AND b.lastmodified > a.lastmodified
+			GROUP BY a.id, a.alt, a.lastmodified
+			HAVING COUNT(*) >= ?
+		) AS v ON h.id = v.id AND h.alt = v.alt AND h.lastmodified = v.lastmodified`, HISTORY_TABLE_NAME, HISTORY_TABLE_NAME, HISTORY_TABLE_NAME)
+
+		rsp, err := ex.ExecContext(ctx, q, retention.MaxVersions)
+
+		if err != nil {
+			return removed, fmt.Errorf("Failed to remove excess versions, %w", err)
+		}
+
+		count, _ := rsp.RowsAffected()
+		removed += count
+	}
+
+	return removed, nil
+}
+
+// pruneRecordHistory removes the versions of the record matching 'id' and 'alt' in the "geojson_history" table that are
+// older than 'retention' allows.
+func pruneRecordHistory(ctx context.Context, ex Execer, retention *HistoryRetention, id int64, alt string) error {
+
+	if retention.MaxAge > 0 {
+
+		q := fmt.Sprintf("DELETE FROM %s WHERE id = ? AND alt = ? AND replaced_at < ?", HISTORY_TABLE_NAME)
+
+		_, err := ex.ExecContext(ctx, q, id, alt, time.Now().Add(-retention.MaxAge).Unix())
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove expired versions, %w", err)
+		}
+	}
+
+	if retention.MaxVersions > 0 {
+
+		// The derived table is materialized which is what allows it to select from the table being deleted from.
+		// If there are not enough versions it is empty and the comparison with NULL removes nothing.
+
+		q := fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND alt = ? AND lastmodified <= (
+			SELECT lastmodified FROM (
+				SELECT lastmodified FROM %s WHERE id = ? AND alt = ? ORDER BY lastmodified DESC LIMIT 1 OFFSET ?
+			) AS oldest
+		)`, HISTORY_TABLE_NAME, HISTORY_TABLE_NAME)
+
+		_, err := ex.ExecContext(ctx, q, id, alt, id, alt, retention.MaxVersions)
+
+		if err != nil {
+			return fmt.Errorf("Failed to remove excess versions, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GeoJSONBodyAsOf returns the decoded body of the version of the record matching 'id' and 'alt' that was current at 't',
+// which is the version in the "geojson" or "geojson_history" tables with the most recent "lastmodified" value that is not
+// after 't'. It returns `sql.ErrNoRows` if there is no matching version.
+func GeoJSONBodyAsOf(ctx context.Context, q Querier, id int64, alt string, t time.Time) ([]byte, error) {
+	return geojsonVersion(ctx, q, id, alt, "lastmodified <= ?", t.Unix())
+}
+
+// GeoJSONBodyWithLastModified returns the decoded body of the version of the record matching 'id' and 'alt' whose
+// "lastmodified" value is 'lastmod', from either the "geojson" or "geojson_history" tables. It returns `sql.ErrNoRows`
+// if there is no matching version.
+func GeoJSONBodyWithLastModified(ctx context.Context, q Querier, id int64, alt string, lastmod int64) ([]byte, error) {
+	return geojsonVersion(ctx, q, id, alt, "lastmodified = ?", lastmod)
+}
+
+// geojsonVersion returns the decoded body of the most recent version of the record matching 'id', 'alt' and the
+// condition 'where' on the "lastmodified" column in either the "geojson" or "geojson_history" tables.
+func geojsonVersion(ctx context.Context, q Querier, id int64, alt string, where string, lastmod int64) ([]byte, error) {
+
+	query := fmt.Sprintf(`SELECT body, %s FROM (
+		SELECT body, %s, lastmodified FROM %s WHERE id = ? AND alt = ? AND %s
+		UNION ALL
+		SELECT body, %s, lastmodified FROM %s WHERE id = ? AND alt = ? AND %s
+	) AS versions ORDER BY lastmodified DESC LIMIT 1`,
+		CODEC_COLUMN,
+		CODEC_COLUMN, wof_tables.GEOJSON_TABLE_NAME, where,
+		CODEC_COLUMN, HISTORY_TABLE_NAME, where)
+
+	var body []byte
+	var codec string
+
+	err := q.QueryRowContext(ctx, query, id, alt, lastmod, id, alt, lastmod).Scan(&body, &codec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeBody(codec, body)
+}
@@ -0,0 +1,178 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// recordingExecer is an `Execer` that records the statements it is asked to execute and reports a fixed number of
+// rows affected for each of them.
+type recordingExecer struct {
+	affected   int64
+	statements []string
+	args       [][]interface{}
+}
+
+func (ex *recordingExecer) ExecContext(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	ex.statements = append(ex.statements, q)
+	ex.args = append(ex.args, args)
+	return rowsAffected(ex.affected), nil
+}
+
+func TestNewHistoryTableWithOptions(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		retention *HistoryRetention
+		ok        bool
+	}{
+		{"none", nil, true},
+		{"valid", &HistoryRetention{MaxAge: time.Hour, MaxVersions: 10}, true},
+		{"negative age", &HistoryRetention{MaxAge: -time.Hour}, false},
+		{"negative versions", &HistoryRetention{MaxVersions: -1}, false},
+	}
+
+	for _, test := range tests {
+
+		opts, err := DefaultHistoryTableOptions()
+
+		if err != nil {
+			t.Fatalf("Failed to create table options, %v", err)
+		}
+
+		opts.Retention = test.retention
+
+		_, err = NewHistoryTableWithOptions(ctx, opts)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result for %s, %v", test.name, err)
+		}
+	}
+}
+
+func TestHistoryTableIndexFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	body := []byte(`{"type":"Feature","properties":{"wof:id":101736545,"wof:lastmodified":1700000000},"geometry":{"type":"Point","coordinates":[0,0]}}`)
+
+	alt := &uri.AltGeom{
+		Source: "quattroshapes",
+	}
+
+	tests := []struct {
+		name      string
+		custom    []interface{}
+		retention *HistoryRetention
+		affected  int64
+		alt       string
+		// The number of statements executed, including the statement that copies the existing version
+		statements int
+		skipped    bool
+	}{
+		// Nothing is copied for new records, or records whose lastmodified value has not changed
+		{"unchanged", nil, &HistoryRetention{MaxAge: time.Hour}, 0, "", 1, true},
+		{"replaced", nil, nil, 1, "", 1, false},
+		{"max age", nil, &HistoryRetention{MaxAge: time.Hour}, 1, "", 2, false},
+		{"max age and versions", nil, &HistoryRetention{MaxAge: time.Hour, MaxVersions: 5}, 1, "", 3, false},
+		{"alternate", []interface{}{alt}, nil, 1, "quattroshapes", 1, false},
+	}
+
+	for _, test := range tests {
+
+		opts, err := DefaultHistoryTableOptions()
+
+		if err != nil {
+			t.Fatalf("Failed to create table options, %v", err)
+		}
+
+		opts.Retention = test.retention
+
+		tbl, err := NewHistoryTableWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create table for %s, %v", test.name, err)
+		}
+
+		ex := &recordingExecer{
+			affected: test.affected,
+		}
+
+		rsp, err := tbl.(*HistoryTable).indexFeature(ctx, ex, body, test.custom...)
+
+		if err != nil {
+			t.Fatalf("Failed to index feature for %s, %v", test.name, err)
+		}
+
+		if (rsp == nil) != test.skipped {
+			t.Fatalf("Unexpected result for %s, %v", test.name, rsp)
+		}
+
+		if len(ex.statements) != test.statements {
+			t.Fatalf("Unexpected statements for %s: %v", test.name, ex.statements)
+		}
+
+		if !strings.HasPrefix(strings.TrimSpace(ex.statements[0]), "INSERT INTO geojson_history") {
+			t.Fatalf("Unexpected statement for %s: %s", test.name, ex.statements[0])
+		}
+
+		// The copy statement's arguments are (replaced_at, id, alt, lastmodified, replaced_at)
+
+		args := ex.args[0]
+
+		if args[1] != int64(101736545) || args[2] != test.alt || args[3] != int64(1700000000) {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, args)
+		}
+
+		for i, q := range ex.statements[1:] {
+
+			if !strings.HasPrefix(strings.TrimSpace(q), "DELETE FROM geojson_history WHERE id = ? AND alt = ?") {
+				t.Fatalf("Unexpected prune statement %d for %s: %s", i, test.name, q)
+			}
+		}
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		retention  *HistoryRetention
+		statements int
+	}{
+		{"none", &HistoryRetention{}, 0},
+		{"max age", &HistoryRetention{MaxAge: time.Hour}, 1},
+		{"max versions", &HistoryRetention{MaxVersions: 5}, 1},
+		{"both", &HistoryRetention{MaxAge: time.Hour, MaxVersions: 5}, 2},
+	}
+
+	for _, test := range tests {
+
+		ex := &recordingExecer{
+			affected: 2,
+		}
+
+		removed, err := PruneHistory(ctx, ex, test.retention)
+
+		if err != nil {
+			t.Fatalf("Failed to prune history for %s, %v", test.name, err)
+		}
+
+		if len(ex.statements) != test.statements {
+			t.Fatalf("Unexpected statements for %s: %v", test.name, ex.statements)
+		}
+
+		if removed != int64(2*test.statements) {
+			t.Fatalf("Unexpected number of versions removed for %s: %d", test.name, removed)
+		}
+	}
+}
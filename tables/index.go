@@ -0,0 +1,154 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/retry"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+)
+
+// IndexOptions defines the options, common to every table, for indexing records.
+type IndexOptions struct {
+	// RetryPolicy defines the rules for retrying transactions that fail with transient errors.
+	RetryPolicy *retry.Policy
+	// IsolationLevel is the transaction isolation level used by the `IndexRecord` method.
+	IsolationLevel sql.IsolationLevel
+	// UseTransaction indicates whether the `IndexRecord` method should index records inside an explicit transaction.
+	UseTransaction bool
+	// Stats records running totals for the records indexed by the table.
+	Stats *Stats
+	// MaxPacketSize is the maximum size, in bytes, of the statement used to index a record. If 0 statements are not checked.
+	MaxPacketSize int
+	// OversizedStrategy is the strategy, or comma-separated list of strategies, used to handle records whose statements exceed MaxPacketSize.
+	OversizedStrategy string
+}
+
+// defaultIndexOptions returns a new `IndexOptions` instance with default values.
+func defaultIndexOptions() IndexOptions {
+
+	return IndexOptions{
+		RetryPolicy:       retry.DefaultPolicy(),
+		IsolationLevel:    DEFAULT_ISOLATION_LEVEL,
+		UseTransaction:    true,
+		Stats:             NewStats(),
+		OversizedStrategy: OVERSIZED_FAIL,
+	}
+}
+
+// indexFeatureFunc indexes 'body' in a table using 'ex'. It returns the result of the statement used to index 'body'
+// or nil if 'body' was skipped.
+type indexFeatureFunc func(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error)
+
+// tableIndexer implements the `IndexRecord`, `IndexFeature` and `IndexFeatureWithExecer` methods shared by every table.
+// It wraps a table's `indexFeatureFunc` with retries, transactions, statistics, metrics and tracing.
+type tableIndexer struct {
+	name    string
+	options *IndexOptions
+	index   indexFeatureFunc
+}
+
+// newTableIndexer returns a new `tableIndexer` for the table named 'name' which indexes records using 'index'.
+func newTableIndexer(name string, options *IndexOptions, index indexFeatureFunc) *tableIndexer {
+
+	return &tableIndexer{
+		name:    name,
+		options: options,
+		index:   index,
+	}
+}
+
+// IndexRecord indexes 'i', which is expected to be a byte slice, retrying transient errors.
+func (ti *tableIndexer) IndexRecord(ctx context.Context, db wof_sql.Database, i interface{}, custom ...interface{}) error {
+
+	body := i.([]byte)
+
+	index := func(ctx context.Context) error {
+		return ti.indexRecord(ctx, db, body, custom...)
+	}
+
+	if ti.options.RetryPolicy == nil {
+		return index(ctx)
+	}
+
+	retries, err := ti.options.RetryPolicy.Do(ctx, index)
+
+	if err != nil {
+		return fmt.Errorf("Failed to index record after %d retries, %w", retries, err)
+	}
+
+	return nil
+}
+
+// indexRecord indexes 'body' in its own transaction, unless transactions have been disabled.
+func (ti *tableIndexer) indexRecord(ctx context.Context, db wof_sql.Database, body []byte, custom ...interface{}) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	if !ti.options.UseTransaction {
+
+		err := ti.IndexFeatureWithExecer(ctx, conn, body, custom...)
+
+		if err != nil {
+			return fmt.Errorf("Failed to index %s table, %w", ti.name, err)
+		}
+
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: ti.options.IsolationLevel})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	err = ti.IndexFeature(ctx, tx, body, custom...)
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to index %s table, %w", ti.name, err)
+	}
+
+	_, span := tracing.Start(ctx, fmt.Sprintf("%s.commit", ti.name), tracing.ATTRIBUTE_TABLE.String(ti.name))
+
+	err = tx.Commit()
+
+	tracing.End(span, err)
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+// IndexFeature indexes 'body' using 'tx'.
+func (ti *tableIndexer) IndexFeature(ctx context.Context, tx *sql.Tx, body []byte, custom ...interface{}) error {
+	return ti.IndexFeatureWithExecer(ctx, tx, body, custom...)
+}
+
+// IndexFeatureWithExecer indexes 'body' using 'ex' which may be a `sql.Tx`, `sql.Conn` or `sql.DB` instance.
+func (ti *tableIndexer) IndexFeatureWithExecer(ctx context.Context, ex Execer, body []byte, custom ...interface{}) error {
+
+	ctx, span := tracing.Start(ctx, fmt.Sprintf("%s.IndexFeature", ti.name), tracing.ATTRIBUTE_TABLE.String(ti.name))
+
+	t0 := time.Now()
+
+	rsp, err := ti.index(ctx, ex, body, custom...)
+
+	d := time.Since(t0)
+
+	tracing.End(span, err)
+
+	ti.options.Stats.Record(rsp, len(body), d, err)
+	recordMetrics(ti.name, d, err)
+
+	return err
+}
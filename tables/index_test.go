@@ -0,0 +1,63 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+// rowsAffected is a `sql.Result` that reports a fixed number of rows affected.
+type rowsAffected int64
+
+func (r rowsAffected) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r rowsAffected) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func TestTableIndexerIndexFeatureWithExecer(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		rsp      sql.Result
+		err      error
+		expected StatsSummary
+	}{
+		{"inserted", rowsAffected(1), nil, StatsSummary{Inserted: 1, Bytes: 4}},
+		{"replaced", rowsAffected(2), nil, StatsSummary{Replaced: 1, Bytes: 4}},
+		{"skipped", nil, nil, StatsSummary{Skipped: 1}},
+		{"failed", nil, fmt.Errorf("Failed"), StatsSummary{Failed: 1}},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			opts := defaultIndexOptions()
+
+			index := func(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+				return test.rsp, test.err
+			}
+
+			ti := newTableIndexer("test", &opts, index)
+
+			err := ti.IndexFeatureWithExecer(ctx, nil, []byte("body"))
+
+			if err != test.err {
+				t.Fatalf("Unexpected error, %v", err)
+			}
+
+			summary := opts.Stats.Summary()
+			summary.Duration = 0
+
+			if *summary != test.expected {
+				t.Fatalf("Unexpected stats: %+v", summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package tables
+
+import (
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/retry"
+)
+
+// recordMetrics updates the package-level metrics defined in the `metrics` package for a record indexed in 'table'.
+func recordMetrics(table string, d time.Duration, err error) {
+
+	metrics.TableIndexDuration.WithLabelValues(table).Observe(d.Seconds())
+
+	if err != nil {
+		metrics.TableErrorsTotal.WithLabelValues(table, retry.ErrorLabel(err)).Inc()
+	}
+}
@@ -0,0 +1,54 @@
+package tables
+
+import (
+	"context"
+	"fmt"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// The name of the generated, and indexed, column in the "whosonfirst" table for the "wof:name" property.
+const NAME_COLUMN string = "name"
+
+// EnsureNameColumn adds an indexed column, generated from the "wof:name" property, to the "whosonfirst" table in 'db'
+// if it is not already present. The column uses the table's default collation so, for the default MySQL 8 collation,
+// prefix queries using LIKE are case-insensitive and can use the index.
+func EnsureNameColumn(ctx context.Context, db wof_sql.Database) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	q := "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+
+	var count int
+
+	err = conn.QueryRowContext(ctx, q, wof_tables.WHOSONFIRST_TABLE_NAME, NAME_COLUMN).Scan(&count)
+
+	if err != nil {
+		return fmt.Errorf("Failed to determine whether %s column exists, %w", NAME_COLUMN, err)
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err = conn.ExecContext(ctx, nameColumnStatement())
+
+	if err != nil {
+		return fmt.Errorf("Failed to add %s column, %w", NAME_COLUMN, err)
+	}
+
+	return nil
+}
+
+// nameColumnStatement returns the statement used to add the "name" column, and its index, to the "whosonfirst" table.
+// Names are truncated to the length of the column so that records with very long names can still be indexed.
+func nameColumnStatement() string {
+
+	return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s VARCHAR(255) GENERATED ALWAYS AS (LEFT(JSON_UNQUOTE(JSON_EXTRACT(properties,'$."wof:name"')), 255)) VIRTUAL, ADD KEY %s (%s)`,
+		wof_tables.WHOSONFIRST_TABLE_NAME, NAME_COLUMN, NAME_COLUMN, NAME_COLUMN)
+}
@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameColumnStatement(t *testing.T) {
+
+	q := nameColumnStatement()
+
+	tests := []string{
+		"ALTER TABLE whosonfirst ADD COLUMN name VARCHAR(255)",
+		`LEFT(JSON_UNQUOTE(JSON_EXTRACT(properties,'$."wof:name"')), 255)`,
+		"VIRTUAL",
+		"ADD KEY name (name)",
+	}
+
+	for _, expected := range tests {
+
+		if !strings.Contains(q, expected) {
+			t.Fatalf("Expected statement to contain '%s', got '%s'", expected, q)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package tables
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPacketTooLarge is returned when the statement used to index a record exceeds the database server's `max_allowed_packet` setting.
+var ErrPacketTooLarge = errors.New("Statement exceeds max_allowed_packet")
+
+// OVERSIZED_FAIL is the strategy for oversized records that returns an error wrapping `ErrPacketTooLarge`.
+const OVERSIZED_FAIL string = "fail"
+
+// OVERSIZED_COMPRESS is the strategy for oversized records that stores the record's body gzip-compressed.
+// It applies to the "geojson" table, which is the only table that stores record bodies.
+const OVERSIZED_COMPRESS string = "compress"
+
+// OVERSIZED_SIMPLIFY is the strategy for oversized records that stores a simplified copy of the record's geometry.
+// It applies to the "whosonfirst" table; the "geojson" table always stores the full, unsimplified, record.
+const OVERSIZED_SIMPLIFY string = "simplify"
+
+// OVERSIZED_SKIP is the strategy for oversized records that skips the record entirely. Tables treat this the same way as
+// `OVERSIZED_FAIL` and it is left to the caller (for example `writer.MySQLWriter`) to skip the record.
+const OVERSIZED_SKIP string = "skip"
+
+// ParseOversizedStrategy ensures that 'str' is a valid strategy, or comma-separated list of strategies, for handling
+// oversized records. Each table applies the strategies that are meaningful to it so, for example, "compress,simplify"
+// compresses bodies in the "geojson" table and simplifies geometries in the "whosonfirst" table. `OVERSIZED_SKIP` may
+// be combined with other strategies in which case records are only skipped if they are still too large. `OVERSIZED_FAIL`
+// may not be combined with other strategies.
+func ParseOversizedStrategy(str string) (string, error) {
+
+	strategies := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, s := range strings.Split(strings.ToLower(str), ",") {
+
+		s = strings.TrimSpace(s)
+
+		switch s {
+		case OVERSIZED_FAIL, OVERSIZED_COMPRESS, OVERSIZED_SIMPLIFY, OVERSIZED_SKIP:
+			// pass
+		default:
+			return "", fmt.Errorf("Invalid or unsupported oversized strategy '%s'", s)
+		}
+
+		if seen[s] {
+			continue
+		}
+
+		seen[s] = true
+		strategies = append(strategies, s)
+	}
+
+	if seen[OVERSIZED_FAIL] && len(strategies) > 1 {
+		return "", fmt.Errorf("The '%s' oversized strategy can not be combined with other strategies", OVERSIZED_FAIL)
+	}
+
+	return strings.Join(strategies, ","), nil
+}
+
+// HasOversizedStrategy returns a boolean value indicating whether 'strategy', as returned by `ParseOversizedStrategy`,
+// includes 's'.
+func HasOversizedStrategy(strategy string, s string) bool {
+
+	for _, candidate := range strings.Split(strategy, ",") {
+
+		if candidate == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkStatementSize returns an error wrapping `ErrPacketTooLarge` if the size of 'stmt' exceeds 'max_packet'. If 'max_packet'
+// is less than or equal to zero no check is performed.
+func checkStatementSize(stmt *Statement, max_packet int) error {
+
+	if max_packet <= 0 {
+		return nil
+	}
+
+	size := stmt.Size()
+
+	if size > max_packet {
+		return fmt.Errorf("%w (%d > %d bytes)", ErrPacketTooLarge, size, max_packet)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package tables
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseOversizedStrategy(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected string
+		ok       bool
+	}{
+		{"fail", "fail", true},
+		{"COMPRESS", "compress", true},
+		{"compress,simplify", "compress,simplify", true},
+		{"compress, simplify, skip", "compress,simplify,skip", true},
+		{"simplify,simplify", "simplify", true},
+		{"fail,compress", "", false},
+		{"ignore", "", false},
+		{"compress,", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+
+		v, err := ParseOversizedStrategy(test.str)
+
+		if (err == nil) != test.ok {
+			t.Fatalf("Unexpected result parsing '%s', %v", test.str, err)
+		}
+
+		if v != test.expected {
+			t.Fatalf("Unexpected strategy for '%s': '%s'", test.str, v)
+		}
+	}
+}
+
+func TestHasOversizedStrategy(t *testing.T) {
+
+	tests := []struct {
+		strategy string
+		s        string
+		expected bool
+	}{
+		{"compress,simplify", OVERSIZED_COMPRESS, true},
+		{"compress,simplify", OVERSIZED_SIMPLIFY, true},
+		{"compress,simplify", OVERSIZED_SKIP, false},
+		{"skip", OVERSIZED_SKIP, true},
+		{"fail", OVERSIZED_COMPRESS, false},
+	}
+
+	for _, test := range tests {
+
+		if HasOversizedStrategy(test.strategy, test.s) != test.expected {
+			t.Fatalf("Unexpected result for '%s' in '%s'", test.s, test.strategy)
+		}
+	}
+}
+
+func TestCheckStatementSize(t *testing.T) {
+
+	stmt := &Statement{Query: "?", Args: []interface{}{"abcdefghi"}}
+
+	tests := []struct {
+		max_packet int
+		too_large  bool
+	}{
+		{0, false},
+		{-1, false},
+		{10, false},
+		{9, true},
+	}
+
+	for _, test := range tests {
+
+		err := checkStatementSize(stmt, test.max_packet)
+
+		if errors.Is(err, ErrPacketTooLarge) != test.too_large {
+			t.Fatalf("Unexpected result for max packet %d, %v", test.max_packet, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tables
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// Stats records running totals for the records indexed by a table. The counts reflect the statements
+// executed by the table so a record indexed inside a transaction that is subsequently rolled back
+// will still be counted.
+type Stats struct {
+	inserted *atomic.Int64
+	replaced *atomic.Int64
+	skipped  *atomic.Int64
+	failed   *atomic.Int64
+	bytes    *atomic.Int64
+	duration *atomic.Int64
+}
+
+// StatsSummary is a point-in-time summary of the values recorded by a `Stats` instance.
+type StatsSummary struct {
+	// The number of records that were inserted as new rows.
+	Inserted int64 `json:"inserted"`
+	// The number of records that replaced existing rows.
+	Replaced int64 `json:"replaced"`
+	// The number of records that were not indexed because they don't apply to the table (for example alternate geometries).
+	Skipped int64 `json:"skipped"`
+	// The number of records that failed to be indexed.
+	Failed int64 `json:"failed"`
+	// The total number of bytes of the records that were indexed (inserted or replaced).
+	Bytes int64 `json:"bytes"`
+	// The total amount of time spent indexing records.
+	Duration time.Duration `json:"duration"`
+}
+
+// NewStats returns a new `Stats` instance.
+func NewStats() *Stats {
+
+	s := &Stats{
+		inserted: new(atomic.Int64),
+		replaced: new(atomic.Int64),
+		skipped:  new(atomic.Int64),
+		failed:   new(atomic.Int64),
+		bytes:    new(atomic.Int64),
+		duration: new(atomic.Int64),
+	}
+
+	return s
+}
+
+// Record updates 's' with the outcome of indexing a record whose size is 'size' bytes. A nil 'rsp'
+// with a nil 'err' indicates that the record was skipped. Otherwise rows affected by 'rsp' are used to
+// distinguish between inserts (1) and replacements (2) as reported by MySQL for `REPLACE` statements.
+func (s *Stats) Record(rsp sql.Result, size int, d time.Duration, err error) {
+
+	if s == nil {
+		return
+	}
+
+	s.duration.Add(int64(d))
+
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+
+	if rsp == nil {
+		s.skipped.Add(1)
+		return
+	}
+
+	s.bytes.Add(int64(size))
+
+	affected, err := rsp.RowsAffected()
+
+	if err == nil && affected > 1 {
+		s.replaced.Add(1)
+	} else {
+		s.inserted.Add(1)
+	}
+}
+
+// Summary returns a `StatsSummary` instance derived from the current values of 's'.
+func (s *Stats) Summary() *StatsSummary {
+
+	if s == nil {
+		return &StatsSummary{}
+	}
+
+	summary := &StatsSummary{
+		Inserted: s.inserted.Load(),
+		Replaced: s.replaced.Load(),
+		Skipped:  s.skipped.Load(),
+		Failed:   s.failed.Load(),
+		Bytes:    s.bytes.Load(),
+		Duration: time.Duration(s.duration.Load()),
+	}
+
+	return summary
+}
@@ -0,0 +1,362 @@
+package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/planar"
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-feature/geometry"
+	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the table containing subdivided copies of the geometries in the "whosonfirst" table.
+const SUBDIVIDED_TABLE_NAME string = "whosonfirst_subdivided"
+
+// The default maximum number of vertices in each tile of a subdivided geometry.
+const DEFAULT_SUBDIVIDE_MAX_VERTICES int = 256
+
+// The maximum number of times a polygon will be split in half when it is subdivided. This guards against polygons
+// whose vertices are so densely clustered that they can not be split into tiles of the requested size.
+const SUBDIVIDE_MAX_DEPTH int = 24
+
+// The spatial reference system identifier for the geometries in the "whosonfirst_subdivided" table. MySQL only uses
+// the spatial index on a column that is restricted to a single SRID.
+const SUBDIVIDED_SRID int = 4326
+
+// SUBDIVIDED_GEOMFROMTEXT is the expression for converting a WKT placeholder, whose coordinates are in longitude,
+// latitude order, in to a geometry that can be compared with those in the "whosonfirst_subdivided" table.
+const SUBDIVIDED_GEOMFROMTEXT string = "ST_GeomFromText(?, 4326, 'axis-order=long-lat')"
+
+const subdivided_schema string = `CREATE TABLE IF NOT EXISTS %s (
+      id BIGINT UNSIGNED NOT NULL,
+      part INT UNSIGNED NOT NULL,
+      tile INT UNSIGNED NOT NULL,
+      geometry GEOMETRY NOT NULL SRID 4326,
+      PRIMARY KEY (id, part, tile),
+      SPATIAL KEY idx_geometry (geometry)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
+
+// SubdividedTable stores the geometries of Who's On First records split into polygon parts, and then into tiles with
+// a bounded number of vertices, each of which is indexed by its own (small) minimum bounding rectangle. This allows
+// point-in-polygon queries against very large geometries, like countries and oceans, to use the spatial index
+// effectively and to test a handful of vertices rather than the entire geometry.
+type SubdividedTable struct {
+	*tableIndexer
+	options *SubdividedTableOptions
+}
+
+// SubdividedTableOptions defines options for indexing records in the "whosonfirst_subdivided" table.
+type SubdividedTableOptions struct {
+	IndexOptions
+	// MaxVertices is the maximum number of vertices in each tile.
+	MaxVertices int
+}
+
+// DefaultSubdividedTableOptions returns a new `SubdividedTableOptions` instance with default values.
+func DefaultSubdividedTableOptions() (*SubdividedTableOptions, error) {
+
+	opts := &SubdividedTableOptions{
+		IndexOptions: defaultIndexOptions(),
+		MaxVertices:  DEFAULT_SUBDIVIDE_MAX_VERTICES,
+	}
+
+	return opts, nil
+}
+
+func NewSubdividedTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
+
+	opts, err := DefaultSubdividedTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default subdivided table options, %w", err)
+	}
+
+	return NewSubdividedTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewSubdividedTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *SubdividedTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewSubdividedTableWithOptions(ctx, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new subdivided table, %w", err)
+	}
+
+	err = t.InitializeTable(ctx, db)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize subdivided table, %w", err)
+	}
+
+	return t, nil
+}
+
+func NewSubdividedTable(ctx context.Context) (wof_sql.Table, error) {
+
+	opts, err := DefaultSubdividedTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default subdivided table options, %w", err)
+	}
+
+	return NewSubdividedTableWithOptions(ctx, opts)
+}
+
+func NewSubdividedTableWithOptions(ctx context.Context, opts *SubdividedTableOptions) (wof_sql.Table, error) {
+
+	if opts.MaxVertices < 4 {
+		return nil, fmt.Errorf("Invalid maximum number of vertices, must be at least 4")
+	}
+
+	t := &SubdividedTable{
+		options: opts,
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
+}
+
+func (t *SubdividedTable) Name() string {
+	return SUBDIVIDED_TABLE_NAME
+}
+
+func (t *SubdividedTable) Schema() string {
+	return fmt.Sprintf(subdivided_schema, SUBDIVIDED_TABLE_NAME)
+}
+
+func (t *SubdividedTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
+	return wof_sql.CreateTableIfNecessary(ctx, db, t)
+}
+
+func (t *SubdividedTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	stmt, err := t.PrepareStatement(ctx, body, custom...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt == nil {
+		return nil, nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+
+	// The first argument to the insert statement is always the record's ID. Remove any existing
+	// tiles first since the new geometry may have fewer parts or tiles than the old one.
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE id = ?", SUBDIVIDED_TABLE_NAME)
+
+	span.AddEvent("delete")
+
+	del_rsp, err := ex.ExecContext(ctx, q, stmt.Args[0])
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to remove existing tiles, %w", err)
+	}
+
+	span.AddEvent("insert")
+
+	_, err = ex.ExecContext(ctx, stmt.Query, stmt.Args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to update table, %w", err)
+	}
+
+	deleted, _ := del_rsp.RowsAffected()
+
+	rsp := &multiRowResult{
+		replaced: deleted > 0,
+	}
+
+	return rsp, nil
+}
+
+// PrepareStatement returns the `Statement` used to insert the tiles derived from 'body' in the table, or nil if 'body'
+// should not be indexed in the table. Existing tiles for the record are deleted before the statement is executed.
+func (t *SubdividedTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
+
+	id, err := properties.Id(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
+	}
+
+	var alt *uri.AltGeom
+
+	if len(custom) >= 1 {
+		alt = custom[0].(*uri.AltGeom)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
+	if alt != nil {
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return nil, nil
+	}
+
+	geojson_geom, err := geometry.Geometry(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive geometry, %w", err)
+	}
+
+	parts := Subdivide(geojson_geom.Geometry(), t.options.MaxVertices)
+
+	values := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	for part_idx, tiles := range parts {
+
+		for tile_idx, tile := range tiles {
+			values = append(values, fmt.Sprintf("(?, ?, ?, %s)", SUBDIVIDED_GEOMFROMTEXT))
+			args = append(args, id, part_idx, tile_idx, wkt.MarshalString(tile))
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("Geometry has no parts")
+	}
+
+	span.SetAttributes(attribute.Int("subdivide.tiles", len(values)))
+
+	q := fmt.Sprintf(`INSERT INTO %s (
+		id, part, tile, geometry
+	) VALUES %s`, SUBDIVIDED_TABLE_NAME, strings.Join(values, ", "))
+
+	stmt := &Statement{
+		Query: q,
+		Args:  args,
+	}
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// Subdivide splits 'geom' into its polygon parts and then splits each part, recursively in half along the longest
+// side of its bounding box, until each tile has no more than 'max_vertices' vertices (like PostGIS' `ST_Subdivide`
+// function). The result is a list of tiles for each part. Geometries that are not polygons or multipolygons are
+// returned as a single part with a single tile.
+func Subdivide(geom orb.Geometry, max_vertices int) [][]orb.Geometry {
+
+	var polygons []orb.Polygon
+
+	switch g := geom.(type) {
+	case orb.Polygon:
+		polygons = []orb.Polygon{g}
+	case orb.MultiPolygon:
+		polygons = g
+	default:
+		return [][]orb.Geometry{
+			{geom},
+		}
+	}
+
+	parts := make([][]orb.Geometry, 0)
+
+	for _, p := range polygons {
+
+		tiles := make([]orb.Geometry, 0)
+
+		for _, tile := range subdividePolygon(p, max_vertices, 0) {
+			tiles = append(tiles, tile)
+		}
+
+		if len(tiles) > 0 {
+			parts = append(parts, tiles)
+		}
+	}
+
+	return parts
+}
+
+// subdividePolygon splits 'p' in half until each tile has no more than 'max_vertices' vertices or 'depth' reaches
+// `SUBDIVIDE_MAX_DEPTH`.
+func subdividePolygon(p orb.Polygon, max_vertices int, depth int) []orb.Polygon {
+
+	count := 0
+
+	for _, r := range p {
+		count += len(r)
+	}
+
+	if count <= max_vertices || depth >= SUBDIVIDE_MAX_DEPTH {
+		return []orb.Polygon{p}
+	}
+
+	b := p.Bound()
+
+	halves := make([]orb.Bound, 2)
+
+	if b.Max.X()-b.Min.X() >= b.Max.Y()-b.Min.Y() {
+
+		mid := (b.Min.X() + b.Max.X()) / 2
+
+		halves[0] = orb.Bound{Min: b.Min, Max: orb.Point{mid, b.Max.Y()}}
+		halves[1] = orb.Bound{Min: orb.Point{mid, b.Min.Y()}, Max: b.Max}
+
+	} else {
+
+		mid := (b.Min.Y() + b.Max.Y()) / 2
+
+		halves[0] = orb.Bound{Min: b.Min, Max: orb.Point{b.Max.X(), mid}}
+		halves[1] = orb.Bound{Min: orb.Point{b.Min.X(), mid}, Max: b.Max}
+	}
+
+	tiles := make([]orb.Polygon, 0)
+
+	for _, h := range halves {
+
+		// clip.Polygon uses its input as scratch space so clip a copy of 'p'
+
+		clipped := clip.Polygon(h, orb.Clone(p).(orb.Polygon))
+		clipped = withoutEmptyRings(clipped)
+
+		if len(clipped) == 0 {
+			continue
+		}
+
+		tiles = append(tiles, subdividePolygon(clipped, max_vertices, depth+1)...)
+	}
+
+	return tiles
+}
+
+// withoutEmptyRings returns 'p' without any rings that have no area, for example rings that only touch the edge of
+// a clipping box. If the exterior ring has no area nil is returned.
+func withoutEmptyRings(p orb.Polygon) orb.Polygon {
+
+	if len(p) == 0 || len(p[0]) < 4 || planar.Area(p[0]) == 0 {
+		return nil
+	}
+
+	result := orb.Polygon{p[0]}
+
+	for _, r := range p[1:] {
+
+		if len(r) < 4 || planar.Area(r) == 0 {
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result
+}
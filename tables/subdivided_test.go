@@ -0,0 +1,160 @@
+package tables
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+// circle returns a polygon approximating a circle of radius 'r' centered on 'center' with 'n' vertices.
+func circle(center orb.Point, r float64, n int) orb.Polygon {
+
+	ring := make(orb.Ring, 0, n+1)
+
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		ring = append(ring, orb.Point{center.X() + r*math.Cos(a), center.Y() + r*math.Sin(a)})
+	}
+
+	ring = append(ring, ring[0])
+	return orb.Polygon{ring}
+}
+
+func square(min_x float64, min_y float64, size float64) orb.Polygon {
+	return orb.Polygon{orb.Ring{{min_x, min_y}, {min_x + size, min_y}, {min_x + size, min_y + size}, {min_x, min_y + size}, {min_x, min_y}}}
+}
+
+func TestSubdivide(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		geom         orb.Geometry
+		max_vertices int
+		parts        int
+		min_tiles    int
+	}{
+		{"point", orb.Point{-122.4, 37.7}, 4, 1, 1},
+		{"square", square(0, 0, 1), 256, 1, 1},
+		{"multipolygon", orb.MultiPolygon{square(0, 0, 1), square(5, 5, 1)}, 256, 2, 2},
+		{"circle", circle(orb.Point{-73.9, 40.7}, 1, 1000), 64, 1, 16},
+		{"circle with hole", orb.Polygon{circle(orb.Point{0, 0}, 10, 500)[0], circle(orb.Point{0, 0}, 2, 100)[0]}, 64, 1, 8},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			parts := Subdivide(test.geom, test.max_vertices)
+
+			if len(parts) != test.parts {
+				t.Fatalf("Expected %d parts, got %d", test.parts, len(parts))
+			}
+
+			count_tiles := 0
+			area := 0.0
+
+			for _, tiles := range parts {
+
+				for _, tile := range tiles {
+
+					count_tiles += 1
+
+					p, ok := tile.(orb.Polygon)
+
+					if !ok {
+						continue
+					}
+
+					count_vertices := 0
+
+					for _, r := range p {
+						count_vertices += len(r)
+					}
+
+					if count_vertices > test.max_vertices {
+						t.Fatalf("Tile has %d vertices, expected no more than %d", count_vertices, test.max_vertices)
+					}
+
+					area += planar.Area(p)
+				}
+			}
+
+			if count_tiles < test.min_tiles {
+				t.Fatalf("Expected at least %d tiles, got %d", test.min_tiles, count_tiles)
+			}
+
+			// The tiles should cover the same area as the original geometry
+
+			expected := planar.Area(test.geom)
+
+			if math.Abs(area-expected) > expected*1e-9 {
+				t.Fatalf("Expected tiles to cover an area of %f, got %f", expected, area)
+			}
+		})
+	}
+}
+
+func TestSubdividedTablePrepareStatement(t *testing.T) {
+
+	ctx := context.Background()
+
+	opts, err := DefaultSubdividedTableOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create table options, %v", err)
+	}
+
+	tbl, err := NewSubdividedTableWithOptions(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create table, %v", err)
+	}
+
+	body := []byte(`{"type":"Feature","properties":{"wof:id":101736545},"geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,6],[5,5]]]]}}`)
+
+	alt := &uri.AltGeom{
+		Source: "quattroshapes",
+	}
+
+	tests := []struct {
+		name   string
+		custom []interface{}
+		tiles  int
+	}{
+		{"default", nil, 2},
+		// Alternate geometries are not subdivided
+		{"alternate", []interface{}{alt}, 0},
+	}
+
+	for _, test := range tests {
+
+		stmt, err := tbl.(StatementTable).PrepareStatement(ctx, body, test.custom...)
+
+		if err != nil {
+			t.Fatalf("Failed to prepare statement for %s, %v", test.name, err)
+		}
+
+		if test.tiles == 0 {
+
+			if stmt != nil {
+				t.Fatalf("Expected no statement for %s, got %s", test.name, stmt.Query)
+			}
+
+			continue
+		}
+
+		if len(stmt.Args) != test.tiles*4 {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, stmt.Args)
+		}
+
+		// Each tile is inserted as (id, part, tile, geometry)
+
+		if stmt.Args[0] != int64(101736545) || stmt.Args[1] != 0 || stmt.Args[5] != 1 || stmt.Args[6] != 0 {
+			t.Fatalf("Unexpected arguments for %s: %v", test.name, stmt.Args)
+		}
+	}
+}
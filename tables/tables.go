@@ -1 +1,98 @@
 package tables
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+)
+
+// The default transaction isolation level used to index records.
+const DEFAULT_ISOLATION_LEVEL sql.IsolationLevel = sql.LevelReadCommitted
+
+// Execer is the interface for executing queries shared by `sql.DB`, `sql.Conn` and `sql.Tx` instances.
+type Execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+// ExecerTable is a `wof_sql.Table` that can also index features outside of an explicit transaction.
+type ExecerTable interface {
+	wof_sql.Table
+	IndexFeatureWithExecer(context.Context, Execer, []byte, ...interface{}) error
+}
+
+// Statement is a query, and its arguments, used to index a record in a table.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// Size returns the approximate size, in bytes, of the statement when it is sent to the database server.
+func (s *Statement) Size() int {
+
+	size := len(s.Query)
+
+	for _, a := range s.Args {
+
+		switch v := a.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		default:
+			size += 8
+		}
+	}
+
+	return size
+}
+
+// multiRowResult is the `sql.Result` reported to `Stats` for a record indexed using multiple rows. The number of rows
+// affected is reported as it would be for a single REPLACE statement: 1 for new records and 2 for records that replaced
+// existing rows.
+type multiRowResult struct {
+	sql.Result
+	replaced bool
+}
+
+// RowsAffected returns 2 if the record replaced existing rows and 1 otherwise.
+func (r *multiRowResult) RowsAffected() (int64, error) {
+
+	if r.replaced {
+		return 2, nil
+	}
+
+	return 1, nil
+}
+
+// StatementTable is a `wof_sql.Table` that can return the statement used to index a record without executing it.
+type StatementTable interface {
+	wof_sql.Table
+	PrepareStatement(context.Context, []byte, ...interface{}) (*Statement, error)
+}
+
+// ParseIsolationLevel returns the `sql.IsolationLevel` matching 'str'. Valid options are "default",
+// "read-uncommitted", "read-committed", "repeatable-read" and "serializable".
+func ParseIsolationLevel(str string) (sql.IsolationLevel, error) {
+
+	str = strings.ToLower(str)
+	str = strings.ReplaceAll(str, "_", "-")
+	str = strings.ReplaceAll(str, " ", "-")
+
+	switch str {
+	case "default":
+		return sql.LevelDefault, nil
+	case "read-uncommitted":
+		return sql.LevelReadUncommitted, nil
+	case "read-committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable-read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	default:
+		return sql.LevelDefault, fmt.Errorf("Invalid or unsupported isolation level '%s'", str)
+	}
+}
@@ -0,0 +1,65 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseIsolationLevel(t *testing.T) {
+
+	tests := []struct {
+		str      string
+		expected sql.IsolationLevel
+		ok       bool
+	}{
+		{"default", sql.LevelDefault, true},
+		{"read-uncommitted", sql.LevelReadUncommitted, true},
+		{"READ_COMMITTED", sql.LevelReadCommitted, true},
+		{"repeatable read", sql.LevelRepeatableRead, true},
+		{"serializable", sql.LevelSerializable, true},
+		{"snapshot", sql.LevelDefault, false},
+	}
+
+	for _, test := range tests {
+
+		v, err := ParseIsolationLevel(test.str)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.str)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.str, err)
+		}
+
+		if v != test.expected {
+			t.Fatalf("Unexpected isolation level for '%s', %v", test.str, v)
+		}
+	}
+}
+
+func TestStatementSize(t *testing.T) {
+
+	tests := []struct {
+		stmt     *Statement
+		expected int
+	}{
+		{&Statement{Query: "SELECT 1"}, 8},
+		{&Statement{Query: "?", Args: []interface{}{"abc", []byte("de")}}, 6},
+		{&Statement{Query: "?", Args: []interface{}{int64(1), nil}}, 17},
+	}
+
+	for _, test := range tests {
+
+		size := test.stmt.Size()
+
+		if size != test.expected {
+			t.Fatalf("Expected size of %d for '%s', got %d", test.expected, test.stmt.Query, size)
+		}
+	}
+}
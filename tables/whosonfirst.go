@@ -4,24 +4,74 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 
+	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/simplify"
 	"github.com/tidwall/gjson"
 	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
 	"github.com/whosonfirst/go-whosonfirst-feature/geometry"
 	"github.com/whosonfirst/go-whosonfirst-feature/properties"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
 	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
 	"github.com/whosonfirst/go-whosonfirst-uri"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// The initial tolerance, in decimal degrees, used to simplify geometries when using the `OVERSIZED_SIMPLIFY` strategy.
+const SIMPLIFY_INITIAL_TOLERANCE float64 = 0.0001
+
+// The maximum number of times the simplification tolerance will be doubled when using the `OVERSIZED_SIMPLIFY` strategy.
+const SIMPLIFY_MAX_ITERATIONS int = 12
+
 type WhosonfirstTable struct {
-	wof_sql.Table
+	*tableIndexer
+	options *WhosonfirstTableOptions
+}
+
+// WhosonfirstTableOptions defines options for indexing records in the "whosonfirst" table.
+type WhosonfirstTableOptions struct {
+	IndexOptions
+	// BelongsToIndex indicates whether a multi-valued index on the "wof:belongsto" property should be added to the table,
+	// if the server supports multi-valued indexes.
+	BelongsToIndex bool
+	// PromotedColumns are additional generated columns, derived from Who's On First properties, added to the table.
+	PromotedColumns []*PromotedColumn
+	// DeriveDates indicates whether the "inception_lower" and "cessation_upper" columns should be derived from the
+	// "edtf:inception" and "edtf:cessation" properties for records without "date:inception_lower" or "date:cessation_upper"
+	// properties. The properties themselves are not modified.
+	DeriveDates bool
+}
+
+// DefaultWhosonfirstTableOptions returns a new `WhosonfirstTableOptions` instance with default values.
+func DefaultWhosonfirstTableOptions() (*WhosonfirstTableOptions, error) {
+
+	opts := &WhosonfirstTableOptions{
+		IndexOptions:   defaultIndexOptions(),
+		BelongsToIndex: true,
+		DeriveDates:    true,
+	}
+
+	return opts, nil
 }
 
 func NewWhosonfirstTableWithDatabase(ctx context.Context, db wof_sql.Database) (wof_sql.Table, error) {
 
-	t, err := NewWhosonfirstTable(ctx)
+	opts, err := DefaultWhosonfirstTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default whosonfirst table options, %w", err)
+	}
+
+	return NewWhosonfirstTableWithDatabaseAndOptions(ctx, db, opts)
+}
+
+func NewWhosonfirstTableWithDatabaseAndOptions(ctx context.Context, db wof_sql.Database, opts *WhosonfirstTableOptions) (wof_sql.Table, error) {
+
+	t, err := NewWhosonfirstTableWithOptions(ctx, opts)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create new whosonfirst table, %w", err)
@@ -37,8 +87,51 @@ func NewWhosonfirstTableWithDatabase(ctx context.Context, db wof_sql.Database) (
 }
 
 func NewWhosonfirstTable(ctx context.Context) (wof_sql.Table, error) {
-	t := WhosonfirstTable{}
-	return &t, nil
+
+	opts, err := DefaultWhosonfirstTableOptions()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create default whosonfirst table options, %w", err)
+	}
+
+	return NewWhosonfirstTableWithOptions(ctx, opts)
+}
+
+func NewWhosonfirstTableWithOptions(ctx context.Context, opts *WhosonfirstTableOptions) (wof_sql.Table, error) {
+
+	names := make(map[string]bool)
+
+	for _, c := range opts.PromotedColumns {
+
+		err := c.Validate()
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid promoted column, %w", err)
+		}
+
+		if names[c.Name] {
+			return nil, fmt.Errorf("Duplicate promoted column '%s'", c.Name)
+		}
+
+		names[c.Name] = true
+	}
+
+	t := &WhosonfirstTable{
+		options: opts,
+	}
+
+	// Ensure that the promoted columns can be added to the table's schema, so that the `Schema` method
+	// does not need to return an error.
+
+	_, err := t.schema()
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.tableIndexer = newTableIndexer(t.Name(), &opts.IndexOptions, t.indexFeature)
+
+	return t, nil
 }
 
 func (t *WhosonfirstTable) Name() string {
@@ -49,16 +142,67 @@ func (t *WhosonfirstTable) Name() string {
 // https://www.percona.com/blog/2016/03/07/json-document-fast-lookup-with-mysql-5-7/
 // https://archive.fosdem.org/2016/schedule/event/mysql57_json/attachments/slides/1291/export/events/attachments/mysql57_json/slides/1291/MySQL_57_JSON.pdf
 
+// Schema returns the schema for the "whosonfirst" table defined by whosonfirst/go-whosonfirst-sql with the definitions
+// for the date columns and any promoted columns added.
 func (t *WhosonfirstTable) Schema() string {
-	s, _ := wof_tables.LoadSchema("mysql", wof_tables.WHOSONFIRST_TABLE_NAME)
+	s, _ := t.schema()
 	return s
 }
 
-func (t *WhosonfirstTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
-	return wof_sql.CreateTableIfNecessary(ctx, db, t)
+// schema returns the schema for the "whosonfirst" table with the definitions for the date columns and any promoted
+// columns added, or an error if they can not be added.
+func (t *WhosonfirstTable) schema() (string, error) {
+
+	s, err := wof_tables.LoadSchema("mysql", wof_tables.WHOSONFIRST_TABLE_NAME)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to load %s schema, %w", wof_tables.WHOSONFIRST_TABLE_NAME, err)
+	}
+
+	s, err = addDefinitions(s, dateColumnDefinitions())
+
+	if err != nil {
+		return "", err
+	}
+
+	return promoteColumns(s, t.options.PromotedColumns)
 }
 
-func (t *WhosonfirstTable) IndexRecord(ctx context.Context, db wof_sql.Database, i interface{}, custom ...interface{}) error {
+// InitializeTable creates the table if necessary, adds an indexed column for the "wof:name" property, adds and populates
+// the date columns and any promoted columns that are missing from an existing table and, if enabled and supported by the server, adds a multi-valued index
+// on the "wof:belongsto" property.
+func (t *WhosonfirstTable) InitializeTable(ctx context.Context, db wof_sql.Database) error {
+
+	err := wof_sql.CreateTableIfNecessary(ctx, db, t)
+
+	if err != nil {
+		return err
+	}
+
+	err = EnsureNameColumn(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	err = EnsureDateColumns(ctx, db)
+
+	if err != nil {
+		return err
+	}
+
+	if len(t.options.PromotedColumns) > 0 {
+
+		err := EnsurePromotedColumns(ctx, db, t.options.PromotedColumns)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !t.options.BelongsToIndex {
+		return nil
+	}
 
 	conn, err := db.Conn()
 
@@ -66,34 +210,50 @@ func (t *WhosonfirstTable) IndexRecord(ctx context.Context, db wof_sql.Database,
 		return fmt.Errorf("Failed to establish database connection, %w", err)
 	}
 
-	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	supported, err := SupportsMultiValuedIndexes(ctx, conn)
 
 	if err != nil {
-		return fmt.Errorf("Failed to create transaction, %w", err)
+		return err
 	}
 
-	err = t.IndexFeature(ctx, tx, i.([]byte), custom...)
+	if !supported {
+		return nil
+	}
+
+	return EnsureBelongsToIndex(ctx, db)
+}
+
+func (t *WhosonfirstTable) indexFeature(ctx context.Context, ex Execer, body []byte, custom ...interface{}) (sql.Result, error) {
+
+	stmt, err := t.PrepareStatement(ctx, body, custom...)
 
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("Failed to index %s table, %w", t.Name(), err)
+		return nil, err
+	}
+
+	if stmt == nil {
+		return nil, nil
 	}
 
-	err = tx.Commit()
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("replace")
+
+	rsp, err := ex.ExecContext(ctx, stmt.Query, stmt.Args...)
 
 	if err != nil {
-		return fmt.Errorf("Failed to commit transaction, %w", err)
+		return nil, fmt.Errorf("Failed to update table, %w", err)
 	}
 
-	return nil
+	return rsp, nil
 }
 
-func (t *WhosonfirstTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []byte, custom ...interface{}) error {
+// PrepareStatement returns the `Statement` used to index 'body' in the table, or nil if 'body' should not be indexed in the table.
+func (t *WhosonfirstTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*Statement, error) {
 
 	id, err := properties.Id(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to derive ID, %w", err)
+		return nil, fmt.Errorf("Failed to derive ID, %w", err)
 	}
 
 	var alt *uri.AltGeom
@@ -102,14 +262,18 @@ func (t *WhosonfirstTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []
 		alt = custom[0].(*uri.AltGeom)
 	}
 
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.ATTRIBUTE_ID.Int64(id))
+
 	if alt != nil {
-		return nil
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return nil, nil
 	}
 
 	geojson_geom, err := geometry.Geometry(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to derive geometry, %w", err)
+		return nil, fmt.Errorf("Failed to derive geometry, %w", err)
 	}
 
 	orb_geom := geojson_geom.Geometry()
@@ -118,7 +282,7 @@ func (t *WhosonfirstTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []
 	centroid, _, err := properties.Centroid(body)
 
 	if err != nil {
-		return fmt.Errorf("Failed to derive centroid, %w", err)
+		return nil, fmt.Errorf("Failed to derive centroid, %w", err)
 	}
 
 	// See the *centroid stuff? That's important because
@@ -127,26 +291,69 @@ func (t *WhosonfirstTable) IndexFeature(ctx context.Context, tx *sql.Tx, body []
 
 	wkt_centroid := wkt.MarshalString(*centroid)
 
-	props := gjson.GetBytes(body, "properties")
-	props_json, err := json.Marshal(props.Value())
+	span.AddEvent("wkt encoded")
+
+	props := gjson.GetBytes(body, "properties").Value()
+
+	props_map, _ := props.(map[string]interface{})
+	inception, cessation := dateBounds(props_map, t.options.DeriveDates)
+
+	props_json, err := json.Marshal(props)
 
 	if err != nil {
-		return fmt.Errorf("Failed to encode properties, %w", err)
+		return nil, fmt.Errorf("Failed to encode properties, %w", err)
 	}
 
+	span.AddEvent("properties encoded")
+
 	lastmod := properties.LastModified(body)
 
-	q := fmt.Sprintf(`REPLACE INTO %s (
-		geometry, centroid, id, properties, lastmodified
-	) VALUES (
-		ST_GeomFromText('%s'), ST_GeomFromText('%s'), ?, ?, ?
-	)`, wof_tables.WHOSONFIRST_TABLE_NAME, wkt_geom, wkt_centroid)
+	stmt := t.newStatement(wkt_geom, wkt_centroid, id, string(props_json), inception, cessation, lastmod)
+
+	err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+	if errors.Is(err, ErrPacketTooLarge) && HasOversizedStrategy(t.options.OversizedStrategy, OVERSIZED_SIMPLIFY) {
+
+		// Simplify (a copy of) the geometry with progressively larger tolerances until the statement
+		// fits. The full, unsimplified, geometry is still available in the "geojson" table.
+
+		tolerance := SIMPLIFY_INITIAL_TOLERANCE
 
-	_, err = tx.ExecContext(ctx, q, id, string(props_json), lastmod)
+		for i := 0; i < SIMPLIFY_MAX_ITERATIONS; i++ {
+
+			simplified := simplify.DouglasPeucker(tolerance).Simplify(orb.Clone(orb_geom))
+			stmt = t.newStatement(wkt.MarshalString(simplified), wkt_centroid, id, string(props_json), inception, cessation, lastmod)
+
+			err = checkStatementSize(stmt, t.options.MaxPacketSize)
+
+			if err == nil {
+				span.SetAttributes(attribute.Float64("simplify.tolerance", tolerance))
+				break
+			}
+
+			tolerance = tolerance * 2
+		}
+	}
 
 	if err != nil {
-		return fmt.Errorf("Failed to update table, %w", err)
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+func (t *WhosonfirstTable) newStatement(wkt_geom string, wkt_centroid string, id int64, props string, inception sql.NullString, cessation sql.NullString, lastmod int64) *Statement {
+
+	q := fmt.Sprintf(`REPLACE INTO %s (
+		geometry, centroid, id, properties, %s, %s, lastmodified
+	) VALUES (
+		ST_GeomFromText('%s'), ST_GeomFromText('%s'), ?, ?, ?, ?, ?
+	)`, wof_tables.WHOSONFIRST_TABLE_NAME, INCEPTION_LOWER_COLUMN, CESSATION_UPPER_COLUMN, wkt_geom, wkt_centroid)
+
+	stmt := &Statement{
+		Query: q,
+		Args:  []interface{}{id, props, inception, cessation, lastmod},
 	}
 
-	return nil
+	return stmt
 }
@@ -0,0 +1,75 @@
+package tables
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWhosonfirstTablePrepareStatementOversized(t *testing.T) {
+
+	ctx := context.Background()
+
+	// A densely sampled circle that can be simplified considerably
+
+	coords := make([]string, 0)
+
+	for i := 0; i <= 2000; i++ {
+		a := 2 * math.Pi * float64(i%2000) / 2000
+		coords = append(coords, fmt.Sprintf("[%f,%f]", math.Cos(a), math.Sin(a)))
+	}
+
+	body := []byte(fmt.Sprintf(`{"type":"Feature","properties":{"wof:id":101736545,"geom:latitude":0,"geom:longitude":0},"geometry":{"type":"Polygon","coordinates":[[%s]]}}`, strings.Join(coords, ",")))
+
+	tests := []struct {
+		strategy   string
+		max_packet int
+		ok         bool
+	}{
+		{OVERSIZED_FAIL, 0, true},
+		{OVERSIZED_FAIL, 4096, false},
+		{OVERSIZED_COMPRESS, 4096, false},
+		{"compress,simplify", 4096, true},
+		{OVERSIZED_SIMPLIFY, 16, false},
+	}
+
+	for _, test := range tests {
+
+		opts, err := DefaultWhosonfirstTableOptions()
+
+		if err != nil {
+			t.Fatalf("Failed to create table options, %v", err)
+		}
+
+		opts.MaxPacketSize = test.max_packet
+		opts.OversizedStrategy = test.strategy
+
+		tbl, err := NewWhosonfirstTableWithOptions(ctx, opts)
+
+		if err != nil {
+			t.Fatalf("Failed to create table, %v", err)
+		}
+
+		stmt, err := tbl.(StatementTable).PrepareStatement(ctx, body)
+
+		if !test.ok {
+
+			if !errors.Is(err, ErrPacketTooLarge) {
+				t.Fatalf("Expected '%s' with max packet %d to fail, %v", test.strategy, test.max_packet, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to prepare statement for '%s' with max packet %d, %v", test.strategy, test.max_packet, err)
+		}
+
+		if test.max_packet > 0 && stmt.Size() > test.max_packet {
+			t.Fatalf("Expected statement for '%s' to fit in %d bytes, got %d", test.strategy, test.max_packet, stmt.Size())
+		}
+	}
+}
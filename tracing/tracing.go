@@ -0,0 +1,153 @@
+// Package tracing provides methods for configuring and emitting OpenTelemetry spans for indexing operations.
+// Spans are emitted using the global OpenTelemetry tracer provider which is a no-op unless it has been
+// configured, for example by the `SetupTracerProvider` method.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the OpenTelemetry tracer used to emit spans.
+const TRACER_NAME string = "github.com/whosonfirst/go-whosonfirst-mysql"
+
+// The default service name assigned to spans.
+const DEFAULT_SERVICE_NAME string = "go-whosonfirst-mysql"
+
+// Attribute key for the Who's On First ID of the record being indexed.
+const ATTRIBUTE_ID attribute.Key = "wof.id"
+
+// Attribute key for the alternate geometry label of the record being indexed.
+const ATTRIBUTE_ALT attribute.Key = "wof.alt"
+
+// Attribute key for the relative path of the record being indexed.
+const ATTRIBUTE_PATH attribute.Key = "wof.path"
+
+// Attribute key for the name of the table being indexed.
+const ATTRIBUTE_TABLE attribute.Key = "db.sql.table"
+
+// ShutdownFunc is a function used to flush and stop a tracer provider created by `SetupTracerProvider`.
+type ShutdownFunc func(context.Context) error
+
+// SetupTracerProvider creates a new OpenTelemetry tracer provider, defined by 'uri', and assigns it as the
+// global tracer provider. Valid URIs are:
+// * `stdout://` Write spans, as pretty-printed JSON, to STDOUT.
+// * `stderr://` Write spans, as pretty-printed JSON, to STDERR.
+// * `otlp://{HOST}:{PORT}` Export spans to an OTLP (HTTP) collector. If {HOST}:{PORT} is empty the
+// default OpenTelemetry environment variables (or "localhost:4318") are used. Include the `?insecure=true`
+// parameter to export spans without TLS.
+// All URIs accept an optional `?service-name=` parameter (default "go-whosonfirst-mysql").
+// The returned `ShutdownFunc` should be invoked before the application exits to ensure that all spans are exported.
+func SetupTracerProvider(ctx context.Context, uri string) (ShutdownFunc, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	var exporter sdktrace.SpanExporter
+
+	switch u.Scheme {
+	case "stdout", "stderr":
+
+		wr := os.Stdout
+
+		if u.Scheme == "stderr" {
+			wr = os.Stderr
+		}
+
+		ex, err := stdouttrace.New(stdouttrace.WithWriter(wr), stdouttrace.WithPrettyPrint())
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create stdout exporter, %w", err)
+		}
+
+		exporter = ex
+
+	case "otlp":
+
+		opts := make([]otlptracehttp.Option, 0)
+
+		if u.Host != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		}
+
+		if q.Get("insecure") != "" {
+
+			insecure, err := strconv.ParseBool(q.Get("insecure"))
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse ?insecure= parameter, %w", err)
+			}
+
+			if insecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+		}
+
+		ex, err := otlptracehttp.New(ctx, opts...)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create OTLP exporter, %w", err)
+		}
+
+		exporter = ex
+
+	default:
+		return nil, fmt.Errorf("Invalid or unsupported tracing URI scheme '%s'", u.Scheme)
+	}
+
+	service_name := DEFAULT_SERVICE_NAME
+
+	if q.Get("service-name") != "" {
+		service_name = q.Get("service-name")
+	}
+
+	r, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service_name)))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create resource, %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(r),
+	)
+
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// Start creates a new span named 'name' with attributes 'attrs' using the global tracer provider.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := otel.Tracer(TRACER_NAME)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records 'err' (if not nil) on 'span' and then ends it.
+func End(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
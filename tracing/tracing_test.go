@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetupTracerProvider(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		uri string
+		ok  bool
+	}{
+		{"stdout://", true},
+		{"stderr://?service-name=test", true},
+		{"otlp://localhost:4318?insecure=true", true},
+		{"otlp://localhost:4318?insecure=maybe", false},
+		{"zipkin://localhost:9411", false},
+	}
+
+	for _, test := range tests {
+
+		shutdown, err := SetupTracerProvider(ctx, test.uri)
+
+		if !test.ok {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.uri)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to set up tracer provider for '%s', %v", test.uri, err)
+		}
+
+		err = shutdown(ctx)
+
+		if err != nil {
+			t.Fatalf("Failed to shut down tracer provider for '%s', %v", test.uri, err)
+		}
+	}
+}
+
+func TestStartEnd(t *testing.T) {
+
+	ctx := context.Background()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(tp)
+
+	tests := []struct {
+		name   string
+		err    error
+		status codes.Code
+	}{
+		{"ok", nil, codes.Unset},
+		{"failed", fmt.Errorf("Failed"), codes.Error},
+	}
+
+	for _, test := range tests {
+
+		_, span := Start(ctx, test.name, ATTRIBUTE_TABLE.String("geojson"))
+		End(span, test.err)
+	}
+
+	spans := recorder.Ended()
+
+	if len(spans) != len(tests) {
+		t.Fatalf("Expected %d spans, got %d", len(tests), len(spans))
+	}
+
+	for i, test := range tests {
+
+		s := spans[i]
+
+		if s.Name() != test.name {
+			t.Fatalf("Expected span '%s', got '%s'", test.name, s.Name())
+		}
+
+		if s.Status().Code != test.status {
+			t.Fatalf("Unexpected status for span '%s', %v", test.name, s.Status())
+		}
+
+		if len(s.Attributes()) != 1 || s.Attributes()[0].Key != ATTRIBUTE_TABLE {
+			t.Fatalf("Unexpected attributes for span '%s', %v", test.name, s.Attributes())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/retry"
+)
+
+// DEAD_LETTER_SUFFIX is the suffix appended to the path of a failed record to derive the path of its dead-letter sidecar file.
+const DEAD_LETTER_SUFFIX string = ".error.json"
+
+// DeadLetter is the sidecar document written alongside the body of a record that failed to be indexed.
+type DeadLetter struct {
+	// The (relative) path of the record that failed to be indexed.
+	Path string `json:"path"`
+	// The error that caused the record to fail.
+	Error string `json:"error"`
+	// The MySQL error number associated with the error, if present.
+	MySQLErrorNumber uint16 `json:"mysql_error_number,omitempty"`
+	// The Unix timestamp when the record failed.
+	Created int64 `json:"created"`
+}
+
+// DeadLetterPath returns the path of the dead-letter sidecar file for a record whose path is 'path'.
+func DeadLetterPath(path string) string {
+	return path + DEAD_LETTER_SUFFIX
+}
+
+// writeDeadLetter writes 'body' and a `DeadLetter` sidecar describing 'index_err' to the writer's dead-letter writer.
+func (wr *MySQLWriter) writeDeadLetter(ctx context.Context, path string, body []byte, index_err error) error {
+
+	dl := DeadLetter{
+		Path:    path,
+		Error:   index_err.Error(),
+		Created: time.Now().Unix(),
+	}
+
+	n, ok := retry.ErrorNumber(index_err)
+
+	if ok {
+		dl.MySQLErrorNumber = n
+	}
+
+	enc_dl, err := json.Marshal(dl)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal dead letter for %s, %w", path, err)
+	}
+
+	_, err = wr.dead_letter.Write(ctx, path, bytes.NewReader(body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write dead letter body for %s, %w", path, err)
+	}
+
+	dl_path := DeadLetterPath(path)
+
+	_, err = wr.dead_letter.Write(ctx, dl_path, bytes.NewReader(enc_dl))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write dead letter for %s, %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package writer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	wof_writer "github.com/whosonfirst/go-writer/v3"
+)
+
+func TestWriteDeadLetter(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		path   string
+		err    error
+		number uint16
+	}{
+		{"mysql error", "101/736/545/101736545.geojson", fmt.Errorf("Failed to index, %w", &mysql.MySQLError{Number: 1406}), 1406},
+		{"other error", "85/922/583/85922583.geojson", fmt.Errorf("Failed to index"), 0},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			root := t.TempDir()
+
+			dl, err := wof_writer.NewWriter(ctx, fmt.Sprintf("fs://%s", root))
+
+			if err != nil {
+				t.Fatalf("Failed to create dead letter writer, %v", err)
+			}
+
+			wr := &MySQLWriter{
+				dead_letter: dl,
+			}
+
+			body := []byte(`{"type":"Feature"}`)
+
+			err = wr.writeDeadLetter(ctx, test.path, body, test.err)
+
+			if err != nil {
+				t.Fatalf("Failed to write dead letter, %v", err)
+			}
+
+			dl_body, err := os.ReadFile(filepath.Join(root, test.path))
+
+			if err != nil {
+				t.Fatalf("Failed to read dead letter body, %v", err)
+			}
+
+			if string(dl_body) != string(body) {
+				t.Fatalf("Unexpected dead letter body, %s", dl_body)
+			}
+
+			enc_dl, err := os.ReadFile(filepath.Join(root, DeadLetterPath(test.path)))
+
+			if err != nil {
+				t.Fatalf("Failed to read dead letter sidecar, %v", err)
+			}
+
+			var d DeadLetter
+
+			err = json.Unmarshal(enc_dl, &d)
+
+			if err != nil {
+				t.Fatalf("Failed to unmarshal dead letter sidecar, %v", err)
+			}
+
+			if d.Path != test.path || d.Error != test.err.Error() || d.MySQLErrorNumber != test.number {
+				t.Fatalf("Unexpected dead letter sidecar, %+v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+// ValidationError is returned by writers in "dry run" mode for records that would fail to be indexed.
+type ValidationError struct {
+	// The (relative) path of the record that failed validation.
+	Path string
+	// The name of the table that the record failed to validate for.
+	Table string
+	// The underlying error.
+	Err error
+}
+
+// Error returns a string representation of the validation error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Failed to validate %s for %s table, %v", e.Path, e.Table, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validateFeature does everything necessary to index 'body' in the writer's tables, including checking the size
+// of each statement against the server's `max_allowed_packet` setting, except actually executing the statements.
+func (wr *MySQLWriter) validateFeature(ctx context.Context, path string, body []byte, args ...interface{}) error {
+
+	errs := make([]error, 0)
+
+	for _, t := range wr.tables {
+
+		stmt, err := t.(tables.StatementTable).PrepareStatement(ctx, body, args...)
+
+		if err != nil {
+			errs = append(errs, &ValidationError{Path: path, Table: t.Name(), Err: err})
+			continue
+		}
+
+		if stmt == nil {
+			continue
+		}
+
+		size := stmt.Size()
+
+		if wr.max_packet > 0 && size > wr.max_packet {
+			err := fmt.Errorf("%w (%d > %d bytes)", tables.ErrPacketTooLarge, size, wr.max_packet)
+			errs = append(errs, &ValidationError{Path: path, Table: t.Name(), Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		wr.invalid.Add(1)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+// statementTable is a `tables.StatementTable` that returns a fixed statement, or error, for every record.
+type statementTable struct {
+	wof_sql.Table
+	name string
+	stmt *tables.Statement
+	err  error
+}
+
+func (t *statementTable) Name() string {
+	return t.name
+}
+
+func (t *statementTable) PrepareStatement(ctx context.Context, body []byte, custom ...interface{}) (*tables.Statement, error) {
+	return t.stmt, t.err
+}
+
+func TestValidateFeature(t *testing.T) {
+
+	ctx := context.Background()
+
+	small := &tables.Statement{Query: strings.Repeat("a", 10)}
+	large := &tables.Statement{Query: strings.Repeat("a", 100)}
+
+	tests := []struct {
+		name       string
+		table      *statementTable
+		max_packet int
+		too_large  bool
+		invalid    bool
+	}{
+		{"valid", &statementTable{name: "test", stmt: small}, 50, false, false},
+		{"skipped", &statementTable{name: "test"}, 50, false, false},
+		{"too large", &statementTable{name: "test", stmt: large}, 50, true, true},
+		{"unknown max packet", &statementTable{name: "test", stmt: large}, 0, false, false},
+		{"invalid", &statementTable{name: "test", err: fmt.Errorf("Missing ID")}, 50, false, true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			wr := &MySQLWriter{
+				tables:     []wof_sql.Table{test.table},
+				max_packet: test.max_packet,
+				invalid:    new(atomic.Int64),
+			}
+
+			err := wr.validateFeature(ctx, "101/736/545/101736545.geojson", []byte("{}"))
+
+			if (err != nil) != test.invalid {
+				t.Fatalf("Unexpected validation result, %v", err)
+			}
+
+			if errors.Is(err, tables.ErrPacketTooLarge) != test.too_large {
+				t.Fatalf("Unexpected packet size result, %v", err)
+			}
+
+			var v_err *ValidationError
+
+			if test.invalid && (!errors.As(err, &v_err) || v_err.Table != "test") {
+				t.Fatalf("Expected a validation error for the test table, %v", err)
+			}
+
+			if test.invalid != (wr.invalid.Load() == 1) {
+				t.Fatalf("Unexpected invalid count, %d", wr.invalid.Load())
+			}
+		})
+	}
+}
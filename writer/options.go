@@ -0,0 +1,276 @@
+package writer
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/retry"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	wof_tables "github.com/whosonfirst/go-whosonfirst-sql/tables"
+)
+
+// writerOptions are the settings for a `MySQLWriter` instance derived from the query parameters of its URI. They are
+// parsed, and validated, before the database is opened.
+type writerOptions struct {
+	ping_timeout      time.Duration
+	index_geojson     bool
+	index_whosonfirst bool
+	// If true previous versions of records in the "geojson" table are kept in the "geojson_history" table.
+	index_history bool
+	// The retention policy for the "geojson_history" table. If nil versions are kept indefinitely.
+	history_retention *tables.HistoryRetention
+	// If true change events for each record are recorded in the "wof_changes" table.
+	index_changes bool
+	// If true records are also indexed in the "whosonfirst_subdivided" table.
+	index_subdivided bool
+	// The maximum number of vertices in each tile of the "whosonfirst_subdivided" table.
+	subdivide_max_vertices int
+	// If not nil whether records are also indexed in the "whosonfirst_belongsto" table. If nil the table is only indexed
+	// if the server does not support multi-valued indexes.
+	index_belongsto *bool
+	workers         int
+	isolation       sql.IsolationLevel
+	use_transaction bool
+	retry_policy    *retry.Policy
+	// If true records are validated but not indexed.
+	dry_run bool
+	// An optional `whosonfirst/go-writer/v3` URI where records that fail to be indexed are written.
+	dead_letter string
+	// The strategy, or comma-separated list of strategies, used to handle records that exceed max_allowed_packet.
+	oversized string
+	// The codec used to compress bodies in the "geojson" table.
+	codec string
+	// Additional generated columns added to the "whosonfirst" table.
+	promoted_columns []*tables.PromotedColumn
+	// Derive the "whosonfirst" table's date columns from EDTF properties when "date:*" properties are missing.
+	derive_dates bool
+}
+
+// parseWriterOptions returns a new `writerOptions` instance derived from 'q'.
+func parseWriterOptions(q url.Values) (*writerOptions, error) {
+
+	opts := &writerOptions{
+		ping_timeout:           DEFAULT_PING_TIMEOUT,
+		index_geojson:          true,
+		index_whosonfirst:      true,
+		isolation:              tables.DEFAULT_ISOLATION_LEVEL,
+		use_transaction:        true,
+		oversized:              tables.OVERSIZED_FAIL,
+		subdivide_max_vertices: tables.DEFAULT_SUBDIVIDE_MAX_VERTICES,
+		derive_dates:           true,
+		dead_letter:            q.Get("dead-letter"),
+	}
+
+	if q.Get("ping-timeout") != "" {
+
+		d, err := time.ParseDuration(q.Get("ping-timeout"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?ping-timeout= parameter, %w", err)
+		}
+
+		opts.ping_timeout = d
+	}
+
+	flags := map[string]*bool{
+		"geojson":      &opts.index_geojson,
+		"whosonfirst":  &opts.index_whosonfirst,
+		"subdivided":   &opts.index_subdivided,
+		"history":      &opts.index_history,
+		"changes":      &opts.index_changes,
+		"transaction":  &opts.use_transaction,
+		"dry-run":      &opts.dry_run,
+		"derive-dates": &opts.derive_dates,
+	}
+
+	for k, v := range flags {
+
+		if q.Get(k) == "" {
+			continue
+		}
+
+		b, err := strconv.ParseBool(q.Get(k))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?%s= parameter, %w", k, err)
+		}
+
+		*v = b
+	}
+
+	if q.Get("belongsto") != "" {
+
+		b, err := strconv.ParseBool(q.Get("belongsto"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?belongsto= parameter, %w", err)
+		}
+
+		opts.index_belongsto = &b
+	}
+
+	if q.Get("workers") != "" {
+
+		v, err := strconv.Atoi(q.Get("workers"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?workers= parameter, %w", err)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid ?workers= parameter, must be a non-negative integer")
+		}
+
+		opts.workers = v
+	}
+
+	if q.Get("subdivide-max-vertices") != "" {
+
+		v, err := strconv.Atoi(q.Get("subdivide-max-vertices"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?subdivide-max-vertices= parameter, %w", err)
+		}
+
+		if v < 4 {
+			return nil, fmt.Errorf("Invalid ?subdivide-max-vertices= parameter, must be at least 4")
+		}
+
+		opts.subdivide_max_vertices = v
+	}
+
+	if q.Get("isolation") != "" {
+
+		v, err := tables.ParseIsolationLevel(q.Get("isolation"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?isolation= parameter, %w", err)
+		}
+
+		opts.isolation = v
+	}
+
+	if q.Get("oversized") != "" {
+
+		v, err := tables.ParseOversizedStrategy(q.Get("oversized"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?oversized= parameter, %w", err)
+		}
+
+		opts.oversized = v
+	}
+
+	if q.Get("codec") != "" {
+
+		v, err := tables.ParseCodec(q.Get("codec"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?codec= parameter, %w", err)
+		}
+
+		opts.codec = v
+	}
+
+	retention := &tables.HistoryRetention{}
+
+	if q.Get("history-max-age") != "" {
+
+		v, err := time.ParseDuration(q.Get("history-max-age"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?history-max-age= parameter, %w", err)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid ?history-max-age= parameter, must not be negative")
+		}
+
+		retention.MaxAge = v
+	}
+
+	if q.Get("history-max-versions") != "" {
+
+		v, err := strconv.Atoi(q.Get("history-max-versions"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?history-max-versions= parameter, %w", err)
+		}
+
+		if v < 0 {
+			return nil, fmt.Errorf("Invalid ?history-max-versions= parameter, must not be negative")
+		}
+
+		retention.MaxVersions = v
+	}
+
+	if retention.MaxAge != 0 || retention.MaxVersions != 0 {
+		opts.history_retention = retention
+	}
+
+	// The "geojson_history" table copies the existing row from the "geojson" table
+
+	if opts.index_history && !opts.index_geojson {
+		return nil, fmt.Errorf("Indexing the %s table (?history=true) requires indexing the %s table", tables.HISTORY_TABLE_NAME, wof_tables.GEOJSON_TABLE_NAME)
+	}
+
+	// The "wof_changes" table compares records with the existing row in the "geojson" table
+
+	if opts.index_changes && !opts.index_geojson {
+		return nil, fmt.Errorf("Indexing the %s table (?changes=true) requires indexing the %s table", tables.CHANGES_TABLE_NAME, wof_tables.GEOJSON_TABLE_NAME)
+	}
+
+	opts.promoted_columns = make([]*tables.PromotedColumn, 0)
+
+	if q.Get("columns-config") != "" {
+
+		columns, err := tables.ReadPromotedColumns(q.Get("columns-config"))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?columns-config= parameter, %w", err)
+		}
+
+		opts.promoted_columns = append(opts.promoted_columns, columns...)
+	}
+
+	for _, str_column := range q["column"] {
+
+		c, err := tables.ParsePromotedColumn(str_column)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ?column= parameter, %w", err)
+		}
+
+		opts.promoted_columns = append(opts.promoted_columns, c)
+	}
+
+	count_tables := 0
+
+	// The "whosonfirst_belongsto" table is only indexed by default when transactions are enabled
+
+	index_belongsto := opts.index_belongsto != nil && *opts.index_belongsto
+
+	for _, index := range []bool{opts.index_geojson, opts.index_history, opts.index_changes, opts.index_whosonfirst, opts.index_subdivided, index_belongsto} {
+
+		if index {
+			count_tables += 1
+		}
+	}
+
+	if !opts.use_transaction && count_tables > 1 {
+		return nil, fmt.Errorf("Disabling transactions (?transaction=false) is only supported when indexing a single table")
+	}
+
+	retry_policy, err := retry.NewPolicyFromQuery(q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create retry policy, %w", err)
+	}
+
+	opts.retry_policy = retry_policy
+
+	return opts, nil
+}
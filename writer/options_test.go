@@ -0,0 +1,201 @@
+package writer
+
+import (
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+)
+
+func TestParseWriterOptions(t *testing.T) {
+
+	tests := []struct {
+		query string
+		check func(*writerOptions) bool
+	}{
+		{
+			query: "",
+			check: func(opts *writerOptions) bool {
+				return opts.index_geojson && opts.index_whosonfirst && !opts.index_subdivided && opts.subdivide_max_vertices == tables.DEFAULT_SUBDIVIDE_MAX_VERTICES && opts.index_belongsto == nil && !opts.index_history && opts.history_retention == nil && !opts.index_changes && len(opts.promoted_columns) == 0 && opts.workers == 0 && opts.ping_timeout == DEFAULT_PING_TIMEOUT && opts.use_transaction && opts.derive_dates
+			},
+		},
+		{
+			query: "geojson=false",
+			check: func(opts *writerOptions) bool {
+				return !opts.index_geojson && opts.index_whosonfirst
+			},
+		},
+		{
+			query: "geojson=false&transaction=false&isolation=serializable",
+			check: func(opts *writerOptions) bool {
+				return !opts.index_geojson && !opts.use_transaction && opts.isolation == sql.LevelSerializable
+			},
+		},
+		{
+			query: "workers=0",
+			check: func(opts *writerOptions) bool {
+				return opts.workers == 0
+			},
+		},
+		{
+			query: "workers=4&ping-timeout=2s",
+			check: func(opts *writerOptions) bool {
+				return opts.workers == 4 && opts.ping_timeout == 2*time.Second
+			},
+		},
+		{
+			query: "dead-letter=fs%3A%2F%2F%2Ftmp%2Ffailed",
+			check: func(opts *writerOptions) bool {
+				return opts.dead_letter == "fs:///tmp/failed"
+			},
+		},
+		{
+			query: "dry-run=true",
+			check: func(opts *writerOptions) bool {
+				return opts.dry_run
+			},
+		},
+		{
+			query: "oversized=compress,simplify,skip",
+			check: func(opts *writerOptions) bool {
+				return opts.oversized == "compress,simplify,skip"
+			},
+		},
+		{
+			query: "codec=zstd",
+			check: func(opts *writerOptions) bool {
+				return opts.codec == "zstd"
+			},
+		},
+		{
+			query: "subdivided=true&subdivide-max-vertices=64",
+			check: func(opts *writerOptions) bool {
+				return opts.index_subdivided && opts.subdivide_max_vertices == 64
+			},
+		},
+		{
+			query: "geojson=false&whosonfirst=false&subdivided=true&transaction=false",
+			check: func(opts *writerOptions) bool {
+				return opts.index_subdivided && !opts.use_transaction
+			},
+		},
+		{
+			query: "belongsto=true",
+			check: func(opts *writerOptions) bool {
+				return opts.index_belongsto != nil && *opts.index_belongsto
+			},
+		},
+		{
+			query: "geojson=false&belongsto=false&transaction=false",
+			check: func(opts *writerOptions) bool {
+				return opts.index_belongsto != nil && !*opts.index_belongsto && !opts.use_transaction
+			},
+		},
+		{
+			query: "column=country,wof:country,CHAR(2),indexed&column=population,wof:population,BIGINT",
+			check: func(opts *writerOptions) bool {
+				return len(opts.promoted_columns) == 2 && opts.promoted_columns[0].Indexed && opts.promoted_columns[1].Type == "BIGINT"
+			},
+		},
+		{
+			query: "history=true",
+			check: func(opts *writerOptions) bool {
+				return opts.index_history && opts.history_retention == nil
+			},
+		},
+		{
+			query: "history=true&history-max-age=2160h&history-max-versions=10",
+			check: func(opts *writerOptions) bool {
+				return opts.index_history && opts.history_retention.MaxAge == 2160*time.Hour && opts.history_retention.MaxVersions == 10
+			},
+		},
+		{
+			query: "changes=true&history=true",
+			check: func(opts *writerOptions) bool {
+				return opts.index_changes && opts.index_history
+			},
+		},
+		{
+			query: "derive-dates=false",
+			check: func(opts *writerOptions) bool {
+				return !opts.derive_dates && opts.index_whosonfirst
+			},
+		},
+		{
+			query: "max-retries=0",
+			check: func(opts *writerOptions) bool {
+				return opts.retry_policy.MaxRetries == 0
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		q, err := url.ParseQuery(test.query)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", test.query, err)
+		}
+
+		opts, err := parseWriterOptions(q)
+
+		if err != nil {
+			t.Fatalf("Failed to parse writer options for '%s', %v", test.query, err)
+		}
+
+		if !test.check(opts) {
+			t.Fatalf("Unexpected writer options for '%s', %+v", test.query, opts)
+		}
+	}
+}
+
+func TestParseWriterOptionsInvalid(t *testing.T) {
+
+	tests := []string{
+		"geojson=maybe",
+		"ping-timeout=soon",
+		"workers=-1",
+		"workers=many",
+		"max-retries=-1",
+		"isolation=whatever",
+		"transaction=false",
+		"dry-run=perhaps",
+		"oversized=fail,skip",
+		"codec=brotli",
+		"subdivided=sometimes",
+		"subdivide-max-vertices=3",
+		"subdivide-max-vertices=lots",
+		"whosonfirst=false&subdivided=true&transaction=false",
+		"belongsto=yes",
+		"derive-dates=sometimes",
+		"history=often",
+		"history-max-age=forever",
+		"history-max-age=-1h",
+		"history-max-versions=-1",
+		"geojson=false&history=true",
+		"whosonfirst=false&history=true&transaction=false",
+		"changes=always",
+		"geojson=false&changes=true",
+		"whosonfirst=false&changes=true&transaction=false",
+		"column=country,wof:country",
+		"columns-config=/does/not/exist.json",
+		"geojson=false&belongsto=true&transaction=false",
+	}
+
+	for _, str_q := range tests {
+
+		q, err := url.ParseQuery(str_q)
+
+		if err != nil {
+			t.Fatalf("Failed to parse query '%s', %v", str_q, err)
+		}
+
+		_, err = parseWriterOptions(q)
+
+		if err == nil {
+			t.Fatalf("Expected query '%s' to fail", str_q)
+		}
+	}
+}
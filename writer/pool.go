@@ -0,0 +1,116 @@
+package writer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+)
+
+// The default amount of time to wait for the database to respond to a ping when a new writer is created.
+const DEFAULT_PING_TIMEOUT time.Duration = 10 * time.Second
+
+// configurePool assigns connection pool settings defined in 'q' to the `sql.DB` instance associated with 'db'.
+// Supported parameters are:
+// * `?max-open-conns=` The maximum number of open connections to the database.
+// * `?max-idle-conns=` The maximum number of connections in the idle connection pool.
+// * `?conn-max-lifetime=` The maximum amount of time (expressed as a Go duration string) a connection may be reused.
+// * `?conn-max-idletime=` The maximum amount of time (expressed as a Go duration string) a connection may be idle.
+func configurePool(ctx context.Context, db wof_sql.Database, q url.Values) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	if q.Get("max-open-conns") != "" {
+
+		v, err := strconv.Atoi(q.Get("max-open-conns"))
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse ?max-open-conns= parameter, %w", err)
+		}
+
+		conn.SetMaxOpenConns(v)
+	}
+
+	if q.Get("max-idle-conns") != "" {
+
+		v, err := strconv.Atoi(q.Get("max-idle-conns"))
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse ?max-idle-conns= parameter, %w", err)
+		}
+
+		conn.SetMaxIdleConns(v)
+	}
+
+	if q.Get("conn-max-lifetime") != "" {
+
+		d, err := time.ParseDuration(q.Get("conn-max-lifetime"))
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse ?conn-max-lifetime= parameter, %w", err)
+		}
+
+		conn.SetConnMaxLifetime(d)
+	}
+
+	if q.Get("conn-max-idletime") != "" {
+
+		d, err := time.ParseDuration(q.Get("conn-max-idletime"))
+
+		if err != nil {
+			return fmt.Errorf("Failed to parse ?conn-max-idletime= parameter, %w", err)
+		}
+
+		conn.SetConnMaxIdleTime(d)
+	}
+
+	return nil
+}
+
+// pingDatabase ensures that the database associated with 'db' can be reached, waiting no longer than 'timeout'.
+func pingDatabase(ctx context.Context, db wof_sql.Database, timeout time.Duration) error {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	ping_ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = conn.PingContext(ping_ctx)
+
+	if err != nil {
+		return fmt.Errorf("Failed to ping database, %w", err)
+	}
+
+	return nil
+}
+
+// maxAllowedPacket returns the value of the `max_allowed_packet` variable for the database server associated with 'db'.
+func maxAllowedPacket(ctx context.Context, db wof_sql.Database) (int, error) {
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	var max_packet int
+
+	err = conn.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&max_packet)
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to determine max_allowed_packet, %w", err)
+	}
+
+	return max_packet, nil
+}
@@ -0,0 +1,64 @@
+package writer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+)
+
+// indexFeature indexes 'body' in all the tables associated with 'wr'. Unless transactions have been disabled this happens
+// inside a single transaction using the writer's isolation level. If transactions have been disabled it is assumed that
+// there is only one table to index.
+func (wr *MySQLWriter) indexFeature(ctx context.Context, body []byte, args ...interface{}) error {
+
+	conn, err := wr.db.Conn()
+
+	if err != nil {
+		return fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	if !wr.use_transaction {
+
+		for _, t := range wr.tables {
+
+			err := t.(tables.ExecerTable).IndexFeatureWithExecer(ctx, conn, body, args...)
+
+			if err != nil {
+				return fmt.Errorf("Failed to index %s table, %w", t.Name(), err)
+			}
+		}
+
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: wr.isolation})
+
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction, %w", err)
+	}
+
+	for _, t := range wr.tables {
+
+		err := t.IndexFeature(ctx, tx, body, args...)
+
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to index %s table, %w", t.Name(), err)
+		}
+	}
+
+	_, span := tracing.Start(ctx, "MySQLWriter.commit")
+
+	err = tx.Commit()
+
+	tracing.End(span, err)
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
@@ -2,20 +2,31 @@ package writer
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
 	"net/url"
-	"strconv"
+	"sync"
+	"sync/atomic"
 
 	_ "github.com/go-sql-driver/mysql"
-	
+
 	wof_sql "github.com/whosonfirst/go-whosonfirst-database-sql"
+	"github.com/whosonfirst/go-whosonfirst-mysql/metrics"
+	"github.com/whosonfirst/go-whosonfirst-mysql/retry"
 	"github.com/whosonfirst/go-whosonfirst-mysql/tables"
-	wof_writer "github.com/whosonfirst/go-writer/v3"	
+	"github.com/whosonfirst/go-whosonfirst-mysql/tracing"
+	"github.com/whosonfirst/go-whosonfirst-uri"
+	wof_writer "github.com/whosonfirst/go-writer/v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// writer_count is used to derive a unique label for the metrics collectors registered by each `MySQLWriter` instance.
+var writer_count atomic.Int64
+
 func init() {
 	ctx := context.Background()
 	wof_writer.RegisterWriter(ctx, "mysql", NewMySQLWriter)
@@ -25,9 +36,45 @@ type MySQLWriter struct {
 	wof_writer.Writer
 	db     wof_sql.Database
 	tables []wof_sql.Table
+	retry  *retry.Policy
+	stats  map[string]*tables.Stats
+	// An optional writer where the bodies of records that fail to be indexed are written.
+	dead_letter wof_writer.Writer
+	// If true records are validated but not indexed.
+	dry_run bool
+	// The value of the database server's max_allowed_packet setting.
+	max_packet int
+	// The strategy, or comma-separated list of strategies, used to handle records that exceed max_packet.
+	oversized string
+	// The number of records that failed validation in "dry run" mode.
+	invalid *atomic.Int64
+	// The transaction isolation level used to index features.
+	isolation sql.IsolationLevel
+	// Whether features are indexed inside an explicit transaction.
+	use_transaction bool
+	// The number of worker goroutines used to index features. If 0 features are indexed synchronously.
+	workers int
+	jobs    chan *writeJob
+	pending *sync.WaitGroup
+	done    *sync.WaitGroup
+	errors  []error
+	mu      *sync.Mutex
+	state   *sync.RWMutex
+	closed  bool
+	// The number of features indexed since the last call to Flush (or Close).
+	batch *atomic.Int64
+	// Functions to unregister the metrics collectors specific to this writer when it is closed.
+	unregister []func()
 }
 
-func NewMySQLWriter(ctx context.Context, uri string) (wof_writer.Writer, error) {
+// writeJob is a feature (body) to be indexed by a worker goroutine.
+type writeJob struct {
+	ctx  context.Context
+	path string
+	body []byte
+}
+
+func NewMySQLWriter(ctx context.Context, uri string) (_ wof_writer.Writer, err error) {
 
 	u, err := url.Parse(uri)
 
@@ -37,6 +84,12 @@ func NewMySQLWriter(ctx context.Context, uri string) (wof_writer.Writer, error)
 
 	q := u.Query()
 
+	writer_opts, err := parseWriterOptions(q)
+
+	if err != nil {
+		return nil, err
+	}
+
 	dsn := q.Get("dsn")
 	enc_dsn := url.QueryEscape(dsn)
 
@@ -48,58 +101,344 @@ func NewMySQLWriter(ctx context.Context, uri string) (wof_writer.Writer, error)
 		return nil, fmt.Errorf("Failed to create database, %w", err)
 	}
 
-	index_geojson := true
-	index_whosonfirst := true
+	// Release the database if the writer can not be created
+
+	defer func() {
+
+		if err == nil {
+			return
+		}
+
+		db.Close()
+	}()
+
+	err = configurePool(ctx, db, q)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to configure database connection pool, %w", err)
+	}
+
+	err = pingDatabase(ctx, db, writer_opts.ping_timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index_geojson := writer_opts.index_geojson
+	index_whosonfirst := writer_opts.index_whosonfirst
+	workers := writer_opts.workers
+
+	retry_policy := writer_opts.retry_policy
+	isolation := writer_opts.isolation
+	use_transaction := writer_opts.use_transaction
+	dry_run := writer_opts.dry_run
+	oversized := writer_opts.oversized
+
+	max_packet, err := maxAllowedPacket(ctx, db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var dead_letter wof_writer.Writer
 
-	if q.Get("geojson") != "" {
+	if writer_opts.dead_letter != "" {
 
-		index, err := strconv.ParseBool(q.Get("geojson"))
+		dead_letter, err = wof_writer.NewWriter(ctx, writer_opts.dead_letter)
 
 		if err != nil {
-			return nil, fmt.Errorf("Failed to parse ?geojson= parameter, %w", err)
+			return nil, fmt.Errorf("Failed to create dead letter writer, %w", err)
 		}
 
-		index_geojson = index
+		// Release the dead letter writer if the writer can not be created
+
+		defer func() {
+
+			if err == nil {
+				return
+			}
+
+			dead_letter.Close(ctx)
+		}()
 	}
 
-	if q.Get("whosonfirst") != "" {
+	to_index := make([]wof_sql.Table, 0)
+	stats := make(map[string]*tables.Stats)
+
+	// The "geojson_history" and "wof_changes" tables read the existing row from the "geojson"
+	// table so they need to be indexed first.
 
-		index, err := strconv.ParseBool(q.Get("whosonfirst"))
+	if writer_opts.index_history {
+
+		opts, err := tables.DefaultHistoryTableOptions()
 
 		if err != nil {
-			return nil, fmt.Errorf("Failed to parse ?whosonfirst= parameter, %w", err)
+			return nil, fmt.Errorf("Failed to create history table options, %w", err)
 		}
 
-		index_whosonfirst = index
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+		opts.Retention = writer_opts.history_retention
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewHistoryTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewHistoryTableWithDatabaseAndOptions(ctx, db, opts)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create history table, %w", err)
+		}
+
+		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
 	}
 
-	to_index := make([]wof_sql.Table, 0)
+	if writer_opts.index_changes {
+
+		opts, err := tables.DefaultChangesTableOptions()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create changes table options, %w", err)
+		}
+
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewChangesTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewChangesTableWithDatabaseAndOptions(ctx, db, opts)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create changes table, %w", err)
+		}
+
+		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
+	}
 
 	if index_geojson {
 
-		t, err := tables.NewGeoJSONTableWithDatabase(ctx, db)
+		opts, err := tables.DefaultGeoJSONTableOptions()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create GeoJSON table options, %w", err)
+		}
+
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+		opts.OversizedStrategy = oversized
+		opts.Codec = writer_opts.codec
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewGeoJSONTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewGeoJSONTableWithDatabaseAndOptions(ctx, db, opts)
+		}
 
 		if err != nil {
 			return nil, fmt.Errorf("Failed to create GeoJSON table, %w", err)
 		}
 
 		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
 	}
 
 	if index_whosonfirst {
 
-		t, err := tables.NewWhosonfirstTableWithDatabase(ctx, db)
+		opts, err := tables.DefaultWhosonfirstTableOptions()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create Whosonfirst table options, %w", err)
+		}
+
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+		opts.OversizedStrategy = oversized
+		opts.PromotedColumns = writer_opts.promoted_columns
+		opts.DeriveDates = writer_opts.derive_dates
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewWhosonfirstTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewWhosonfirstTableWithDatabaseAndOptions(ctx, db, opts)
+		}
 
 		if err != nil {
 			return nil, fmt.Errorf("Failed to create Whosonfirst table, %w", err)
 		}
 
 		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
+	}
+
+	if writer_opts.index_subdivided {
+
+		opts, err := tables.DefaultSubdividedTableOptions()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create subdivided table options, %w", err)
+		}
+
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+		opts.OversizedStrategy = oversized
+		opts.MaxVertices = writer_opts.subdivide_max_vertices
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewSubdividedTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewSubdividedTableWithDatabaseAndOptions(ctx, db, opts)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create subdivided table, %w", err)
+		}
+
+		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
+	}
+
+	// By default the "whosonfirst_belongsto" table is only indexed if the server does not support
+	// the multi-valued index on the "whosonfirst" table's "wof:belongsto" property (and explicit
+	// transactions have not been disabled).
+
+	index_belongsto := false
+
+	switch {
+	case writer_opts.index_belongsto != nil:
+		index_belongsto = *writer_opts.index_belongsto
+	case index_whosonfirst && use_transaction:
+
+		conn, err := db.Conn()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+		}
+
+		supported, err := tables.SupportsMultiValuedIndexes(ctx, conn)
+
+		if err != nil {
+			return nil, err
+		}
+
+		index_belongsto = !supported
+	}
+
+	if index_belongsto {
+
+		opts, err := tables.DefaultBelongsToTableOptions()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create belongsto table options, %w", err)
+		}
+
+		opts.RetryPolicy = retry_policy
+		opts.IsolationLevel = isolation
+		opts.UseTransaction = use_transaction
+		opts.MaxPacketSize = max_packet
+
+		var t wof_sql.Table
+
+		if dry_run {
+			t, err = tables.NewBelongsToTableWithOptions(ctx, opts)
+		} else {
+			t, err = tables.NewBelongsToTableWithDatabaseAndOptions(ctx, db, opts)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create belongsto table, %w", err)
+		}
+
+		to_index = append(to_index, t)
+		stats[t.Name()] = opts.Stats
 	}
 
 	wr := &MySQLWriter{
-		db:     db,
-		tables: to_index,
+		db:              db,
+		tables:          to_index,
+		retry:           retry_policy,
+		stats:           stats,
+		dead_letter:     dead_letter,
+		dry_run:         dry_run,
+		max_packet:      max_packet,
+		oversized:       oversized,
+		invalid:         new(atomic.Int64),
+		isolation:       isolation,
+		use_transaction: use_transaction,
+		workers:         workers,
+		pending:         new(sync.WaitGroup),
+		done:            new(sync.WaitGroup),
+		errors:          make([]error, 0),
+		mu:              new(sync.Mutex),
+		state:           new(sync.RWMutex),
+		batch:           new(atomic.Int64),
+		unregister:      make([]func(), 0),
+	}
+
+	metrics_id := fmt.Sprintf("writer-%d", writer_count.Add(1))
+
+	conn, err := db.Conn()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to establish database connection, %w", err)
+	}
+
+	unregister_db, err := metrics.RegisterDBStats(metrics_id, conn)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register database metrics, %w", err)
+	}
+
+	wr.unregister = append(wr.unregister, unregister_db)
+
+	if workers > 0 {
+
+		// The jobs channel is only as deep as the number of workers so that
+		// calls to Write will block (apply backpressure) once every worker is
+		// busy waiting on a connection from the underlying *sql.DB pool.
+
+		wr.jobs = make(chan *writeJob, workers)
+
+		queue_depth := func() float64 {
+			return float64(len(wr.jobs))
+		}
+
+		unregister_queue, err := metrics.RegisterQueueDepth(metrics_id, queue_depth)
+
+		if err != nil {
+			wr.unregisterMetrics()
+			return nil, fmt.Errorf("Failed to register queue depth metrics, %w", err)
+		}
+
+		wr.unregister = append(wr.unregister, unregister_queue)
+
+		for i := 0; i < workers; i++ {
+			wr.done.Add(1)
+			go wr.work(i)
+		}
 	}
 
 	return wr, nil
@@ -107,31 +446,323 @@ func NewMySQLWriter(ctx context.Context, uri string) (wof_writer.Writer, error)
 
 func (wr *MySQLWriter) Write(ctx context.Context, path string, r io.ReadSeeker) (int64, error) {
 
+	ctx, span := tracing.Start(ctx, "MySQLWriter.Write", tracing.ATTRIBUTE_PATH.String(path))
+
+	size, err := wr.write(ctx, path, r)
+
+	tracing.End(span, err)
+
+	return size, err
+}
+
+func (wr *MySQLWriter) write(ctx context.Context, path string, r io.ReadSeeker) (int64, error) {
+
 	body, err := io.ReadAll(r)
 
 	if err != nil {
 		return 0, fmt.Errorf("Failed to read document, %w", err)
 	}
 
-	err = wr.db.IndexFeature(ctx, wr.tables, body)
+	wr.state.RLock()
+	defer wr.state.RUnlock()
+
+	if wr.closed {
+		return 0, fmt.Errorf("Failed to index %s, writer has been closed", path)
+	}
+
+	size := int64(len(body))
+
+	if wr.workers == 0 {
+
+		err = wr.index(ctx, path, body)
+
+		if err != nil {
+			return 0, err
+		}
+
+		return size, nil
+	}
+
+	job := &writeJob{
+		ctx:  ctx,
+		path: path,
+		body: body,
+	}
+
+	wr.pending.Add(1)
+
+	select {
+	case wr.jobs <- job:
+		// pass
+	case <-ctx.Done():
+		wr.pending.Done()
+		return 0, fmt.Errorf("Failed to schedule %s for indexing, %w", path, ctx.Err())
+	}
+
+	return size, nil
+}
+
+func (wr *MySQLWriter) index(ctx context.Context, path string, body []byte) (err error) {
+
+	ctx, span := tracing.Start(ctx, "MySQLWriter.index", tracing.ATTRIBUTE_PATH.String(path))
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	args := featureArgs(path)
+
+	if wr.dry_run {
+		return wr.validateFeature(ctx, path, body, args...)
+	}
+
+	index := func(ctx context.Context) error {
+		return wr.indexFeature(ctx, body, args...)
+	}
+
+	retries, err := wr.retry.Do(ctx, index)
+
+	span.SetAttributes(attribute.Int("retries", retries))
 
 	if err != nil {
-		return 0, fmt.Errorf("Failed to index %s, %w", path, err)
+
+		if tables.HasOversizedStrategy(wr.oversized, tables.OVERSIZED_SKIP) && errors.Is(err, tables.ErrPacketTooLarge) {
+			return wr.skipOversized(ctx, path, body, err)
+		}
+
+		metrics.FeaturesTotal.WithLabelValues("failed").Inc()
+
+		err = fmt.Errorf("Failed to index %s after %d retries, %w", path, retries, err)
+
+		if wr.dead_letter != nil {
+
+			dl_err := wr.writeDeadLetter(ctx, path, body, err)
+
+			if dl_err != nil {
+				slog.Error("Failed to write dead letter", "path", path, "error", dl_err)
+				err = errors.Join(err, dl_err)
+			}
+		}
+
+		return err
+	}
+
+	metrics.FeaturesTotal.WithLabelValues("indexed").Inc()
+	metrics.BytesTotal.Add(float64(len(body)))
+
+	wr.batch.Add(1)
+
+	if retries > 0 {
+		slog.Debug("Indexed record after transient errors", "path", path, "retries", retries)
+	}
+
+	return nil
+}
+
+// featureArgs returns the custom arguments passed to each table when indexing the record at 'path'. If 'path' is
+// an alternate geometry this is its `uri.AltGeom` instance so that tables don't overwrite the principal record.
+func featureArgs(path string) []interface{} {
+
+	args := make([]interface{}, 0)
+
+	_, uri_args, err := uri.ParseURI(path)
+
+	if err != nil {
+		return args
 	}
 
-	return 0, nil
+	if uri_args.IsAlternate {
+		args = append(args, uri_args.AltGeom)
+	}
+
+	return args
+}
+
+// skipOversized records that the record at 'path' was skipped because it exceeds the database server's max_allowed_packet
+// setting, writing it to the dead-letter writer if present.
+func (wr *MySQLWriter) skipOversized(ctx context.Context, path string, body []byte, oversized_err error) error {
+
+	metrics.FeaturesTotal.WithLabelValues("skipped").Inc()
+	slog.Warn("Skipping oversized record", "path", path, "error", oversized_err)
+
+	if wr.dead_letter == nil {
+		return nil
+	}
+
+	err := wr.writeDeadLetter(ctx, path, body, oversized_err)
+
+	if err != nil {
+		return fmt.Errorf("Failed to skip oversized record %s, %w", path, err)
+	}
+
+	return nil
+}
+
+// Stats returns a summary of the records indexed by each table, keyed by table name.
+func (wr *MySQLWriter) Stats() map[string]*tables.StatsSummary {
+
+	summaries := make(map[string]*tables.StatsSummary)
+
+	for name, s := range wr.stats {
+		summaries[name] = s.Summary()
+	}
+
+	return summaries
+}
+
+// Retries returns the total number of times that indexing operations have been retried because of transient errors.
+func (wr *MySQLWriter) Retries() int64 {
+	return wr.retry.Retries()
+}
+
+// work indexes features received on the jobs channel until it is closed, recording
+// any errors so they can be reported by the Flush or Close methods.
+func (wr *MySQLWriter) work(worker int) {
+
+	defer wr.done.Done()
+
+	for job := range wr.jobs {
+
+		err := wr.index(job.ctx, job.path, job.body)
+
+		if err != nil {
+
+			slog.Debug("Worker failed to index record", "worker", worker, "path", job.path, "error", err)
+
+			wr.mu.Lock()
+			wr.errors = append(wr.errors, fmt.Errorf("Worker %d: %w", worker, err))
+			wr.mu.Unlock()
+		}
+
+		wr.pending.Done()
+	}
+}
+
+// drainErrors returns any errors recorded by worker goroutines, joined as a single error, and resets the internal list of errors.
+func (wr *MySQLWriter) drainErrors() error {
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if len(wr.errors) == 0 {
+		return nil
+	}
+
+	err := errors.Join(wr.errors...)
+	wr.errors = make([]error, 0)
+
+	return err
 }
 
 func (wr *MySQLWriter) WriterURI(ctx context.Context, uri string) string {
 	return uri
 }
 
+// Flush waits for any features that have been scheduled for indexing by worker goroutines to complete
+// and returns any errors encountered along the way.
 func (wr *MySQLWriter) Flush(ctx context.Context) error {
+
+	if wr.workers == 0 {
+		wr.observeBatch()
+		return nil
+	}
+
+	wr.pending.Wait()
+	wr.observeBatch()
+
+	err := wr.drainErrors()
+
+	if err != nil {
+		return fmt.Errorf("Failed to index one or more records, %w", err)
+	}
+
 	return nil
 }
 
+// Close waits for any features that have been scheduled for indexing by worker goroutines to complete,
+// stops those workers, releases the underlying database connection pool and returns any errors encountered
+// along the way.
 func (wr *MySQLWriter) Close(ctx context.Context) error {
-	return nil
+
+	wr.state.Lock()
+
+	if wr.closed {
+		wr.state.Unlock()
+		return nil
+	}
+
+	wr.closed = true
+	wr.state.Unlock()
+
+	errs := make([]error, 0)
+
+	if wr.workers > 0 {
+
+		wr.pending.Wait()
+
+		close(wr.jobs)
+		wr.done.Wait()
+
+		err := wr.drainErrors()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to index one or more records, %w", err))
+		}
+	}
+
+	wr.observeBatch()
+	wr.unregisterMetrics()
+
+	for name, s := range wr.Stats() {
+		slog.Info("Table statistics", "table", name, "inserted", s.Inserted, "replaced", s.Replaced, "skipped", s.Skipped, "failed", s.Failed, "bytes", s.Bytes, "duration", s.Duration)
+	}
+
+	if wr.dry_run {
+		slog.Info("Dry run complete", "invalid", wr.invalid.Load())
+	}
+
+	retries := wr.Retries()
+
+	if retries > 0 {
+		slog.Info("Indexing operations were retried because of transient errors", "retries", retries)
+	}
+
+	if wr.dead_letter != nil {
+
+		err := wr.dead_letter.Close(ctx)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Failed to close dead letter writer, %w", err))
+		}
+	}
+
+	err := wr.db.Close()
+
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Failed to close database, %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// observeBatch records the number of features indexed since it was last called in the `metrics.BatchSize` histogram.
+func (wr *MySQLWriter) observeBatch() {
+
+	n := wr.batch.Swap(0)
+
+	if n > 0 {
+		metrics.BatchSize.Observe(float64(n))
+	}
+}
+
+// unregisterMetrics unregisters the metrics collectors specific to this writer.
+func (wr *MySQLWriter) unregisterMetrics() {
+
+	for _, unregister := range wr.unregister {
+		unregister()
+	}
+
+	wr.unregister = nil
 }
 
 func (wr *MySQLWriter) SetLogger(ctx context.Context, logger *log.Logger) error {
@@ -0,0 +1,47 @@
+package writer
+
+import (
+	"testing"
+
+	"github.com/whosonfirst/go-whosonfirst-uri"
+)
+
+func TestFeatureArgs(t *testing.T) {
+
+	tests := []struct {
+		path string
+		alt  string
+	}{
+		{"101/736/545/101736545.geojson", ""},
+		{"101/736/545/101736545-alt-quattroshapes.geojson", "quattroshapes"},
+		{"not-a-wof-record.geojson", ""},
+	}
+
+	for _, test := range tests {
+
+		args := featureArgs(test.path)
+
+		if test.alt == "" {
+
+			if len(args) != 0 {
+				t.Fatalf("Expected no arguments for %s, got %v", test.path, args)
+			}
+
+			continue
+		}
+
+		if len(args) != 1 {
+			t.Fatalf("Expected one argument for %s, got %v", test.path, args)
+		}
+
+		str_alt, err := args[0].(*uri.AltGeom).String()
+
+		if err != nil {
+			t.Fatalf("Failed to stringify alternate geometry for %s, %v", test.path, err)
+		}
+
+		if str_alt != test.alt {
+			t.Fatalf("Unexpected alternate geometry for %s: '%s'", test.path, str_alt)
+		}
+	}
+}